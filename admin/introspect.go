@@ -0,0 +1,125 @@
+package admin
+
+import (
+	"fmt"
+	"godmin/internal/model"
+	"godmin/internal/store/query"
+	"regexp"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// columnTypes maps the udt_name of the supported columns, other columns are left out of the resource
+var columnTypes = map[string]query.Type{
+	"text":        query.TypeText,
+	"varchar":     query.TypeText,
+	"bpchar":      query.TypeText,
+	"citext":      query.TypeText,
+	"uuid":        query.TypeText,
+	"int2":        query.TypeInt,
+	"int4":        query.TypeInt,
+	"int8":        query.TypeInt,
+	"float4":      query.TypeFloat,
+	"float8":      query.TypeFloat,
+	"numeric":     query.TypeFloat,
+	"bool":        query.TypeBool,
+	"date":        query.TypeTime,
+	"timestamp":   query.TypeTime,
+	"timestamptz": query.TypeTime,
+}
+
+// godmin's own tables are administered through the dedicated routes only
+var reservedTables = map[string]bool{
+	"users":               true,
+	"user_totp":           true,
+	"user_recovery_codes": true,
+	"password_history":    true,
+	"audit_events":        true,
+	"api_keys":            true,
+	"roles":               true,
+	"permissions":         true,
+	"role_permissions":    true,
+	"user_roles":          true,
+	"schema_migrations":   true,
+}
+
+// secret columns are write only
+var hiddenColumn = regexp.MustCompile(`password|secret|token|_hash$`)
+
+// Introspectable reports whether the table can be exposed, only lists the allowed tables if not empty
+func Introspectable(table string, only []string) bool {
+	if reservedTables[table] {
+		return false
+	}
+	if len(only) == 0 {
+		return true
+	}
+
+	for _, t := range only {
+		if t == table {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FromTable derives a resource from the table definition.
+// The table needs a single column primary key of a supported type, columns of other types are left out.
+func FromTable(t *model.Table) (Resource, error) {
+	r := Resource{Table: t.Name}
+
+	if len(t.PrimaryKey) != 1 {
+		return r, fmt.Errorf("table %s has no single column primary key", t.Name)
+	}
+	r.PrimaryKey = t.PrimaryKey[0]
+
+	for _, c := range t.Columns {
+		typ, ok := columnTypes[c.Type]
+		if len(c.Enum) > 0 {
+			typ, ok = query.TypeText, true
+		}
+		if !ok {
+			if c.Name == r.PrimaryKey {
+				return r, fmt.Errorf("table %s: primary key type %s is not supported", t.Name, c.Type)
+			}
+			continue
+		}
+
+		hidden := c.Name != r.PrimaryKey && hiddenColumn.MatchString(c.Name)
+		f := &Field{
+			Name:       c.Name,
+			Type:       typ,
+			Nullable:   c.Nullable,
+			Filterable: !hidden,
+			Sortable:   !hidden && !c.Nullable,
+			ReadOnly:   c.Generated,
+			Hidden:     hidden,
+			Enum:       c.Enum,
+			References: c.References,
+			Rules:      columnRules(c, typ),
+		}
+
+		r.Fields = append(r.Fields, f)
+	}
+
+	return r, nil
+}
+
+// columnRules validates what the column constraints would reject anyway, with a readable error
+func columnRules(c *model.TableColumn, typ query.Type) []validation.Rule {
+	rules := make([]validation.Rule, 0, 2)
+
+	if !c.Nullable && !c.HasDefault && !c.Generated {
+		if typ == query.TypeText {
+			rules = append(rules, validation.Required)
+		} else {
+			rules = append(rules, validation.NotNil)
+		}
+	}
+	if c.MaxLength != nil {
+		rules = append(rules, validation.RuneLength(0, *c.MaxLength))
+	}
+
+	return rules
+}
@@ -0,0 +1,80 @@
+package admin
+
+import (
+	"github.com/stretchr/testify/assert"
+	"godmin/internal/model"
+	"strings"
+	"testing"
+)
+
+func TestFromTable(t *testing.T) {
+	size := 5
+	table := &model.Table{
+		Name:       "orders",
+		PrimaryKey: []string{"id"},
+		Columns: []*model.TableColumn{
+			{Name: "id", Type: "int8", HasDefault: true, Generated: true},
+			{Name: "code", Type: "varchar", MaxLength: &size},
+			{Name: "status", Type: "order_status", HasDefault: true, Enum: []string{"new", "paid"}},
+			{Name: "customer_id", Type: "int8", Nullable: true, References: "customers.id"},
+			{Name: "access_token", Type: "text", Nullable: true},
+			{Name: "payload", Type: "jsonb", Nullable: true},
+		},
+	}
+
+	res, err := FromTable(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rg := &Registry{}
+	if err := rg.Register(res); err != nil {
+		t.Fatal(err)
+	}
+	r := rg.Resources()[0]
+
+	assert.Equal(t, []string{"id", "code", "status", "customer_id"}, r.Columns(), "jsonb is left out, token hidden")
+
+	id, _ := r.Field("id")
+	assert.True(t, id.ReadOnly)
+	assert.True(t, id.Sortable)
+
+	customer, _ := r.Field("customer_id")
+	assert.Equal(t, TypeInt, customer.Type)
+	assert.False(t, customer.Sortable)
+	assert.Equal(t, "customers.id", customer.References)
+
+	token, _ := r.Field("access_token")
+	assert.True(t, token.Hidden)
+	assert.False(t, token.Filterable)
+
+	testCases := []struct {
+		body  string
+		field string
+	}{
+		{body: `{}`, field: "code"},
+		{body: `{"code": ""}`, field: "code"},
+		{body: `{"code": "toolong"}`, field: "code"},
+		{body: `{"code": "a1", "status": "lost"}`, field: "status"},
+	}
+	for _, tc := range testCases {
+		_, err := r.Values(decode(t, tc.body), false)
+		if assert.Error(t, err, tc.body) {
+			assert.True(t, strings.HasPrefix(err.Error(), tc.field+":"), err.Error())
+		}
+	}
+
+	values, err := r.Values(decode(t, `{"code": "a1", "status": "paid", "customer_id": null}`), false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]interface{}{"code": "a1", "status": "paid", "customer_id": nil}, values)
+	}
+
+	_, err = FromTable(&model.Table{Name: "pairs", PrimaryKey: []string{"a", "b"}})
+	assert.Error(t, err)
+}
+
+func TestIntrospectable(t *testing.T) {
+	assert.False(t, Introspectable("users", nil))
+	assert.True(t, Introspectable("orders", nil))
+	assert.False(t, Introspectable("orders", []string{"customers"}))
+	assert.False(t, Introspectable("users", []string{"users"}))
+}
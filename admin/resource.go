@@ -0,0 +1,220 @@
+// Package admin lets godmin administer arbitrary tables. A Resource passed to app.Serve gets list, show,
+// create, update and delete routes under /admin/resources/<name>, e.g. in the main package of a module
+// which imports godmin:
+//
+//	err := app.Serve(admin.Resource{
+//		Table: "orders",
+//		Fields: []*admin.Field{
+//			{Name: "id", Type: admin.TypeInt, ReadOnly: true, Filterable: true, Sortable: true},
+//			{Name: "status", Type: admin.TypeText, Filterable: true, Rules: []validation.Rule{validation.Required}},
+//		},
+//	})
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"godmin/internal/store/query"
+	"regexp"
+	"sync"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+const defaultPrimaryKey = "id"
+
+// Type is the type of a field, the query package is internal to godmin
+type Type = query.Type
+
+const (
+	TypeText  = query.TypeText
+	TypeInt   = query.TypeInt
+	TypeFloat = query.TypeFloat
+	TypeBool  = query.TypeBool
+	TypeTime  = query.TypeTime
+)
+
+// the name takes part in the route and the permissions, which API key scopes have to match
+var nameRegexp = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Field is a column exposed by the resource
+type Field struct {
+	Name       string
+	Type       Type
+	Nullable   bool
+	Filterable bool
+	// Sortable fields take part in the pagination keyset, they must not be nullable
+	Sortable bool
+	// ReadOnly fields are returned but never written, e.g. serial ids or columns filled by the database
+	ReadOnly bool
+	// Hidden fields are written but never returned, e.g. password hashes
+	Hidden bool
+	// Enum restricts a text field to the values
+	Enum []string
+	// References is "table.column" the field is a foreign key to, it is only descriptive
+	References string
+	// Rules validate the value on create, and on update when the field is present
+	Rules []validation.Rule
+}
+
+func (f *Field) rules() []validation.Rule {
+	if len(f.Enum) == 0 {
+		return f.Rules
+	}
+
+	values := make([]interface{}, 0, len(f.Enum))
+	for _, v := range f.Enum {
+		values = append(values, v)
+	}
+
+	return append([]validation.Rule{validation.In(values...)}, f.Rules...)
+}
+
+// Permissions required by the resource routes, "<name>:read" and "<name>:write" by default
+type Permissions struct {
+	Read  string
+	Write string
+}
+
+// Resource is a table administered through the generic routes
+type Resource struct {
+	// Name is the route segment, the table name by default
+	Name  string
+	Table string
+	// PrimaryKey is "id" by default
+	PrimaryKey  string
+	Fields      []*Field
+	Permissions Permissions
+
+	schema *query.Schema
+}
+
+// Field returns the field by its name
+func (r *Resource) Field(name string) (*Field, bool) {
+	for _, f := range r.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+
+	return nil, false
+}
+
+// Schema whitelists what the resource list can be filtered and sorted by
+func (r *Resource) Schema() *query.Schema {
+	return r.schema
+}
+
+// Columns returns the columns selected for the responses, hidden fields are left out
+func (r *Resource) Columns() []string {
+	columns := make([]string, 0, len(r.Fields))
+	for _, f := range r.Fields {
+		if !f.Hidden {
+			columns = append(columns, f.Name)
+		}
+	}
+
+	return columns
+}
+
+// ID parses the primary key from the path parameter
+func (r *Resource) ID(raw string) (interface{}, error) {
+	c, _ := r.schema.Column(r.PrimaryKey)
+
+	return c.Parse(raw)
+}
+
+// init fills the defaults and checks the definition
+func (r *Resource) init() error {
+	if r.Table == "" {
+		return errors.New("resource table is required")
+	}
+	if r.Name == "" {
+		r.Name = r.Table
+	}
+	if !nameRegexp.MatchString(r.Name) {
+		return fmt.Errorf("resource name %q must match %s", r.Name, nameRegexp)
+	}
+	if r.PrimaryKey == "" {
+		r.PrimaryKey = defaultPrimaryKey
+	}
+	if r.Permissions.Read == "" {
+		r.Permissions.Read = r.Name + ":read"
+	}
+	if r.Permissions.Write == "" {
+		r.Permissions.Write = r.Name + ":write"
+	}
+
+	r.schema = &query.Schema{Table: r.Table, PrimaryKey: r.PrimaryKey}
+	seen := map[string]bool{}
+	for _, f := range r.Fields {
+		if f.Name == "" {
+			return fmt.Errorf("%s: field name is required", r.Name)
+		}
+		if seen[f.Name] {
+			return fmt.Errorf("%s: field %q is defined twice", r.Name, f.Name)
+		}
+		seen[f.Name] = true
+
+		if f.Sortable && f.Nullable {
+			return fmt.Errorf("%s: nullable field %q can't be sortable", r.Name, f.Name)
+		}
+		if f.Hidden && (f.Filterable || f.Sortable) {
+			return fmt.Errorf("%s: hidden field %q can't be filtered or sorted by", r.Name, f.Name)
+		}
+		if len(f.Enum) > 0 && f.Type != query.TypeText {
+			return fmt.Errorf("%s: enum field %q must be text", r.Name, f.Name)
+		}
+
+		r.schema.Columns = append(r.schema.Columns, &query.Column{
+			Name:       f.Name,
+			Type:       f.Type,
+			Nullable:   f.Nullable,
+			Filterable: f.Filterable,
+			Sortable:   f.Sortable,
+		})
+	}
+
+	pk, ok := r.Field(r.PrimaryKey)
+	if !ok {
+		return fmt.Errorf("%s: primary key %q is not a field", r.Name, r.PrimaryKey)
+	}
+	if pk.Hidden || pk.Nullable {
+		return fmt.Errorf("%s: primary key %q can't be hidden or nullable", r.Name, r.PrimaryKey)
+	}
+
+	return nil
+}
+
+// Registry holds the registered resources, the zero value is empty and ready to use
+type Registry struct {
+	mu        sync.Mutex
+	resources []*Resource
+}
+
+// Register checks the resource and adds it to the registry
+func (rg *Registry) Register(r Resource) error {
+	if err := r.init(); err != nil {
+		return err
+	}
+
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+
+	for _, registered := range rg.resources {
+		if registered.Name == r.Name {
+			return fmt.Errorf("resource %q is already registered", r.Name)
+		}
+	}
+	rg.resources = append(rg.resources, &r)
+
+	return nil
+}
+
+// Resources returns the registered resources in the registration order
+func (rg *Registry) Resources() []*Resource {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+
+	return append([]*Resource(nil), rg.resources...)
+}
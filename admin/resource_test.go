@@ -0,0 +1,104 @@
+package admin
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+func orders() Resource {
+	return Resource{
+		Table: "orders",
+		Fields: []*Field{
+			{Name: "id", Type: TypeInt, ReadOnly: true, Filterable: true, Sortable: true},
+			{Name: "status", Type: TypeText, Filterable: true, Rules: []validation.Rule{
+				validation.Required,
+				validation.In("new", "paid"),
+			}},
+			{Name: "total", Type: TypeFloat},
+			{Name: "paid_at", Type: TypeTime, Nullable: true},
+			{Name: "secret", Type: TypeText, Hidden: true},
+		},
+	}
+}
+
+func decode(t *testing.T, body string) map[string]interface{} {
+	m := map[string]interface{}{}
+
+	d := json.NewDecoder(strings.NewReader(body))
+	d.UseNumber()
+	if err := d.Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func TestRegistry_Register(t *testing.T) {
+	rg := &Registry{}
+
+	if assert.NoError(t, rg.Register(orders())) {
+		res := rg.Resources()[0]
+		assert.Equal(t, "orders", res.Name)
+		assert.Equal(t, "id", res.PrimaryKey)
+		assert.Equal(t, Permissions{Read: "orders:read", Write: "orders:write"}, res.Permissions)
+		assert.Equal(t, []string{"id", "status", "total", "paid_at"}, res.Columns())
+	}
+
+	assert.Error(t, rg.Register(orders()), "registered twice")
+
+	invalid := []func(r *Resource){
+		func(r *Resource) { r.Table = "" },
+		func(r *Resource) { r.Name = "Orders" },
+		func(r *Resource) { r.PrimaryKey = "uuid" },
+		func(r *Resource) { r.Fields[3].Sortable = true },
+		func(r *Resource) { r.Fields[4].Filterable = true },
+		func(r *Resource) { r.Fields = append(r.Fields, &Field{Name: "status"}) },
+	}
+	for i, modify := range invalid {
+		r := orders()
+		r.Name = "invalid"
+		modify(&r)
+		assert.Error(t, rg.Register(r), i)
+	}
+}
+
+func TestResource_Values(t *testing.T) {
+	rg := &Registry{}
+	if err := rg.Register(orders()); err != nil {
+		t.Fatal(err)
+	}
+	res := rg.Resources()[0]
+
+	values, err := res.Values(decode(t, `{"status": "new", "total": 9.5, "paid_at": "2021-02-01T10:00:00Z"}`), false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]interface{}{
+			"status":  "new",
+			"total":   9.5,
+			"paid_at": time.Date(2021, 2, 1, 10, 0, 0, 0, time.UTC),
+		}, values)
+	}
+
+	// required on create only
+	_, err = res.Values(decode(t, `{"total": 1}`), false)
+	assert.Contains(t, err.(validation.Errors), "status")
+
+	values, err = res.Values(decode(t, `{"paid_at": null}`), true)
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]interface{}{"paid_at": nil}, values)
+	}
+
+	_, err = res.Values(decode(t, `{"id": 1, "unknown": 1, "status": "lost", "total": "1", "secret": null}`), true)
+	if assert.Error(t, err) {
+		errs := err.(validation.Errors)
+		assert.Len(t, errs, 5)
+		assert.Equal(t, errReadOnly, errs["id"])
+		assert.Equal(t, errUnknownField, errs["unknown"])
+		assert.Equal(t, errInvalidType, errs["total"])
+		assert.Equal(t, errNotNull, errs["secret"])
+	}
+}
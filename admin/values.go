@@ -0,0 +1,110 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"godmin/internal/store/query"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+var (
+	errUnknownField = errors.New("unknown field")
+	errReadOnly     = errors.New("is read only")
+	errNotNull      = errors.New("can not be null")
+	errInvalidType  = errors.New("has an invalid type")
+	errInvalidTime  = errors.New("must be a RFC 3339 time")
+)
+
+// Values converts the JSON body, decoded with UseNumber, to the column values and validates them.
+// A partial body, as for PATCH, is validated only for the fields it contains.
+// Fields missing from a create body are left to the database defaults.
+func (r *Resource) Values(body map[string]interface{}, partial bool) (map[string]interface{}, error) {
+	errs := validation.Errors{}
+
+	for name := range body {
+		f, ok := r.Field(name)
+		if !ok {
+			errs[name] = errUnknownField
+		} else if f.ReadOnly {
+			errs[name] = errReadOnly
+		}
+	}
+
+	values := make(map[string]interface{}, len(body))
+	for _, f := range r.Fields {
+		if f.ReadOnly {
+			continue
+		}
+
+		raw, present := body[f.Name]
+		if !present && partial {
+			continue
+		}
+
+		v, err := f.value(raw, present)
+		if err != nil {
+			errs[f.Name] = err
+			continue
+		}
+		if err := validation.Validate(v, f.rules()...); err != nil {
+			errs[f.Name] = err
+			continue
+		}
+
+		if present {
+			values[f.Name] = v
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return values, nil
+}
+
+func (f *Field) value(raw interface{}, present bool) (interface{}, error) {
+	if raw == nil {
+		if present && !f.Nullable {
+			return nil, errNotNull
+		}
+
+		return nil, nil
+	}
+
+	switch f.Type {
+	case query.TypeInt:
+		if n, ok := raw.(json.Number); ok {
+			if v, err := n.Int64(); err == nil {
+				return v, nil
+			}
+		}
+	case query.TypeFloat:
+		if n, ok := raw.(json.Number); ok {
+			if v, err := n.Float64(); err == nil {
+				return v, nil
+			}
+		}
+	case query.TypeBool:
+		if v, ok := raw.(bool); ok {
+			return v, nil
+		}
+	case query.TypeTime:
+		if s, ok := raw.(string); ok {
+			v, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return nil, errInvalidTime
+			}
+
+			return v, nil
+		}
+	default:
+		if v, ok := raw.(string); ok {
+			return v, nil
+		}
+	}
+
+	return nil, errInvalidType
+}
@@ -0,0 +1,85 @@
+// Package app runs the godmin api server. A module which administers its own tables runs it from its main package
+// with its resources, the godmin command runs it without any:
+//
+//	func main() {
+//		if err := app.Serve(admin.Resource{Table: "orders", Fields: fields}); err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+//
+// The operational commands, e.g. godmin migrate, work on the database of such a server as well.
+package app
+
+import (
+	"context"
+	"fmt"
+	"godmin/admin"
+	"godmin/config"
+	"godmin/internal/migrate"
+	"godmin/internal/server"
+	"godmin/internal/server/api"
+	"godmin/internal/tracing"
+	"godmin/migrations"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Serve runs the api server with the config of the environment until SIGINT or SIGTERM.
+// The resources get their routes under /admin/resources next to the ones of ADMIN_INTROSPECT_SCHEMA.
+func Serve(resources ...admin.Resource) error {
+	conf := config.NewConfig()
+	if err := tracing.Configure(conf.Tracing); err != nil {
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := tracing.Shutdown(ctx); err != nil {
+			log.Error(fmt.Errorf("tracing shutdown error: %w", err))
+		}
+	}()
+
+	connections, err := server.NewConnections(conf)
+	if err != nil {
+		return err
+	}
+	defer connections.Close()
+
+	if conf.MigrateOnStart {
+		migrator, err := migrate.New(connections.Db, migrations.FS)
+		if err != nil {
+			return err
+		}
+
+		applied, err := migrator.Up(context.Background(), 0)
+		if err != nil {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+		log.Infof("%d migrations applied", len(applied))
+	}
+
+	services, err := api.NewServices(connections, conf, resources...)
+	if err != nil {
+		return err
+	}
+
+	apiServer := api.NewApi(conf, services)
+	apiServer.Run()
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case x := <-sigc:
+		log.Info("received a signal.", x.String())
+	case err := <-apiServer.Notify():
+		log.Error("received an error from the api server.", "err", err)
+	}
+
+	return apiServer.Shutdown()
+}
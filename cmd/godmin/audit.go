@@ -0,0 +1,35 @@
+package main
+
+import (
+	"godmin/internal/model"
+	"os/user"
+	"strconv"
+)
+
+// newAuditEvent describes an action of an operator, the commands have no actor nor client address
+func newAuditEvent(action string, targetType string, targetID string) *model.AuditEvent {
+	operator := "unknown"
+	if u, err := user.Current(); err == nil {
+		operator = u.Username
+	}
+
+	return &model.AuditEvent{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		UserAgent:  model.AuditActorCLI + " (" + operator + ")",
+	}
+}
+
+// newUserAuditEvent describes an action on the user, changes are computed from the user before and after it
+func newUserAuditEvent(action string, before *model.User, after *model.User) *model.AuditEvent {
+	id := after
+	if id == nil {
+		id = before
+	}
+
+	e := newAuditEvent(action, model.AuditTargetUser, strconv.FormatUint(id.ID, 10))
+	e.Changes = model.NewAuditChanges(before.AuditFields(), after.AuditFields())
+
+	return e
+}
@@ -1,38 +1,126 @@
 package main
 
 import (
+	"fmt"
+	"godmin/app"
 	"godmin/config"
+	"godmin/internal/password"
 	"godmin/internal/server"
-	"godmin/internal/server/api"
+	"godmin/internal/server/service"
+	"godmin/internal/store"
+	"godmin/internal/store/memorystore"
+	"godmin/internal/store/sqlstore"
+	"io"
 	"os"
-	"os/signal"
-	"syscall"
 
 	log "github.com/sirupsen/logrus"
 )
 
+const usage = `usage: godmin [command]
+
+commands:
+  serve      run the api server, the default
+  migrate    apply or revert the database migrations
+  user       manage the users
+  token      revoke the tokens of a user
+  sessions   manage the sessions of all the users
+
+run godmin <command> -h for the command usage
+`
+
 func main() {
-	conf := config.NewConfig()
-	connections, err := server.NewConnections(conf)
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	var err error
+	switch command {
+	case "serve":
+		err = app.Serve()
+	case "migrate":
+		err = runMigrate(args)
+	case "user":
+		err = runUser(args)
+	case "token":
+		err = runToken(args)
+	case "sessions":
+		err = runSessions(args)
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer connections.Close()
+}
+
+// operation is what the operational commands work with, the tests build it on the teststore
+type operation struct {
+	sqlStore     store.Store
+	memoryStore  store.MemoryStore
+	passwords    *service.PasswordService
+	auditor      *service.Auditor
+	readPassword func() (string, error)
+	out          io.Writer
+}
+
+// connect opens the connections of the api server for the operational commands, close them when done
+func connect() (*operation, func(), error) {
+	conf := config.NewConfig()
 
-	apiServer := api.NewApi(conf, api.NewServices(connections, conf))
-	apiServer.Run()
+	conn, err := server.NewConnections(conf)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	sigc := make(chan os.Signal, 1)
-	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	// the passwords the commands set are hashed like the server does
+	hasher, err := password.New(conf.PasswordHash)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
 
-	select {
-	case x := <-sigc:
-		log.Info("received a signal.", x.String())
-	case err := <-apiServer.Notify():
-		log.Error("received an error from the api server.", "err", err)
+	sqlStore := sqlstore.New(conn.Db, hasher)
+	memoryStore := memorystore.New(conn.Redis)
+	passwords, err := newPasswordService(conf, hasher, sqlStore, memoryStore)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
 	}
 
-	if err := apiServer.Shutdown(); err != nil {
-		log.Error(err)
+	return &operation{
+		sqlStore:     sqlStore,
+		memoryStore:  memoryStore,
+		passwords:    passwords,
+		auditor:      service.NewAuditor(sqlStore),
+		readPassword: readPassword,
+		out:          os.Stdout,
+	}, conn.Close, nil
+}
+
+// newPasswordService applies the password policy of the server to the commands, they send no email
+func newPasswordService(
+	conf *config.Config,
+	hasher *password.Hasher,
+	sqlStore store.Store,
+	memoryStore store.MemoryStore,
+) (*service.PasswordService, error) {
+	policy, err := password.NewPolicy(conf.PasswordPolicy)
+	if err != nil {
+		return nil, err
 	}
+
+	return service.NewPasswordService(sqlStore, memoryStore, hasher, nil, conf.Password, policy, nil), nil
+}
+
+func invalidArguments(command string) error {
+	return fmt.Errorf("invalid arguments, see godmin %s -h", command)
+}
+
+func isHelp(args []string) bool {
+	return len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" || args[0] == "help"
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"godmin/config"
+	"godmin/internal/dto"
+	"godmin/internal/model"
+	"godmin/internal/password"
+	"godmin/internal/server/service"
+	"godmin/internal/store/teststore"
+	"testing"
+	"time"
+)
+
+const testPassword = "correct-horse-battery-staple"
+
+// setUp runs the commands on the teststore, the user has a session and the prompted password is testPassword
+func setUp(t *testing.T) (*operation, *bytes.Buffer, *model.User) {
+	conf := config.NewConfig()
+	// cheap password hashes, the tests hash a lot
+	conf.PasswordHash.Argon2Time = 1
+	conf.PasswordHash.Argon2Memory = 1024
+	conf.PasswordHash.Argon2Threads = 1
+
+	hasher, err := password.New(conf.PasswordHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sqlStore := teststore.New(time.Now, hasher)
+	memoryStore := teststore.NewMemoryStore(time.Now)
+	passwords, err := newPasswordService(conf, hasher, sqlStore, memoryStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	o := &operation{
+		sqlStore:    sqlStore,
+		memoryStore: memoryStore,
+		passwords:   passwords,
+		auditor:     service.NewAuditor(sqlStore),
+		readPassword: func() (string, error) {
+			return testPassword, nil
+		},
+		out: out,
+	}
+
+	u := model.TestUser(t)
+	if err := sqlStore.User().Create(context.Background(), u); err != nil {
+		t.Fatal(err)
+	}
+	startSession(t, o, u.ID, "1")
+
+	return o, out, u
+}
+
+// startSession stores a token family of the user like a login does
+func startSession(t *testing.T, o *operation, userID uint64, id string) {
+	token := &dto.Token{
+		AccessUuid:          "access-" + id,
+		RefreshUuid:         "refresh-" + id,
+		FamilyID:            "family-" + id,
+		AccessTokenExpires:  time.Now().Add(15 * time.Minute).Unix(),
+		RefreshTokenExpires: time.Now().Add(24 * time.Hour).Unix(),
+	}
+
+	client := &dto.Client{IP: "127.0.0.1"}
+	if err := o.memoryStore.Token().Create(context.Background(), userID, token, client); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sessions counts the token families of the user
+func sessions(t *testing.T, o *operation, userID uint64) int {
+	families, err := o.memoryStore.Token().FindUserFamilies(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return len(families)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"godmin/config"
+	"godmin/internal/migrate"
+	"godmin/internal/store/sqlstore"
+	"godmin/migrations"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = `usage: godmin migrate <command>
+
+commands:
+  up [N]                 apply all or N pending migrations
+  down [N]               revert the latest or N latest migrations
+  status                 list the migrations and the current version
+  force VERSION          set the version without running anything, e.g. after fixing a dirty database, -1 for none
+  create [-dir D] NAME   create empty up and down files in D, migrations by default
+`
+
+var errMigrateUsage = invalidArguments("migrate")
+
+func runMigrate(args []string) error {
+	if isHelp(args) {
+		fmt.Print(migrateUsage)
+		return nil
+	}
+
+	command, args := args[0], args[1:]
+	if command == "create" {
+		return migrateCreate(args)
+	}
+
+	conf := config.NewConfig()
+	db, err := sqlstore.NewDB(conf.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch command {
+	case "up":
+		n, err := optionalCount(args, 0)
+		if err != nil {
+			return err
+		}
+
+		applied, err := migrator.Up(ctx, n)
+		printMigrations("applied", applied)
+		if err == nil && len(applied) == 0 {
+			fmt.Println("no change")
+		}
+
+		return err
+	case "down":
+		n, err := optionalCount(args, 1)
+		if err != nil {
+			return err
+		}
+
+		reverted, err := migrator.Down(ctx, n)
+		printMigrations("reverted", reverted)
+
+		return err
+	case "force":
+		if len(args) != 1 {
+			return errMigrateUsage
+		}
+
+		version, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil || version < migrate.NoVersion {
+			return errMigrateUsage
+		}
+
+		return migrator.Force(ctx, version)
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		return printStatus(status)
+	default:
+		return errMigrateUsage
+	}
+}
+
+func migrateCreate(args []string) error {
+	flags := flag.NewFlagSet("create", flag.ContinueOnError)
+	dir := flags.String("dir", "migrations", "directory of the migrations")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errMigrateUsage
+	}
+
+	paths, err := migrate.Create(*dir, flags.Arg(0), time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, p := range paths {
+		fmt.Println(p)
+	}
+
+	return nil
+}
+
+func optionalCount(args []string, def int) (int, error) {
+	switch len(args) {
+	case 0:
+		return def, nil
+	case 1:
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return 0, errMigrateUsage
+		}
+
+		return n, nil
+	default:
+		return 0, errMigrateUsage
+	}
+}
+
+func printMigrations(action string, list []*migrate.Migration) {
+	for _, m := range list {
+		fmt.Printf("%s %d_%s\n", action, m.Version, m.Name)
+	}
+}
+
+func printStatus(s *migrate.Status) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	for _, m := range s.Migrations {
+		state := "pending"
+		if s.Applied(m) {
+			state = "applied"
+		}
+		if s.Dirty && m.Version == s.Version {
+			state = "dirty"
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\n", m.Version, m.Name, state)
+	}
+
+	return w.Flush()
+}
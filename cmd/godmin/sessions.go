@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"godmin/internal/model"
+)
+
+const sessionsUsage = `usage: godmin sessions flush
+
+revokes the sessions of all the users, everybody has to log in again
+`
+
+func runSessions(args []string) error {
+	if isHelp(args) {
+		fmt.Print(sessionsUsage)
+		return nil
+	}
+
+	o, closeConn, err := connect()
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+
+	return o.sessions(context.Background(), args)
+}
+
+func (o *operation) sessions(ctx context.Context, args []string) error {
+	if len(args) != 1 || args[0] != "flush" {
+		return invalidArguments("sessions")
+	}
+
+	revoked, err := o.memoryStore.Token().RevokeAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	e := newAuditEvent(model.AuditSessionsFlush, "", "")
+	e.Changes = map[string]*model.AuditChange{"revoked": {After: revoked}}
+	o.auditor.Record(ctx, e)
+	fmt.Fprintf(o.out, "%d sessions revoked\n", revoked)
+
+	return nil
+}
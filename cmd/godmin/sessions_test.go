@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOperation_Sessions(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		err      string
+		out      string
+		sessions int
+	}{
+		{
+			name:     "no command",
+			args:     []string{},
+			err:      invalidArguments("sessions").Error(),
+			sessions: 1,
+		},
+		{
+			name:     "extra argument",
+			args:     []string{"flush", "now"},
+			err:      invalidArguments("sessions").Error(),
+			sessions: 1,
+		},
+		{
+			name: "flush",
+			args: []string{"flush"},
+			out:  "2 sessions revoked\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o, out, u := setUp(t)
+			startSession(t, o, 42, "2")
+
+			err := o.sessions(context.Background(), tc.args)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.out, out.String())
+			assert.Equal(t, tc.sessions, sessions(t, o, u.ID))
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"godmin/internal/model"
+	"strconv"
+)
+
+const tokenUsage = `usage: godmin token revoke --user USER [--api-keys]
+
+revokes the sessions, the access and refresh tokens, of the user, with --api-keys their API keys too
+USER is the id or the email of the user
+`
+
+func runToken(args []string) error {
+	if isHelp(args) {
+		fmt.Print(tokenUsage)
+		return nil
+	}
+
+	o, closeConn, err := connect()
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+
+	return o.token(context.Background(), args)
+}
+
+func (o *operation) token(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "revoke" {
+		return invalidArguments("token")
+	}
+
+	flags := flag.NewFlagSet("revoke", flag.ContinueOnError)
+	user := flags.String("user", "", "id or email of the user")
+	apiKeys := flags.Bool("api-keys", false, "revoke the API keys too")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *user == "" || flags.NArg() != 0 {
+		return invalidArguments("token")
+	}
+
+	u, err := findUser(ctx, o.sqlStore, *user)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := o.memoryStore.Token().RevokeUserFamilies(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	o.auditor.Record(ctx, newRevokeAuditEvent(model.AuditSessionsRevoke, u.ID, int64(revoked)))
+	fmt.Fprintf(o.out, "%d sessions of user %d revoked\n", revoked, u.ID)
+
+	if *apiKeys {
+		revoked, err := o.sqlStore.ApiKey().RevokeByUser(ctx, u.ID)
+		if err != nil {
+			return err
+		}
+		o.auditor.Record(ctx, newRevokeAuditEvent(model.AuditApiKeysRevoke, u.ID, revoked))
+		fmt.Fprintf(o.out, "%d api keys of user %d revoked\n", revoked, u.ID)
+	}
+
+	return nil
+}
+
+// newRevokeAuditEvent tells how many sessions or keys of the user were revoked
+func newRevokeAuditEvent(action string, userID uint64, revoked int64) *model.AuditEvent {
+	e := newAuditEvent(action, model.AuditTargetUser, strconv.FormatUint(userID, 10))
+	e.Changes = map[string]*model.AuditChange{"revoked": {After: revoked}}
+
+	return e
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"godmin/internal/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOperation_Token(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		err      string
+		out      string
+		sessions int
+		apiKeys  int
+	}{
+		{
+			name:     "no command",
+			args:     []string{},
+			err:      invalidArguments("token").Error(),
+			sessions: 1,
+			apiKeys:  1,
+		},
+		{
+			name:     "unknown command",
+			args:     []string{"flush", "--user", "1"},
+			err:      invalidArguments("token").Error(),
+			sessions: 1,
+			apiKeys:  1,
+		},
+		{
+			name:     "without user",
+			args:     []string{"revoke", "--api-keys"},
+			err:      invalidArguments("token").Error(),
+			sessions: 1,
+			apiKeys:  1,
+		},
+		{
+			name:     "with extra argument",
+			args:     []string{"revoke", "--user", "1", "all"},
+			err:      invalidArguments("token").Error(),
+			sessions: 1,
+			apiKeys:  1,
+		},
+		{
+			name:     "unknown user",
+			args:     []string{"revoke", "--user", "2"},
+			err:      "user 2 not found",
+			sessions: 1,
+			apiKeys:  1,
+		},
+		{
+			name:    "sessions",
+			args:    []string{"revoke", "--user", "user@example.org"},
+			out:     "1 sessions of user 1 revoked\n",
+			apiKeys: 1,
+		},
+		{
+			name: "sessions and api keys",
+			args: []string{"revoke", "--user", "1", "--api-keys"},
+			out:  "1 sessions of user 1 revoked\n1 api keys of user 1 revoked\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o, out, u := setUp(t)
+			ctx := context.Background()
+			if err := o.sqlStore.ApiKey().Create(ctx, &model.ApiKey{UserID: u.ID, Name: "ci"}); err != nil {
+				t.Fatal(err)
+			}
+
+			err := o.token(ctx, tc.args)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.out, out.String())
+			assert.Equal(t, tc.sessions, sessions(t, o, u.ID))
+
+			keys, err := o.sqlStore.ApiKey().FindByUser(ctx, u.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Len(t, keys, tc.apiKeys)
+		})
+	}
+}
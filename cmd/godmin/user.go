@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"godmin/internal/model"
+	"godmin/internal/server/request"
+	"godmin/internal/store"
+	"godmin/internal/store/query"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const userUsage = `usage: godmin user <command>
+
+commands:
+  create -name NAME -email EMAIL [-role ROLE]   create a user, the password is prompted or read from stdin
+  list                                         list the users
+  disable USER                                 disable the user and revoke their sessions
+  enable USER                                  enable the disabled user
+  set-password USER                            set the password, prompted or read from stdin, and revoke the sessions
+  grant-role USER ROLE                         grant the role to the user, e.g. admin
+
+USER is the id or the email of the user
+`
+
+var (
+	errPasswordMismatch = errors.New("passwords don't match")
+	errPasswordRequired = errors.New("password is required")
+)
+
+func runUser(args []string) error {
+	if isHelp(args) {
+		fmt.Print(userUsage)
+		return nil
+	}
+
+	o, closeConn, err := connect()
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+
+	return o.user(context.Background(), args)
+}
+
+func (o *operation) user(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return invalidArguments("user")
+	}
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "create":
+		return o.userCreate(ctx, args)
+	case "list":
+		return o.userList(ctx)
+	case "disable", "enable":
+		if len(args) != 1 {
+			return invalidArguments("user")
+		}
+
+		return o.userSetDisabled(ctx, args[0], command == "disable")
+	case "set-password":
+		if len(args) != 1 {
+			return invalidArguments("user")
+		}
+
+		return o.userSetPassword(ctx, args[0])
+	case "grant-role":
+		if len(args) != 2 {
+			return invalidArguments("user")
+		}
+
+		return o.userGrantRole(ctx, args[0], args[1])
+	default:
+		return invalidArguments("user")
+	}
+}
+
+func (o *operation) userCreate(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("create", flag.ContinueOnError)
+	name := flags.String("name", "", "name of the user")
+	email := flags.String("email", "", "email of the user")
+	role := flags.String("role", "", "role granted to the user")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return invalidArguments("user")
+	}
+
+	password, err := o.readPassword()
+	if err != nil {
+		return err
+	}
+	if password == "" {
+		return errPasswordRequired
+	}
+
+	req := &request.UserCreate{Name: *name, Email: *email, Password: password}
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	// the operator vouches for the email of the users created here
+	now := time.Now()
+	u := &model.User{Name: req.Name, Email: req.Email, Password: req.Password, EmailVerifiedAt: &now}
+	if err := o.passwords.Check(ctx, u, req.Password); err != nil {
+		return err.GetError()
+	}
+	if err := o.sqlStore.User().Create(ctx, u); err != nil {
+		return err
+	}
+	o.auditor.Record(ctx, newUserAuditEvent(model.AuditUserCreate, nil, u))
+	fmt.Fprintf(o.out, "user %d created\n", u.ID)
+
+	if *role != "" {
+		return o.userGrantRole(ctx, strconv.FormatUint(u.ID, 10), *role)
+	}
+
+	return nil
+}
+
+func (o *operation) userList(ctx context.Context) error {
+	w := tabwriter.NewWriter(o.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tEMAIL\tSTATUS")
+
+	values := url.Values{"limit": {strconv.Itoa(query.MaxLimit)}}
+	for {
+		q, err := query.Parse(values, store.UserSchema)
+		if err != nil {
+			return err
+		}
+
+		users, page, err := o.sqlStore.User().List(ctx, q)
+		if err != nil {
+			return err
+		}
+
+		for _, u := range users {
+			status := "active"
+			if u.Disabled() {
+				status = "disabled"
+			}
+
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", u.ID, u.Name, u.Email, status)
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		values.Set("cursor", page.NextCursor)
+	}
+
+	return w.Flush()
+}
+
+func (o *operation) userSetDisabled(ctx context.Context, arg string, disabled bool) error {
+	u, err := findUser(ctx, o.sqlStore, arg)
+	if err != nil {
+		return err
+	}
+
+	if err := o.sqlStore.User().SetDisabled(ctx, u.ID, disabled); err != nil {
+		return err
+	}
+
+	updated, err := o.sqlStore.User().Find(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	o.auditor.Record(ctx, newUserAuditEvent(model.AuditUserUpdate, u, updated))
+
+	if !disabled {
+		fmt.Fprintf(o.out, "user %d enabled\n", u.ID)
+		return nil
+	}
+
+	revoked, err := o.memoryStore.Token().RevokeUserFamilies(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(o.out, "user %d disabled, %d sessions revoked\n", u.ID, revoked)
+
+	return nil
+}
+
+func (o *operation) userSetPassword(ctx context.Context, arg string) error {
+	u, err := findUser(ctx, o.sqlStore, arg)
+	if err != nil {
+		return err
+	}
+
+	password, err := o.readPassword()
+	if err != nil {
+		return err
+	}
+
+	req := &request.UserUpdate{Password: &password}
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	updated, changeErr := o.passwords.Change(ctx, u, *req.Password)
+	if changeErr != nil {
+		return changeErr.GetError()
+	}
+
+	e := newUserAuditEvent(model.AuditUserUpdate, u, updated)
+	e.Changes["password"] = &model.AuditChange{Before: model.AuditRedacted, After: model.AuditRedacted}
+	o.auditor.Record(ctx, e)
+
+	revoked, err := o.memoryStore.Token().RevokeUserFamilies(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(o.out, "password of user %d set, %d sessions revoked\n", u.ID, revoked)
+
+	return nil
+}
+
+func (o *operation) userGrantRole(ctx context.Context, arg string, role string) error {
+	u, err := findUser(ctx, o.sqlStore, arg)
+	if err != nil {
+		return err
+	}
+
+	if err := o.sqlStore.Role().Grant(ctx, u.ID, role); err != nil {
+		if err == store.ErrRecordNotFound {
+			return fmt.Errorf("role %s not found", role)
+		}
+
+		return err
+	}
+
+	e := newAuditEvent(model.AuditRoleGrant, model.AuditTargetUser, strconv.FormatUint(u.ID, 10))
+	e.Changes = map[string]*model.AuditChange{"role": {After: role}}
+	o.auditor.Record(ctx, e)
+	fmt.Fprintf(o.out, "role %s granted to user %d\n", role, u.ID)
+
+	return nil
+}
+
+// findUser finds the user by the id or the email
+func findUser(ctx context.Context, sqlStore store.Store, arg string) (*model.User, error) {
+	var u *model.User
+	var err error
+
+	if id, parseErr := strconv.ParseUint(arg, 10, 64); parseErr == nil {
+		u, err = sqlStore.User().Find(ctx, id)
+	} else {
+		u, err = sqlStore.User().FindByEmail(ctx, arg)
+	}
+	if err == store.ErrRecordNotFound {
+		return nil, fmt.Errorf("user %s not found", arg)
+	}
+
+	return u, err
+}
+
+// readPassword prompts for the password twice on a terminal, otherwise it reads the first line of stdin
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+
+	if !terminal.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprint(os.Stderr, "Repeat password: ")
+	repeated, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	if string(password) != string(repeated) {
+		return "", errPasswordMismatch
+	}
+
+	return string(password), nil
+}
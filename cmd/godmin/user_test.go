@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"godmin/internal/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOperation_User(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		password string
+		err      string
+		out      string
+		check    func(t *testing.T, o *operation, u *model.User)
+	}{
+		{
+			name: "no command",
+			args: []string{},
+			err:  invalidArguments("user").Error(),
+		},
+		{
+			name: "unknown command",
+			args: []string{"delete", "1"},
+			err:  invalidArguments("user").Error(),
+		},
+		{
+			name: "disable without user",
+			args: []string{"disable"},
+			err:  invalidArguments("user").Error(),
+		},
+		{
+			name: "enable with extra argument",
+			args: []string{"enable", "1", "2"},
+			err:  invalidArguments("user").Error(),
+		},
+		{
+			name: "grant-role without role",
+			args: []string{"grant-role", "1"},
+			err:  invalidArguments("user").Error(),
+		},
+		{
+			name: "create with extra argument",
+			args: []string{"create", "-name", "jane", "-email", "jane@example.org", "extra"},
+			err:  invalidArguments("user").Error(),
+		},
+		{
+			name: "create with unknown flag",
+			args: []string{"create", "-admin"},
+			err:  "flag provided but not defined: -admin",
+		},
+		{
+			name: "unknown user",
+			args: []string{"disable", "nobody@example.org"},
+			err:  "user nobody@example.org not found",
+		},
+		{
+			name: "disable revokes the sessions",
+			args: []string{"disable", "user@example.org"},
+			out:  "user 1 disabled, 1 sessions revoked\n",
+			check: func(t *testing.T, o *operation, u *model.User) {
+				updated, err := o.sqlStore.User().Find(context.Background(), u.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.True(t, updated.Disabled())
+				assert.Equal(t, 0, sessions(t, o, u.ID))
+			},
+		},
+		{
+			name: "enable keeps the sessions",
+			args: []string{"enable", "1"},
+			out:  "user 1 enabled\n",
+			check: func(t *testing.T, o *operation, u *model.User) {
+				assert.Equal(t, 1, sessions(t, o, u.ID))
+			},
+		},
+		{
+			name:     "set-password revokes the sessions",
+			args:     []string{"set-password", "1"},
+			password: testPassword,
+			out:      "password of user 1 set, 1 sessions revoked\n",
+			check: func(t *testing.T, o *operation, u *model.User) {
+				updated, err := o.sqlStore.User().Find(context.Background(), u.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.NotEqual(t, u.EncryptedPassword, updated.EncryptedPassword)
+				assert.Equal(t, 0, sessions(t, o, u.ID))
+			},
+		},
+		{
+			name:     "set-password checks the policy",
+			args:     []string{"set-password", "1"},
+			password: "short",
+			err:      "password: the length must be at least 10.",
+			check: func(t *testing.T, o *operation, u *model.User) {
+				assert.Equal(t, 1, sessions(t, o, u.ID))
+			},
+		},
+		{
+			name:     "create grants the role",
+			args:     []string{"create", "-name", "jane", "-email", "jane@example.org", "-role", model.RoleAdmin},
+			password: testPassword,
+			out:      "user 2 created\nrole admin granted to user 2\n",
+			check: func(t *testing.T, o *operation, u *model.User) {
+				roles, err := o.sqlStore.Role().FindNamesByUser(context.Background(), 2)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, []string{model.RoleAdmin}, roles)
+			},
+		},
+		{
+			name: "create requires a password",
+			args: []string{"create", "-name", "jane", "-email", "jane@example.org"},
+			err:  errPasswordRequired.Error(),
+		},
+		{
+			name: "grant-role of an unknown role",
+			args: []string{"grant-role", "1", "owner"},
+			err:  "role owner not found",
+		},
+		{
+			name: "list",
+			args: []string{"list"},
+			out:  "ID  NAME  EMAIL             STATUS\n1   user  user@example.org  active\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o, out, u := setUp(t)
+			o.readPassword = func() (string, error) {
+				return tc.password, nil
+			}
+
+			err := o.user(context.Background(), tc.args)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.out, out.String())
+
+			if tc.check != nil {
+				tc.check(t, o, u)
+			}
+		})
+	}
+}
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"github.com/kelseyhightower/envconfig"
 	log "github.com/sirupsen/logrus"
+	"strings"
 	"time"
 )
 
@@ -10,8 +12,23 @@ type Config struct {
 	Port     uint16 `envconfig:"PORT" default:"8080" required:"true"`
 	LogLevel string `envconfig:"LOG_LEVEL" default:"debug" required:"true"`
 	RedisUrl string `envconfig:"REDIS_URL" default:"localhost:6379" required:"true"`
-	Database *Database
-	Jwt      *Jwt
+	// MigrateOnStart applies the pending migrations before the api server starts
+	MigrateOnStart bool `envconfig:"MIGRATE_ON_START" default:"false"`
+	Database       *Database
+	Jwt            *Jwt
+	Mfa            *Mfa
+	Admin          *Admin
+	Mail           *Mail
+	Password       *Password
+	PasswordHash   *PasswordHash
+	PasswordPolicy *PasswordPolicy
+	Verification   *Verification
+	Throttle       *Throttle
+	MailThrottle   *MailThrottle
+	Metrics        *Metrics
+	Health         *Health
+	Tracing        *Tracing
+	Timeout        *Timeout
 }
 
 func NewConfig() *Config {
@@ -47,4 +64,167 @@ type Database struct {
 type Jwt struct {
 	AccessSecret  string `envconfig:"JWT_ACCESS_SECRET" default:"secret;)" required:"true"`
 	RefreshSecret string `envconfig:"JWT_REFRESH_SECRET" default:"secret;)" required:"true"`
+	// PEM private key (RSA, ECDSA or Ed25519) access tokens are signed with instead of JWT_ACCESS_SECRET
+	PrivateKeyPath string `envconfig:"JWT_PRIVATE_KEY_PATH"`
+	// PEM keys access tokens are still verified with, e.g. the previous private key while rotating
+	VerificationKeyPaths []string `envconfig:"JWT_VERIFICATION_KEY_PATHS"`
+	// AccessSecretUntil keeps verifying the tokens signed with JWT_ACCESS_SECRET until then (RFC 3339) once
+	// JWT_PRIVATE_KEY_PATH is set, so the switch to a private key doesn't log everybody out.
+	// Tokens signed with the shared secret are rejected after that time.
+	AccessSecretUntil time.Time `envconfig:"JWT_ACCESS_SECRET_UNTIL"`
+}
+
+type Mfa struct {
+	Issuer       string        `envconfig:"MFA_ISSUER" default:"godmin" required:"true"`
+	ChallengeTTL time.Duration `envconfig:"MFA_CHALLENGE_TTL" default:"5m" required:"true"`
+}
+
+type Admin struct {
+	// IntrospectSchema is the database schema whose tables are exposed as admin resources, none if empty
+	IntrospectSchema string `envconfig:"ADMIN_INTROSPECT_SCHEMA"`
+	// IntrospectTables limits the introspection to the tables, all of the schema if empty
+	IntrospectTables []string `envconfig:"ADMIN_INTROSPECT_TABLES"`
+}
+
+type Mail struct {
+	// Transport is smtp, or outbox to write the messages to OutboxDir instead of sending them
+	Transport    string `envconfig:"MAIL_TRANSPORT" default:"outbox" required:"true"`
+	From         string `envconfig:"MAIL_FROM" default:"godmin <noreply@localhost>" required:"true"`
+	SMTPHost     string `envconfig:"MAIL_SMTP_HOST" default:"localhost"`
+	SMTPPort     uint16 `envconfig:"MAIL_SMTP_PORT" default:"25"`
+	SMTPUsername string `envconfig:"MAIL_SMTP_USERNAME"`
+	SMTPPassword string `envconfig:"MAIL_SMTP_PASSWORD"`
+	OutboxDir    string `envconfig:"MAIL_OUTBOX_DIR" default:"var/outbox"`
+}
+
+type Password struct {
+	// ResetURL is the page of the front-end the reset links point to, the token is added as the token parameter
+	ResetURL string        `envconfig:"PASSWORD_RESET_URL" default:"http://localhost:8080/password/reset" required:"true"`
+	ResetTTL time.Duration `envconfig:"PASSWORD_RESET_TTL" default:"1h" required:"true"`
+}
+
+type Verification struct {
+	// Required makes the login refuse the users who haven't verified their email
+	Required bool `envconfig:"EMAIL_VERIFICATION_REQUIRED" default:"false"`
+	// Secret signs the verification links
+	Secret string `envconfig:"EMAIL_VERIFICATION_SECRET" default:"secret;)" required:"true"`
+	// URL is the page the verification links point to, the token is added as the token parameter
+	URL string        `envconfig:"EMAIL_VERIFICATION_URL" default:"http://localhost:8080/users/verify" required:"true"`
+	TTL time.Duration `envconfig:"EMAIL_VERIFICATION_TTL" default:"72h" required:"true"`
+	// ChangeURL is the page the links confirming a new email point to, they expire after TTL too
+	ChangeURL string `envconfig:"EMAIL_CHANGE_URL" default:"http://localhost:8080/users/email/confirm" required:"true"`
+}
+
+type Throttle struct {
+	// Window is how far back the failed logins are counted
+	Window time.Duration `envconfig:"LOGIN_THROTTLE_WINDOW" default:"15m" required:"true"`
+	// MaxPerIP failures from an address block its logins until the oldest of them leaves the window
+	MaxPerIP int `envconfig:"LOGIN_THROTTLE_MAX_PER_IP" default:"100" required:"true"`
+	// MaxPerEmail failures lock the account for LockoutDuration
+	MaxPerEmail     int           `envconfig:"LOGIN_THROTTLE_MAX_PER_EMAIL" default:"10" required:"true"`
+	LockoutDuration time.Duration `envconfig:"LOGIN_LOCKOUT_DURATION" default:"15m" required:"true"`
+	// FreeAttempts failures of an email are allowed before the back-off starts
+	FreeAttempts int `envconfig:"LOGIN_THROTTLE_FREE_ATTEMPTS" default:"3" required:"true"`
+	// BaseDelay is the wait after the first failure past FreeAttempts, it doubles with every failure up to MaxDelay
+	BaseDelay time.Duration `envconfig:"LOGIN_THROTTLE_BASE_DELAY" default:"1s" required:"true"`
+	MaxDelay  time.Duration `envconfig:"LOGIN_THROTTLE_MAX_DELAY" default:"1m" required:"true"`
+	// MaxMFAFailures failed MFA codes of a user in the window lock the account for LockoutDuration,
+	// whatever the number of challenges they were spread over
+	MaxMFAFailures int `envconfig:"LOGIN_THROTTLE_MAX_MFA_FAILURES" default:"5" required:"true"`
+}
+
+// MailThrottle limits the emails anybody can trigger without being logged in, like the reset links. The requests are
+// counted whether the email has an account or not.
+type MailThrottle struct {
+	// Window is how far back the requests are counted
+	Window time.Duration `envconfig:"MAIL_THROTTLE_WINDOW" default:"1h" required:"true"`
+	// MaxPerIP requests from an address in the window, whatever the email
+	MaxPerIP int `envconfig:"MAIL_THROTTLE_MAX_PER_IP" default:"20" required:"true"`
+	// MaxPerEmail requests for an email in the window, whatever the address
+	MaxPerEmail int `envconfig:"MAIL_THROTTLE_MAX_PER_EMAIL" default:"3" required:"true"`
+}
+
+type PasswordHash struct {
+	// Algorithm the new hashes are made with, argon2id or bcrypt. The hashes of the other one are still verified
+	// and upgraded on the next login, as are the hashes made with other parameters.
+	Algorithm string `envconfig:"PASSWORD_HASH_ALGORITHM" default:"argon2id" required:"true"`
+	// Argon2Time is the number of passes over the memory
+	Argon2Time uint32 `envconfig:"PASSWORD_ARGON2_TIME" default:"3" required:"true"`
+	// Argon2Memory is in KiB
+	Argon2Memory  uint32 `envconfig:"PASSWORD_ARGON2_MEMORY" default:"65536" required:"true"`
+	Argon2Threads uint8  `envconfig:"PASSWORD_ARGON2_THREADS" default:"4" required:"true"`
+	BcryptCost    int    `envconfig:"PASSWORD_BCRYPT_COST" default:"12" required:"true"`
+}
+
+type PasswordPolicy struct {
+	MinLength int `envconfig:"PASSWORD_MIN_LENGTH" default:"10" required:"true"`
+	// MinScore is the strength from 0 to 4 the passwords must reach, see password.Score
+	MinScore int `envconfig:"PASSWORD_MIN_SCORE" default:"2" required:"true"`
+	// ForbidPersonal refuses the passwords containing the email or the name of the user
+	ForbidPersonal bool `envconfig:"PASSWORD_FORBID_PERSONAL" default:"true"`
+	// HistorySize is the number of former passwords of a user which can't be chosen again, 0 to allow any
+	HistorySize int `envconfig:"PASSWORD_HISTORY_SIZE" default:"5"`
+	// BreachedFile lists the SHA-1 hashes of the breached passwords, see password.LoadBreached, none if empty
+	BreachedFile string `envconfig:"PASSWORD_BREACHED_FILE"`
+}
+
+type Metrics struct {
+	// Addr is the address of the listener serving /metrics, apart from the api so it isn't exposed with it,
+	// e.g. localhost:9090. The metrics aren't served if empty.
+	Addr string `envconfig:"METRICS_ADDR"`
+}
+
+type Health struct {
+	// CheckTimeout bounds each dependency check of the readiness probe
+	CheckTimeout time.Duration `envconfig:"HEALTH_CHECK_TIMEOUT" default:"2s" required:"true"`
+	// DrainDelay is how long the readiness probe fails before the server stops accepting connections on shutdown,
+	// so the load balancer stops sending traffic first
+	DrainDelay time.Duration `envconfig:"SHUTDOWN_DRAIN_DELAY" default:"5s"`
+}
+
+type Tracing struct {
+	// Exporter is none, stdout, file or otlp. The trace and span ids are logged even if the spans aren't exported.
+	Exporter    string `envconfig:"TRACING_EXPORTER" default:"none" required:"true"`
+	ServiceName string `envconfig:"TRACING_SERVICE_NAME" default:"godmin" required:"true"`
+	// File the file exporter appends the spans to, one JSON object per line
+	File string `envconfig:"TRACING_FILE" default:"var/traces.jsonl"`
+	// OTLPEndpoint is the OTLP/HTTP traces endpoint of the collector
+	OTLPEndpoint string `envconfig:"TRACING_OTLP_ENDPOINT" default:"http://localhost:4318/v1/traces"`
+	// OTLPHeaders are sent with every export, e.g. the credentials of a hosted collector, as key:value,key:value
+	OTLPHeaders map[string]string `envconfig:"TRACING_OTLP_HEADERS"`
+}
+
+type Timeout struct {
+	// Request bounds the handling of every request, 0 for none. The requests past it are answered with 504.
+	Request time.Duration `envconfig:"REQUEST_TIMEOUT" default:"30s"`
+	// Routes overrides Request for some routes, see RouteTimeouts
+	Routes RouteTimeouts `envconfig:"ROUTE_TIMEOUTS"`
+}
+
+// RouteTimeouts are the timeouts of the routes by "METHOD template" or by template for all the methods,
+// the templates are the ones of the metrics, e.g. GET /admin/users/{id:[0-9]+}=5s,/admin/resources=1m
+type RouteTimeouts map[string]time.Duration
+
+// Decode implements envconfig.Decoder, the templates may contain colons so the map syntax of envconfig can't be used
+func (rt *RouteTimeouts) Decode(value string) error {
+	timeouts := RouteTimeouts{}
+	for _, entry := range strings.Split(value, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		i := strings.LastIndex(entry, "=")
+		if i < 0 {
+			return fmt.Errorf("invalid route timeout %q, use route=duration", entry)
+		}
+
+		d, err := time.ParseDuration(strings.TrimSpace(entry[i+1:]))
+		if err != nil {
+			return fmt.Errorf("invalid route timeout %q: %w", entry, err)
+		}
+		timeouts[strings.TrimSpace(entry[:i])] = d
+	}
+	*rt = timeouts
+
+	return nil
 }
@@ -0,0 +1,11 @@
+package dto
+
+import "time"
+
+// LoginFailures are the failed logins of a throttling key within the sliding window
+type LoginFailures struct {
+	Count int
+	// Oldest and Latest are zero when there is no failure
+	Oldest time.Time
+	Latest time.Time
+}
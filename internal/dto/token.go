@@ -1,10 +1,32 @@
 package dto
 
+import "time"
+
 type Token struct {
 	AccessToken         string
 	RefreshToken        string
 	AccessUuid          string
 	RefreshUuid         string
+	FamilyID            string
 	AccessTokenExpires  int64
 	RefreshTokenExpires int64
 }
+
+// TokenFamily is a chain of rotated refresh tokens started by a single login, i.e. a user session.
+// Only the latest refresh token of the family is accepted.
+type TokenFamily struct {
+	ID          string
+	UserID      uint64
+	AccessUuid  string
+	RefreshUuid string
+	CreatedAt   time.Time
+	LastSeenAt  time.Time
+	IP          string
+	UserAgent   string
+}
+
+// Client describes where a session was started from
+type Client struct {
+	IP        string
+	UserAgent string
+}
@@ -0,0 +1,36 @@
+// Package mail sends the emails of the account flows, e.g. the password reset links.
+// SMTP delivers them for real, the outbox writes them to a directory for development and tests.
+package mail
+
+import (
+	"fmt"
+	"godmin/config"
+)
+
+const (
+	TransportSMTP   = "smtp"
+	TransportOutbox = "outbox"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(m *Message) error
+}
+
+// New constructs the mailer of the configured transport
+func New(conf *config.Mail) (Mailer, error) {
+	switch conf.Transport {
+	case TransportSMTP:
+		return NewSMTP(conf), nil
+	case TransportOutbox:
+		return NewOutbox(conf.OutboxDir, conf.From)
+	default:
+		return nil, fmt.Errorf("unknown mail transport %q, use %s or %s", conf.Transport, TransportSMTP, TransportOutbox)
+	}
+}
@@ -0,0 +1,92 @@
+package mail
+
+import (
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outbox writes every message to a .eml file of the directory instead of delivering it
+type Outbox struct {
+	mu   sync.Mutex
+	dir  string
+	from string
+	seq  int
+}
+
+// NewOutbox creates the directory if needed
+func NewOutbox(dir string, from string) (*Outbox, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &Outbox{dir: dir, from: from}, nil
+}
+
+func (o *Outbox) Send(m *Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	// the names sort in the sending order
+	o.seq++
+	name := fmt.Sprintf("%s-%04d.eml", time.Now().UTC().Format("20060102T150405.000000000"), o.seq)
+
+	return ioutil.WriteFile(filepath.Join(o.dir, name), format(o.from, m), 0600)
+}
+
+// Messages reads the messages back in the sending order
+func (o *Outbox) Messages() ([]*Message, error) {
+	paths, err := filepath.Glob(filepath.Join(o.dir, "*.eml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	messages := make([]*Message, 0, len(paths))
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+
+		m, err := readMessage(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+
+		messages = append(messages, m)
+	}
+
+	return messages, nil
+}
+
+func readMessage(f *os.File) (*Message, error) {
+	raw, err := mail.ReadMessage(f)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(raw.Header.Get("Subject"))
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(raw.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		To:      raw.Header.Get("To"),
+		Subject: subject,
+		Body:    strings.TrimRight(string(body), "\r\n"),
+	}, nil
+}
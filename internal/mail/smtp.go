@@ -0,0 +1,56 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"godmin/config"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTP delivers the messages through an SMTP relay, STARTTLS is used when the server offers it
+type SMTP struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func NewSMTP(conf *config.Mail) *SMTP {
+	s := &SMTP{
+		addr: net.JoinHostPort(conf.SMTPHost, strconv.Itoa(int(conf.SMTPPort))),
+		from: conf.From,
+	}
+	if conf.SMTPUsername != "" {
+		s.auth = smtp.PlainAuth("", conf.SMTPUsername, conf.SMTPPassword, conf.SMTPHost)
+	}
+
+	return s
+}
+
+func (s *SMTP) Send(m *Message) error {
+	from, err := mail.ParseAddress(s.from)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %w", s.from, err)
+	}
+
+	return smtp.SendMail(s.addr, s.auth, from.Address, []string{m.To}, format(s.from, m))
+}
+
+// format renders the message with its headers
+func format(from string, m *Message) []byte {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "From: %s\r\n", from)
+	fmt.Fprintf(b, "To: %s\r\n", m.To)
+	fmt.Fprintf(b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(m.Body)
+
+	return b.Bytes()
+}
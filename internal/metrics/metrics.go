@@ -0,0 +1,180 @@
+// Package metrics holds the Prometheus metrics of the server, served by Handler
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"sync"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DefaultRegistry holds the metrics of the server, the Go runtime and process ones included
+var DefaultRegistry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests are labelled by the route template rather than the path, so ids don't make new series
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "godmin_http_requests_total",
+		Help: "HTTP requests by method, route template and status.",
+	}, []string{"method", "route", "status"})
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "godmin_http_request_duration_seconds",
+		Help:    "HTTP request latencies by method, route template and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	Logins = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "godmin_auth_logins_total",
+		Help: "Logins which issued a token pair.",
+	})
+	// LoginFailures reasons are credentials, throttled, disabled and unverified
+	LoginFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "godmin_auth_login_failures_total",
+		Help: "Refused logins by reason.",
+	}, []string{"reason"})
+	// Refreshes results are success, invalid, reused and refused, for the deleted and disabled users
+	Refreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "godmin_auth_refreshes_total",
+		Help: "Refresh token exchanges by result.",
+	}, []string{"result"})
+	// Revocations reasons are logout, reuse and refused
+	Revocations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "godmin_auth_revocations_total",
+		Help: "Revoked tokens by reason.",
+	}, []string{"reason"})
+)
+
+func init() {
+	DefaultRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		Logins,
+		LoginFailures,
+		Refreshes,
+		Revocations,
+	)
+}
+
+// Handler serves the metrics of the DefaultRegistry in the format the scraper asks for
+func Handler() http.Handler {
+	return promhttp.HandlerFor(DefaultRegistry, promhttp.HandlerOpts{})
+}
+
+// RegisterDB exports the connection pool stats of the database. The metrics are registered once, a later call points
+// them at its pool, e.g. when the services are built again in the same process.
+func RegisterDB(db *sql.DB) {
+	pools.Lock()
+	pools.db = db
+	pools.Unlock()
+
+	registerDB.Do(func() {
+		DefaultRegistry.MustRegister(dbCollectors()...)
+	})
+}
+
+// dbCollectors read the stats of the latest pool at scrape time
+func dbCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		gaugeFunc("godmin_db_max_open_connections", "Maximum number of open connections to the database.", func() float64 {
+			return float64(dbStats().MaxOpenConnections)
+		}),
+		gaugeFunc("godmin_db_open_connections", "Established connections, in use and idle.", func() float64 {
+			return float64(dbStats().OpenConnections)
+		}),
+		gaugeFunc("godmin_db_in_use_connections", "Connections currently in use.", func() float64 {
+			return float64(dbStats().InUse)
+		}),
+		gaugeFunc("godmin_db_idle_connections", "Idle connections.", func() float64 {
+			return float64(dbStats().Idle)
+		}),
+		counterFunc("godmin_db_wait_count_total", "Connections waited for.", func() float64 {
+			return float64(dbStats().WaitCount)
+		}),
+		counterFunc("godmin_db_wait_duration_seconds_total", "Time blocked waiting for a connection.", func() float64 {
+			return dbStats().WaitDuration.Seconds()
+		}),
+		counterFunc("godmin_db_max_idle_closed_total", "Connections closed because of the idle limit.", func() float64 {
+			return float64(dbStats().MaxIdleClosed)
+		}),
+		counterFunc("godmin_db_max_idle_time_closed_total", "Connections closed because of the idle time.", func() float64 {
+			return float64(dbStats().MaxIdleTimeClosed)
+		}),
+		counterFunc("godmin_db_max_lifetime_closed_total", "Connections closed because of their lifetime.", func() float64 {
+			return float64(dbStats().MaxLifetimeClosed)
+		}),
+	}
+}
+
+// RegisterRedis exports the connection pool stats of the Redis client, like RegisterDB the latest one
+func RegisterRedis(client *redis.Client) {
+	pools.Lock()
+	pools.redis = client
+	pools.Unlock()
+
+	registerRedis.Do(func() {
+		DefaultRegistry.MustRegister(redisCollectors()...)
+	})
+}
+
+// redisCollectors read the stats of the latest client at scrape time
+func redisCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		counterFunc("godmin_redis_pool_hits_total", "Free connections found in the pool.", func() float64 {
+			return float64(redisStats().Hits)
+		}),
+		counterFunc("godmin_redis_pool_misses_total", "Free connections not found in the pool.", func() float64 {
+			return float64(redisStats().Misses)
+		}),
+		counterFunc("godmin_redis_pool_timeouts_total", "Timeouts waiting for a connection.", func() float64 {
+			return float64(redisStats().Timeouts)
+		}),
+		gaugeFunc("godmin_redis_pool_connections", "Connections in the pool.", func() float64 {
+			return float64(redisStats().TotalConns)
+		}),
+		gaugeFunc("godmin_redis_pool_idle_connections", "Idle connections in the pool.", func() float64 {
+			return float64(redisStats().IdleConns)
+		}),
+		counterFunc("godmin_redis_pool_stale_connections_total", "Stale connections removed from the pool.", func() float64 {
+			return float64(redisStats().StaleConns)
+		}),
+	}
+}
+
+// pools are the ones the metrics of RegisterDB and RegisterRedis read
+var pools struct {
+	sync.Mutex
+	db    *sql.DB
+	redis *redis.Client
+}
+
+var registerDB, registerRedis sync.Once
+
+func dbStats() sql.DBStats {
+	pools.Lock()
+	defer pools.Unlock()
+
+	return pools.db.Stats()
+}
+
+func redisStats() *redis.PoolStats {
+	pools.Lock()
+	defer pools.Unlock()
+
+	return pools.redis.PoolStats()
+}
+
+// gaugeFunc reads the value at scrape time
+func gaugeFunc(name string, help string, value func() float64) prometheus.GaugeFunc {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, value)
+}
+
+// counterFunc reads the value at scrape time, it must never decrease
+func counterFunc(name string, help string, value func() float64) prometheus.CounterFunc {
+	return prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help}, value)
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/go-redis/redis/v7"
+	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/stretchr/testify/assert"
+)
+
+// gathered returns the value of the metric without labels, nothing is connected to
+func gathered(t *testing.T, name string) float64 {
+	t.Helper()
+
+	families, err := DefaultRegistry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range families {
+		if f.GetName() == name {
+			if gauge := f.GetMetric()[0].GetGauge(); gauge != nil {
+				return gauge.GetValue()
+			}
+			return f.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	t.Fatalf("metric %s not gathered", name)
+
+	return 0
+}
+
+func TestRegisterDB(t *testing.T) {
+	for _, maxOpen := range []int{5, 10} {
+		db, err := sql.Open("pgx", "postgres://localhost/godmin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.SetMaxOpenConns(maxOpen)
+
+		// the services built again don't register the metrics again, they read the latest pool
+		assert.NotPanics(t, func() { RegisterDB(db) })
+		assert.Equal(t, float64(maxOpen), gathered(t, "godmin_db_max_open_connections"))
+		assert.NoError(t, db.Close())
+	}
+}
+
+func TestRegisterRedis(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+
+		assert.NotPanics(t, func() { RegisterRedis(client) })
+		assert.Equal(t, float64(0), gathered(t, "godmin_redis_pool_connections"))
+		assert.NoError(t, client.Close())
+	}
+}
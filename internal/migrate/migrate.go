@@ -0,0 +1,328 @@
+// Package migrate applies the SQL migrations.
+// The version is tracked in the schema_migrations table the same way golang-migrate does,
+// so databases migrated with the migrate/migrate container keep working.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// NoVersion is the version of a database without any migration applied
+const NoVersion int64 = -1
+
+// lockKey is the pg_advisory_lock key serializing the migrators of all the replicas, "godmin" in hex
+const lockKey int64 = 0x676f646d696e
+
+var fileRegexp = regexp.MustCompile(`^([0-9]+)_(.+)\.(up|down)\.sql$`)
+
+var nameRegexp = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// ErrDirty is returned when a previous migration failed halfway, the schema has to be fixed by hand and forced
+var ErrDirty = errors.New("database is dirty")
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status of the database
+type Status struct {
+	Version    int64
+	Dirty      bool
+	Migrations []*Migration
+}
+
+// Applied reports whether the migration is applied
+func (s *Status) Applied(m *Migration) bool {
+	return m.Version <= s.Version
+}
+
+// Migrator applies the migrations to the database
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []*Migration
+}
+
+// Load reads the migrations of the directory ordered by version
+func Load(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		match := fileRegexp.FindStringSubmatch(e.Name())
+		if e.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Name(), err)
+		}
+
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("version %d is used by %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Up applies the pending migrations, at most n of them if n is positive, and returns the applied ones
+func (mg *Migrator) Up(ctx context.Context, n int) ([]*Migration, error) {
+	applied := make([]*Migration, 0)
+
+	err := mg.locked(ctx, func(conn *sql.Conn) error {
+		version, err := mg.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range mg.migrations {
+			if m.Version <= version {
+				continue
+			}
+			if n > 0 && len(applied) == n {
+				break
+			}
+
+			if err := mg.run(ctx, conn, m.Up, m.Version); err != nil {
+				return fmt.Errorf("%d_%s: %w", m.Version, m.Name, err)
+			}
+			applied = append(applied, m)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts the n latest applied migrations and returns the reverted ones
+func (mg *Migrator) Down(ctx context.Context, n int) ([]*Migration, error) {
+	reverted := make([]*Migration, 0)
+
+	err := mg.locked(ctx, func(conn *sql.Conn) error {
+		version, err := mg.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(mg.migrations) - 1; i >= 0 && len(reverted) < n; i-- {
+			m := mg.migrations[i]
+			if m.Version > version {
+				continue
+			}
+
+			previous := NoVersion
+			if i > 0 {
+				previous = mg.migrations[i-1].Version
+			}
+
+			if err := mg.run(ctx, conn, m.Down, previous); err != nil {
+				return fmt.Errorf("%d_%s: %w", m.Version, m.Name, err)
+			}
+			reverted = append(reverted, m)
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Force sets the version and clears the dirty flag without running anything
+func (mg *Migrator) Force(ctx context.Context, version int64) error {
+	return mg.locked(ctx, func(conn *sql.Conn) error {
+		return setVersion(ctx, conn, version, false)
+	})
+}
+
+func (mg *Migrator) Status(ctx context.Context) (*Status, error) {
+	s := &Status{Migrations: mg.migrations}
+
+	err := mg.locked(ctx, func(conn *sql.Conn) error {
+		var err error
+		s.Version, s.Dirty, err = currentVersion(ctx, conn)
+
+		return err
+	})
+
+	return s, err
+}
+
+// locked runs f holding the advisory lock, other migrators wait until it is released
+func (mg *Migrator) locked(ctx context.Context, f func(conn *sql.Conn) error) error {
+	conn, err := mg.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// advisory locks belong to the session, so everything runs on the same connection
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+	}()
+
+	if _, err := conn.ExecContext(
+		ctx,
+		"CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)",
+	); err != nil {
+		return err
+	}
+
+	return f(conn)
+}
+
+// version returns the current version, it fails if the database is dirty
+func (mg *Migrator) version(ctx context.Context, conn *sql.Conn) (int64, error) {
+	version, dirty, err := currentVersion(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, fmt.Errorf("%w at version %d, fix it and force the version", ErrDirty, version)
+	}
+	if version == NoVersion {
+		return version, nil
+	}
+
+	for _, m := range mg.migrations {
+		if m.Version == version {
+			return version, nil
+		}
+	}
+
+	return 0, fmt.Errorf("database version %d is unknown to this binary", version)
+}
+
+// run executes the migration body, the database stays dirty if it fails
+func (mg *Migrator) run(ctx context.Context, conn *sql.Conn, body string, version int64) error {
+	if err := setVersion(ctx, conn, version, true); err != nil {
+		return err
+	}
+
+	// without arguments the statements are sent at once in an implicit transaction
+	if _, err := conn.ExecContext(ctx, body); err != nil {
+		return err
+	}
+
+	return setVersion(ctx, conn, version, false)
+}
+
+func currentVersion(ctx context.Context, conn *sql.Conn) (int64, bool, error) {
+	var version int64
+	var dirty bool
+
+	err := conn.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return NoVersion, false, nil
+	}
+
+	return version, dirty, err
+}
+
+func setVersion(ctx context.Context, conn *sql.Conn, version int64, dirty bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "TRUNCATE schema_migrations"); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	// a dirty database without a version still needs the row
+	if version != NoVersion || dirty {
+		if _, err := tx.ExecContext(
+			ctx,
+			"INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)",
+			version,
+			dirty,
+		); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Create writes empty up and down files of a new migration to the directory and returns their paths
+func Create(dir string, name string, now time.Time) ([]string, error) {
+	if !nameRegexp.MatchString(name) {
+		return nil, fmt.Errorf("migration name %q must match %s", name, nameRegexp)
+	}
+
+	base := filepath.Join(dir, now.UTC().Format("20060102150405")+"_"+name)
+	paths := []string{base + ".up.sql", base + ".down.sql"}
+
+	for _, p := range paths {
+		f, err := os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		if err := f.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	return paths, nil
+}
+
+// New constructs a Migrator of the migrations found in fsys
+func New(db *sqlx.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
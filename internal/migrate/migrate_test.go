@@ -0,0 +1,70 @@
+package migrate
+
+import (
+	"github.com/stretchr/testify/assert"
+	"godmin/migrations"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"2_second.up.sql":   {Data: []byte("UP 2")},
+		"2_second.down.sql": {Data: []byte("DOWN 2")},
+		"1_first.up.sql":    {Data: []byte("UP 1")},
+		"1_first.down.sql":  {Data: []byte("DOWN 1")},
+		"migrations.go":     {Data: []byte("package migrations")},
+	}
+
+	list, err := Load(fsys)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []*Migration{
+			{Version: 1, Name: "first", Up: "UP 1", Down: "DOWN 1"},
+			{Version: 2, Name: "second", Up: "UP 2", Down: "DOWN 2"},
+		}, list)
+	}
+
+	fsys["1_other.up.sql"] = &fstest.MapFile{}
+	_, err = Load(fsys)
+	assert.Error(t, err)
+}
+
+func TestLoad_Embedded(t *testing.T) {
+	list, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NotEmpty(t, list)
+	for _, m := range list {
+		assert.NotEmpty(t, m.Up, m.Name)
+		assert.NotEmpty(t, m.Down, m.Name)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2021, 3, 1, 12, 30, 0, 0, time.UTC)
+
+	paths, err := Create(dir, "create_orders_table", now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{
+			filepath.Join(dir, "20210301123000_create_orders_table.up.sql"),
+			filepath.Join(dir, "20210301123000_create_orders_table.down.sql"),
+		}, paths)
+
+		for _, p := range paths {
+			_, err := os.Stat(p)
+			assert.NoError(t, err)
+		}
+	}
+
+	_, err = Create(dir, "create_orders_table", now)
+	assert.Error(t, err, "files exist")
+
+	_, err = Create(dir, "Create Orders", now)
+	assert.Error(t, err)
+}
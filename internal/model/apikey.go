@@ -0,0 +1,57 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+)
+
+// ApiKeyPrefix marks personal access tokens, so they can be told apart from JWTs
+const ApiKeyPrefix = "gmn_"
+
+var apiKeyEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// ApiKey is a long-lived personal access token for machine clients
+type ApiKey struct {
+	ID         uint64
+	UserID     uint64
+	Name       string
+	Key        string
+	Prefix     string
+	KeyHash    string
+	Scopes     []string
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+	RevokedAt  *time.Time
+}
+
+// BeforeCreate generates the key, only its hash is stored
+func (k *ApiKey) BeforeCreate() error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+
+	k.Key = ApiKeyPrefix + strings.ToLower(apiKeyEncoding.EncodeToString(b))
+	k.Prefix = k.Key[:len(ApiKeyPrefix)+8]
+	k.KeyHash = HashSecret(k.Key)
+
+	return nil
+}
+
+// HasScope reports whether the key was granted the scope, a key without scopes is unrestricted
+func (k *ApiKey) HasScope(scope string) bool {
+	if len(k.Scopes) == 0 {
+		return true
+	}
+
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,98 @@
+package model
+
+import (
+	"reflect"
+	"time"
+)
+
+// the actions recorded in the audit log
+const (
+	AuditLogin       = "auth.login"
+	AuditLoginFailed = "auth.login_failed"
+	AuditLogout      = "auth.logout"
+	AuditUserCreate  = "user.create"
+	AuditUserUpdate  = "user.update"
+	AuditUserDelete  = "user.delete"
+	AuditUserUnlock  = "user.unlock"
+	AuditRoleGrant   = "role.grant"
+	AuditRoleRevoke  = "role.revoke"
+	// the sessions and API keys of a user, or the sessions of everybody, revoked by an operator
+	AuditSessionsRevoke = "sessions.revoke"
+	AuditApiKeysRevoke  = "api_keys.revoke"
+	AuditSessionsFlush  = "sessions.flush"
+)
+
+// the kinds of resources the audit events target
+const (
+	AuditTargetUser  = "user"
+	AuditTargetLogin = "login"
+)
+
+// AuditActorCLI is the User-Agent of the events recorded by the godmin commands, followed by the OS user.
+// Nobody is logged in, the events have no actor.
+const AuditActorCLI = "godmin-cli"
+
+// AuditRedacted stands for the values which must not be written to the audit log, e.g. passwords
+const AuditRedacted = "[redacted]"
+
+// AuditEvent records who did what to which resource
+type AuditEvent struct {
+	ID uint64
+	// ActorID is nil when nobody is logged in, e.g. on a failed login or a signup
+	ActorID    *uint64
+	Action     string
+	TargetType string
+	TargetID   string
+	// Changes maps the changed fields of the target to their values before and after the action
+	Changes   map[string]*AuditChange
+	IP        string
+	UserAgent string
+	RequestID string
+	CreatedAt time.Time
+}
+
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// NewAuditChanges returns the fields whose values differ, a field missing on one side is nil there
+func NewAuditChanges(before map[string]interface{}, after map[string]interface{}) map[string]*AuditChange {
+	changes := map[string]*AuditChange{}
+
+	for field, b := range before {
+		if a := after[field]; !reflect.DeepEqual(a, b) {
+			changes[field] = &AuditChange{Before: b, After: a}
+		}
+	}
+	for field, a := range after {
+		if _, ok := before[field]; !ok && a != nil {
+			changes[field] = &AuditChange{After: a}
+		}
+	}
+
+	return changes
+}
+
+// AuditFields are the fields of the user the audit log keeps track of, the password hash isn't one of them
+func (u *User) AuditFields() map[string]interface{} {
+	if u == nil {
+		return map[string]interface{}{}
+	}
+
+	return map[string]interface{}{
+		"name":              u.Name,
+		"email":             u.Email,
+		"disabled_at":       auditTime(u.DisabledAt),
+		"email_verified_at": auditTime(u.EmailVerifiedAt),
+	}
+}
+
+// auditTime formats the time so that equal instants compare equal whatever their location
+func auditTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+
+	return t.UTC().Format(time.RFC3339Nano)
+}
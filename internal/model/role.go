@@ -0,0 +1,20 @@
+package model
+
+const (
+	RoleAdmin = "admin"
+
+	PermissionUsersRead     = "users:read"
+	PermissionUsersWrite    = "users:write"
+	PermissionRolesRead     = "roles:read"
+	PermissionRolesWrite    = "roles:write"
+	PermissionSessionsWrite = "sessions:write"
+	PermissionAuditRead     = "audit:read"
+	PermissionResourcesRead = "resources:read"
+)
+
+type Role struct {
+	ID          uint64
+	Name        string
+	Description string
+	Permissions []string
+}
@@ -0,0 +1,14 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// HashSecret hashes a generated secret for lookups, like an API key, a reset token or a recovery code.
+// They carry at least 80 random bits so a plain SHA-256 is enough, no salt nor stretching is needed.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,36 @@
+package model
+
+// Table is a database table as described by the catalog
+type Table struct {
+	Name       string
+	Columns    []*TableColumn
+	PrimaryKey []string
+}
+
+// TableColumn is a column of the Table
+type TableColumn struct {
+	Name string
+	// Type is the udt_name, e.g. int8, varchar or the name of an enum type
+	Type       string
+	Nullable   bool
+	HasDefault bool
+	// Generated columns are filled by the database: serial, identity and generated columns
+	Generated bool
+	// MaxLength of a varchar or char column
+	MaxLength *int
+	// Enum holds the labels if the column is of an enum type
+	Enum []string
+	// References is "table.column" of a single column foreign key
+	References string
+}
+
+// Column returns the column by its name
+func (t *Table) Column(name string) (*TableColumn, bool) {
+	for _, c := range t.Columns {
+		if c.Name == name {
+			return c, true
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// TOTP is the user's authenticator app enrollment
+type TOTP struct {
+	UserID       uint64
+	Secret       string
+	ConfirmedAt  *time.Time
+	LastUsedStep int64
+}
+
+// Enabled reports whether the enrollment was confirmed with a valid code
+func (t *TOTP) Enabled() bool {
+	return t.ConfirmedAt != nil
+}
@@ -1,7 +1,8 @@
 package model
 
 import (
-	"golang.org/x/crypto/bcrypt"
+	"godmin/internal/password"
+	"time"
 )
 
 type User struct {
@@ -10,11 +11,24 @@ type User struct {
 	Email             string
 	Password          string
 	EncryptedPassword string
+	DisabledAt        *time.Time
+	EmailVerifiedAt   *time.Time
 }
 
-func (u *User) BeforeCreate() error {
+// Disabled users can't log in and their tokens and API keys are refused
+func (u *User) Disabled() bool {
+	return u.DisabledAt != nil
+}
+
+// EmailVerified tells the user followed the verification link sent to their current email
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// BeforeCreate hashes the password of the new user
+func (u *User) BeforeCreate(h *password.Hasher) error {
 	if len(u.Password) > 0 {
-		enc, err := encryptString(u.Password)
+		enc, err := h.Hash(u.Password)
 		if err != nil {
 			return err
 		}
@@ -24,15 +38,37 @@ func (u *User) BeforeCreate() error {
 	return nil
 }
 
-func (u *User) ComparePassword(password string) bool {
-	return bcrypt.CompareHashAndPassword([]byte(u.EncryptedPassword), []byte(password)) == nil
+// UserChanges is a partial update of the user, nil fields are left untouched
+type UserChanges struct {
+	Name              *string
+	Email             *string
+	Password          *string
+	EncryptedPassword *string
+	// KeepPasswords former password hashes of the user are kept in the history when the password changes, none if 0
+	KeepPasswords int
+	// EmailVerified marks the email verified in the same write, e.g. the new email a confirmation link was sent to
+	EmailVerified bool
 }
 
-func encryptString(s string) (string, error) {
-	b, err := bcrypt.GenerateFromPassword([]byte(s), bcrypt.MinCost)
-	if err != nil {
-		return "", err
+// BeforeUpdate hashes the new password
+func (c *UserChanges) BeforeUpdate(h *password.Hasher) error {
+	if c.Password != nil {
+		enc, err := h.Hash(*c.Password)
+		if err != nil {
+			return err
+		}
+
+		c.EncryptedPassword = &enc
 	}
+	return nil
+}
+
+func (u *User) ComparePassword(h *password.Hasher, p string) bool {
+	return h.Verify(p, u.EncryptedPassword)
+}
 
-	return string(b), nil
+// PasswordOutdated tells the password hash wasn't made with the algorithm and parameters of the hasher,
+// it is upgraded the next time the password is known, i.e. on login
+func (u *User) PasswordOutdated(h *password.Hasher) bool {
+	return h.NeedsRehash(u.EncryptedPassword)
 }
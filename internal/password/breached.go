@@ -0,0 +1,88 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// rangePrefixLength is the length of the hash prefixes the suffixes are grouped by, as in the k-anonymity range API
+const rangePrefixLength = 5
+
+// Breached holds the SHA-1 hashes of known breached passwords, grouped by their 5 first hex digits like the
+// range files of Have I Been Pwned. It is loaded from a local file, nothing about the passwords leaves the server.
+type Breached struct {
+	ranges map[string][]string
+	count  int
+}
+
+// LoadBreached reads a file of uppercase or lowercase hex SHA-1 hashes, one per line, optionally followed by
+// :<count> as in the Have I Been Pwned downloads. Empty lines and lines starting with # are skipped.
+func LoadBreached(path string) (*Breached, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b, err := readBreached(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return b, nil
+}
+
+func readBreached(r io.Reader) (*Breached, error) {
+	b := &Breached{ranges: map[string][]string{}}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		hash := strings.ToUpper(strings.SplitN(text, ":", 2)[0])
+		if len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("line %d: not a SHA-1 hash", line)
+		}
+		if _, err := hex.DecodeString(hash); err != nil {
+			return nil, fmt.Errorf("line %d: not a SHA-1 hash", line)
+		}
+
+		prefix := hash[:rangePrefixLength]
+		b.ranges[prefix] = append(b.ranges[prefix], hash[rangePrefixLength:])
+		b.count++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, suffixes := range b.ranges {
+		sort.Strings(suffixes)
+	}
+
+	return b, nil
+}
+
+// Contains tells the password is one of the breached ones
+func (b *Breached) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes := b.ranges[hash[:rangePrefixLength]]
+	i := sort.SearchStrings(suffixes, hash[rangePrefixLength:])
+
+	return i < len(suffixes) && suffixes[i] == hash[rangePrefixLength:]
+}
+
+// Len returns the number of hashes
+func (b *Breached) Len() int {
+	return b.count
+}
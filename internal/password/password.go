@@ -0,0 +1,89 @@
+// Package password hashes the user passwords into PHC strings, e.g. $argon2id$v=19$m=65536,t=3,p=2$salt$hash.
+// The string carries the algorithm and its parameters, so hashes made with older settings are still verified
+// and can be told apart to be upgraded.
+package password
+
+import (
+	"errors"
+	"fmt"
+	"godmin/config"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+var errUnknownHash = errors.New("unknown password hash format")
+
+// Scheme hashes and verifies the passwords of one algorithm
+type Scheme interface {
+	// Hash encodes the password with a new random salt
+	Hash(password string) (string, error)
+	// Identifies tells the encoded hash was made with the algorithm of the scheme
+	Identifies(encoded string) bool
+	// Verify compares the password with an encoded hash of the algorithm, whatever its parameters
+	Verify(password string, encoded string) (bool, error)
+	// Current tells the encoded hash was made with the parameters of the scheme
+	Current(encoded string) bool
+}
+
+// Hasher hashes with the configured scheme and verifies the hashes of every known scheme
+type Hasher struct {
+	current Scheme
+	schemes []Scheme
+}
+
+// New builds the hasher of the configured algorithm
+func New(conf *config.PasswordHash) (*Hasher, error) {
+	argon2id := &Argon2id{
+		Time:    conf.Argon2Time,
+		Memory:  conf.Argon2Memory,
+		Threads: conf.Argon2Threads,
+	}
+	bcrypt := &Bcrypt{Cost: conf.BcryptCost}
+
+	h := &Hasher{schemes: []Scheme{argon2id, bcrypt}}
+	switch conf.Algorithm {
+	case AlgorithmArgon2id:
+		h.current = argon2id
+	case AlgorithmBcrypt:
+		h.current = bcrypt
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q, use %s or %s", conf.Algorithm, AlgorithmArgon2id, AlgorithmBcrypt)
+	}
+
+	return h, nil
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+// Verify compares the password with the hash, false for hashes of no known scheme
+func (h *Hasher) Verify(password string, encoded string) bool {
+	for _, s := range h.schemes {
+		if s.Identifies(encoded) {
+			ok, err := s.Verify(password, encoded)
+			return err == nil && ok
+		}
+	}
+
+	return false
+}
+
+// NeedsRehash tells the hash wasn't made with the configured algorithm and parameters
+func (h *Hasher) NeedsRehash(encoded string) bool {
+	return !h.current.Identifies(encoded) || !h.current.Current(encoded)
+}
+
+// DefaultConfig is argon2id with the parameters recommended by RFC 9106 for constrained memory
+func DefaultConfig() *config.PasswordHash {
+	return &config.PasswordHash{
+		Algorithm:     AlgorithmArgon2id,
+		Argon2Time:    3,
+		Argon2Memory:  64 * 1024,
+		Argon2Threads: 4,
+		BcryptCost:    12,
+	}
+}
@@ -0,0 +1,107 @@
+package password
+
+import (
+	"godmin/config"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testConfig(algorithm string) *Hasher {
+	conf := DefaultConfig()
+	conf.Algorithm = algorithm
+	conf.Argon2Time = 1
+	conf.Argon2Memory = 1024
+	conf.Argon2Threads = 1
+	conf.BcryptCost = bcrypt.MinCost + 1
+
+	return mustNew(conf)
+}
+
+func TestHasher_HashVerify(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmArgon2id, AlgorithmBcrypt} {
+		t.Run(algorithm, func(t *testing.T) {
+			h := testConfig(algorithm)
+
+			encoded, err := h.Hash("password")
+			assert.NoError(t, err)
+			assert.True(t, h.Verify("password", encoded))
+			assert.False(t, h.Verify("Password", encoded))
+			assert.False(t, h.NeedsRehash(encoded))
+
+			// a new salt every time
+			other, _ := h.Hash("password")
+			assert.NotEqual(t, encoded, other)
+		})
+	}
+}
+
+func TestHasher_Argon2idFormat(t *testing.T) {
+	encoded, err := testConfig(AlgorithmArgon2id).Hash("password")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$"), encoded)
+
+	// 16 bytes of salt and 32 of hash in unpadded base64
+	parts := strings.Split(encoded, "$")
+	assert.Len(t, parts, 6)
+	assert.Len(t, parts[4], 22)
+	assert.Len(t, parts[5], 43)
+}
+
+func TestHasher_NeedsRehash(t *testing.T) {
+	argon2id := testConfig(AlgorithmArgon2id)
+	bcryptHasher := testConfig(AlgorithmBcrypt)
+
+	bcryptHash, _ := bcryptHasher.Hash("password")
+	argon2idHash, _ := argon2id.Hash("password")
+
+	// the hashes of the other algorithm are verified and upgraded
+	assert.True(t, argon2id.Verify("password", bcryptHash))
+	assert.True(t, argon2id.NeedsRehash(bcryptHash))
+	assert.True(t, bcryptHasher.Verify("password", argon2idHash))
+	assert.True(t, bcryptHasher.NeedsRehash(argon2idHash))
+
+	// so are the hashes made with other parameters
+	minCost, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	assert.True(t, bcryptHasher.Verify("password", string(minCost)))
+	assert.True(t, bcryptHasher.NeedsRehash(string(minCost)))
+
+	conf := DefaultConfig()
+	conf.Argon2Time = 2
+	conf.Argon2Memory = 1024
+	conf.Argon2Threads = 1
+	stronger := mustNew(conf)
+	assert.True(t, stronger.Verify("password", argon2idHash))
+	assert.True(t, stronger.NeedsRehash(argon2idHash))
+}
+
+func TestHasher_Invalid(t *testing.T) {
+	h := testConfig(AlgorithmArgon2id)
+
+	for _, encoded := range []string{
+		"",
+		"password",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA",
+		"$argon2id$v=16$m=1024,t=1,p=1$c2FsdHNhbHQ$aGFzaA",
+		"$argon2id$v=19$m=x,t=1,p=1$c2FsdHNhbHQ$aGFzaA",
+		"$argon2id$v=19$m=1024,t=1,p=1$!$aGFzaA",
+		"$2a$04$invalid",
+	} {
+		assert.False(t, h.Verify("password", encoded), encoded)
+		assert.True(t, h.NeedsRehash(encoded), encoded)
+	}
+
+	_, err := New(&config.PasswordHash{Algorithm: "md5"})
+	assert.Error(t, err)
+}
+
+func mustNew(conf *config.PasswordHash) *Hasher {
+	h, err := New(conf)
+	if err != nil {
+		panic(err)
+	}
+
+	return h
+}
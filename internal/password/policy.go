@@ -0,0 +1,90 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"godmin/config"
+	"strings"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MaxLength bounds the work of the hashing and the strength estimation
+const MaxLength = 100
+
+var (
+	errTooLong  = fmt.Errorf("the length must be no more than %d", MaxLength)
+	errPersonal = errors.New("must not contain your email or name")
+	errWeak     = errors.New("is too easy to guess, make it longer or less predictable")
+	errBreached = errors.New("appears in a data breach, choose another one")
+	// ErrReused is returned for the passwords found in the history of the user
+	ErrReused = errors.New("must differ from your previous passwords")
+)
+
+// Policy decides which passwords users may choose
+type Policy struct {
+	config   *config.PasswordPolicy
+	breached *Breached
+}
+
+// NewPolicy loads the breached password hashes, if a file is configured
+func NewPolicy(conf *config.PasswordPolicy) (*Policy, error) {
+	p := &Policy{config: conf}
+
+	if conf.BreachedFile != "" {
+		breached, err := LoadBreached(conf.BreachedFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't load the breached passwords: %w", err)
+		}
+
+		log.Infof("%d breached password hashes loaded", breached.Len())
+		p.breached = breached
+	}
+
+	return p, nil
+}
+
+// Check returns why the password is refused, nil if it is acceptable.
+// personal is what the password must not be made of, e.g. the email and the name of the user.
+func (p *Policy) Check(password string, personal ...string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.config.MinLength {
+		return fmt.Errorf("the length must be at least %d", p.config.MinLength)
+	}
+	if length > MaxLength {
+		return errTooLong
+	}
+
+	if p.config.ForbidPersonal && containsPersonal(password, personal) {
+		return errPersonal
+	}
+
+	if Score(password, personal...) < p.config.MinScore {
+		return errWeak
+	}
+
+	if p.breached != nil && p.breached.Contains(password) {
+		return errBreached
+	}
+
+	return nil
+}
+
+// HistorySize is the number of former passwords of a user which can't be chosen again
+func (p *Policy) HistorySize() int {
+	return p.config.HistorySize
+}
+
+// containsPersonal tells the password contains the email, its local part or a part of the name
+func containsPersonal(password string, personal []string) bool {
+	password = strings.ToLower(password)
+
+	for word := range personalWords(personal) {
+		if strings.Contains(password, word) {
+			return true
+		}
+	}
+
+	return false
+}
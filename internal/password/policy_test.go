@@ -0,0 +1,84 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"godmin/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func TestScore(t *testing.T) {
+	testCases := []struct {
+		password string
+		max      int
+		min      int
+	}{
+		{password: "password", max: 0},
+		{password: "P@ssw0rd2020", max: 0},
+		{password: "qwertyuiop", max: 0},
+		{password: "abcdefghij1", max: 0},
+		{password: "aaaaaaaaaaaa", max: 0},
+		{password: "correct horse battery staple", min: 4, max: 4},
+		{password: "xK9#mQ2$vL", min: 4, max: 4},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.password, func(t *testing.T) {
+			score := Score(tc.password)
+			assert.GreaterOrEqual(t, score, tc.min)
+			assert.LessOrEqual(t, score, tc.max)
+		})
+	}
+
+	// personal words are as easy to guess as the dictionary ones
+	assert.Less(t, Score("Meriwether1999", "meriwether@example.org"), Score("Meriwether1999"))
+}
+
+func TestPolicy_Check(t *testing.T) {
+	p, err := NewPolicy(&config.PasswordPolicy{MinLength: 10, MinScore: 2, ForbidPersonal: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Error(t, p.Check("xK9#mQ2"))
+	assert.Equal(t, errTooLong, p.Check(strings.Repeat("xK9#mQ2$vL", 11)))
+	assert.Equal(t, errWeak, p.Check("password1234"))
+	assert.Equal(t, errPersonal, p.Check("xK9#jdoe$vL", "jdoe@example.org", "John Doe"))
+	assert.Equal(t, errPersonal, p.Check("xK9#John$vL", "jdoe@example.org", "John Doe"))
+	assert.NoError(t, p.Check("xK9#mQ2$vL", "jdoe@example.org", "John Doe"))
+
+	// the domain of the email is not personal
+	assert.NoError(t, p.Check("example.org xK9#mQ2$vL", "jdoe@example.org"))
+}
+
+func TestPolicy_Breached(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "breached.txt")
+	content := "# a comment\n\n" + sha1Hex("xK9#mQ2$vL") + ":42\n" + strings.ToLower(sha1Hex("another one")) + "\n"
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewPolicy(&config.PasswordPolicy{MinLength: 10, BreachedFile: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 2, p.breached.Len())
+	assert.True(t, p.breached.Contains("another one"))
+	assert.Equal(t, errBreached, p.Check("xK9#mQ2$vL"))
+	assert.NoError(t, p.Check("xK9#mQ2$vM"))
+
+	_, err = readBreached(strings.NewReader("not a hash\n"))
+	assert.Error(t, err)
+}
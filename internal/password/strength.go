@@ -0,0 +1,210 @@
+package password
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// common lists the most used passwords and words, the most used first
+//
+//go:embed common.txt
+var common string
+
+// commonRanks maps the common passwords to their rank, which estimates the guesses they need
+var commonRanks = func() map[string]int {
+	ranks := map[string]int{}
+	for i, word := range strings.Fields(common) {
+		ranks[word] = i + 1
+	}
+
+	return ranks
+}()
+
+// keyboardRows are the qwerty rows, walks along them are easy to guess
+var keyboardRows = []string{"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./"}
+
+// unleet undoes the usual substitutions, p4ssw0rd is as common as password
+var unleet = strings.NewReplacer("4", "a", "@", "a", "3", "e", "1", "i", "!", "i", "0", "o", "$", "s", "5", "s", "7", "t")
+
+const minPatternLength = 3
+
+// Score rates from 0 to 4 how hard the password is to guess, like zxcvbn does:
+// 0 needs less than 10^3 guesses, 1 less than 10^6, 2 less than 10^8, 3 less than 10^10 and 4 more
+func Score(password string, personal ...string) int {
+	guesses := Guesses(password, personal...)
+
+	for score, threshold := range []float64{1e3, 1e6, 1e8, 1e10} {
+		if guesses < threshold {
+			return score
+		}
+	}
+
+	return 4
+}
+
+// Guesses estimates how many guesses an attacker needs. The password is split into the common passwords,
+// the personal strings, repeats, sequences, keyboard walks and years which give the fewest guesses,
+// the other characters are guessed one by one.
+func Guesses(password string, personal ...string) float64 {
+	runes := []rune(password)
+	words := personalWords(personal)
+
+	// best[i] is the fewest guesses of the first i runes
+	best := make([]float64, len(runes)+1)
+	best[0] = 1
+	for end := 1; end <= len(runes); end++ {
+		best[end] = best[end-1] * cardinality(runes[end-1])
+
+		for start := 0; start <= end-minPatternLength; start++ {
+			if g := patternGuesses(runes[start:end], words); g > 0 {
+				best[end] = math.Min(best[end], best[start]*g)
+			}
+		}
+	}
+
+	return best[len(runes)]
+}
+
+// patternGuesses returns the guesses of the runes as a single pattern, 0 if they make none
+func patternGuesses(runes []rune, personal map[string]bool) float64 {
+	s := string(runes)
+	lower := strings.ToLower(s)
+
+	guesses := math.Inf(1)
+
+	if personal[lower] || personal[unleet.Replace(lower)] {
+		guesses = 1
+	}
+	if rank, ok := commonRanks[lower]; ok {
+		guesses = math.Min(guesses, float64(rank))
+	}
+	if rank, ok := commonRanks[unleet.Replace(lower)]; ok {
+		guesses = math.Min(guesses, float64(rank)*2)
+	}
+	if !math.IsInf(guesses, 1) {
+		return guesses * caseVariations(s)
+	}
+
+	switch {
+	case isRepeat(runes):
+		return cardinality(runes[0]) * float64(len(runes))
+	case isSequence(runes):
+		return 4 * float64(len(runes))
+	case isKeyboardWalk(lower):
+		return 10 * float64(len(runes))
+	case isYear(s):
+		return 120
+	}
+
+	return 0
+}
+
+// caseVariations counts the usual capitalizations, all lower, all upper or the first letter upper
+func caseVariations(s string) float64 {
+	if s == strings.ToLower(s) {
+		return 1
+	}
+	rest := string([]rune(s)[1:])
+	if s == strings.ToUpper(s) || rest == strings.ToLower(rest) {
+		return 2
+	}
+
+	return 4
+}
+
+func isRepeat(runes []rune) bool {
+	for _, r := range runes[1:] {
+		if r != runes[0] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isSequence tells the runes go up or down one by one, e.g. abc or 9876
+func isSequence(runes []rune) bool {
+	step := runes[1] - runes[0]
+	if step != 1 && step != -1 {
+		return false
+	}
+
+	for i := 2; i < len(runes); i++ {
+		if runes[i]-runes[i-1] != step {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isKeyboardWalk tells the characters are next to each other on a keyboard row, either way
+func isKeyboardWalk(s string) bool {
+	for _, row := range keyboardRows {
+		if strings.Contains(row, s) || strings.Contains(reverse(row), s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isYear(s string) bool {
+	return len(s) == 4 && (strings.HasPrefix(s, "19") || strings.HasPrefix(s, "20")) &&
+		strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) }) == -1
+}
+
+// cardinality is the number of characters of the class of the rune
+func cardinality(r rune) float64 {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		return 26
+	case r >= '0' && r <= '9':
+		return 10
+	case r < unicode.MaxASCII:
+		return 33
+	default:
+		return 100
+	}
+}
+
+// personalWords splits the user's data into the words a password may be made of, e.g. the parts of an email
+func personalWords(personal []string) map[string]bool {
+	words := map[string]bool{}
+	add := func(w string) {
+		if utf8.RuneCountInString(w) >= minPatternLength {
+			words[w] = true
+		}
+	}
+
+	for _, p := range personal {
+		p = strings.ToLower(p)
+		add(p)
+
+		// the domain of an email is shared with many others
+		if at := strings.LastIndex(p, "@"); at >= 0 {
+			p = p[:at]
+			add(p)
+		}
+
+		for _, w := range strings.FieldsFunc(p, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			add(w)
+		}
+	}
+
+	return words
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+
+	return string(runes)
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	log "github.com/sirupsen/logrus"
 	"godmin/config"
+	"godmin/internal/metrics"
 	"godmin/internal/server/router"
+	"godmin/internal/server/service"
+	"net"
 	"net/http"
 	"strconv"
 	"time"
@@ -12,18 +15,42 @@ import (
 
 type Api struct {
 	server *http.Server
-	errors chan error
+	health *service.HealthService
+	// drainDelay is how long the readiness fails before the server stops accepting connections
+	drainDelay time.Duration
+	// metricsServer is nil when the metrics aren't served
+	metricsServer *http.Server
+	// cancelRequests cancels the contexts of the requests still in flight when the shutdown times out
+	cancelRequests context.CancelFunc
+	errors         chan error
 }
 
 func (a *Api) Run() {
 	go func() {
 		log.Info("run api server")
 		a.errors <- a.server.ListenAndServe()
-		close(a.errors)
 	}()
+
+	if a.metricsServer != nil {
+		go func() {
+			log.Infof("run metrics server on %s", a.metricsServer.Addr)
+			a.errors <- a.metricsServer.ListenAndServe()
+		}()
+	}
 }
 
+// Shutdown fails the readiness probe, waits for the drain delay so the load balancer stops sending traffic,
+// then stops the servers once the requests in flight are answered.
+// The requests still in flight after 5 seconds are cancelled, they are answered with 503.
 func (a *Api) Shutdown() error {
+	defer a.cancelRequests()
+
+	a.health.Drain()
+	if a.drainDelay > 0 {
+		log.Infof("draining for %v", a.drainDelay)
+		time.Sleep(a.drainDelay)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -34,6 +61,14 @@ func (a *Api) Shutdown() error {
 
 	log.Info("api server stopped")
 
+	if a.metricsServer != nil {
+		if err := a.metricsServer.Shutdown(ctx); err != nil {
+			return err
+		}
+
+		log.Info("metrics server stopped")
+	}
+
 	return nil
 }
 
@@ -44,11 +79,29 @@ func (a *Api) Notify() <-chan error {
 }
 
 func NewApi(config *config.Config, services *Services) *Api {
-	return &Api{
+	baseCtx, cancel := context.WithCancel(context.Background())
+	a := &Api{
 		server: &http.Server{
 			Addr:    ":" + strconv.Itoa(int(config.Port)),
-			Handler: router.NewRouter(services),
+			Handler: router.NewRouter(services, config.Timeout, config.Tracing.ServiceName),
+			BaseContext: func(net.Listener) context.Context {
+				return baseCtx
+			},
 		},
-		errors: make(chan error, 1),
+		health:         services.Health(),
+		drainDelay:     config.Health.DrainDelay,
+		cancelRequests: cancel,
+		errors:         make(chan error, 2),
 	}
+
+	if config.Metrics.Addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		a.metricsServer = &http.Server{
+			Addr:    config.Metrics.Addr,
+			Handler: mux,
+		}
+	}
+
+	return a
 }
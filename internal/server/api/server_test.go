@@ -2,18 +2,42 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	log "github.com/sirupsen/logrus"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+	"godmin/admin"
 	"godmin/config"
+	"godmin/internal/dto"
+	"godmin/internal/mail"
+	"godmin/internal/metrics"
 	"godmin/internal/model"
-	"godmin/internal/server"
+	"godmin/internal/password"
 	"godmin/internal/server/request"
 	"godmin/internal/server/response"
+	"godmin/internal/store"
+	"godmin/internal/store/query"
+	"godmin/internal/store/teststore"
+	"godmin/internal/totp"
+	"golang.org/x/crypto/bcrypt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 )
 
 func TestMain(m *testing.M) {
@@ -21,29 +45,82 @@ func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
 
-func TestServer_Login(t *testing.T) {
-	conf := config.NewConfig()
+// setUp builds the api on the in-process stores and creates a user, nothing has to run locally
+func setUp(t *testing.T) (*Api, *Services, *model.User) {
+	return setUpWithConfig(t, config.NewConfig())
+}
 
-	conn, err := server.NewConnections(conf)
+// setUpWithConfig is setUp with a tweaked config and the resources to administer, the emails go to an outbox of its own
+func setUpWithConfig(t *testing.T, conf *config.Config, resources ...admin.Resource) (*Api, *Services, *model.User) {
+	// cheap password hashes, the tests hash a lot
+	conf.PasswordHash.Argon2Time = 1
+	conf.PasswordHash.Argon2Memory = 1024
+	conf.PasswordHash.Argon2Threads = 1
+	conf.Mail.Transport = mail.TransportOutbox
+	conf.Mail.OutboxDir = t.TempDir()
+
+	hasher, err := password.New(conf.PasswordHash)
 	if err != nil {
-		log.Fatal(err)
+		t.Fatal(err)
 	}
 
-	services := NewServices(conn, conf)
+	services, err := NewServicesWithStores(
+		teststore.New(time.Now, hasher),
+		teststore.NewMemoryStore(time.Now),
+		hasher,
+		conf,
+		resources...,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	u := model.TestUser(t)
-	if err := services.SqlStore().User().Create(u); err != nil {
-		log.Fatal(err)
+	if err := services.SqlStore().User().Create(context.Background(), u); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewApi(conf, services), services, u
+}
+
+// login issues a token pair for the user bypassing the HTTP layer
+func login(t *testing.T, services *Services, u *model.User) *response.Token {
+	client := &dto.Client{IP: "127.0.0.1", UserAgent: "test"}
+	token, err := services.JwtService().IssueToken(context.Background(), u, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+// mailedToken returns the email sent to the address last and the token of the link it contains
+func mailedToken(t *testing.T, services *Services, to string) (*mail.Message, string) {
+	t.Helper()
+
+	messages, err := services.Mailer().(*mail.Outbox).Messages()
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	t.Cleanup(func() {
-		if err := services.SqlStore().User().Delete(u); err != nil {
-			log.Fatal(err)
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].To != to {
+			continue
 		}
-		conn.Redis.FlushAll()
 
-		conn.Close()
-	})
+		for _, field := range strings.Fields(messages[i].Body) {
+			if link, err := url.Parse(field); err == nil && link.Query().Get("token") != "" {
+				return messages[i], link.Query().Get("token")
+			}
+		}
+	}
+
+	t.Fatalf("no email with a link was sent to %s", to)
+	return nil, ""
+}
+
+func TestServer_Login(t *testing.T) {
+	api, services, u := setUp(t)
 
 	r := request.Login{
 		Email:    u.Email,
@@ -79,18 +156,31 @@ func TestServer_Login(t *testing.T) {
 			},
 			expectedCode: http.StatusUnauthorized,
 			testBody: func(rec *httptest.ResponseRecorder) {
-				body := make(map[string]string)
-				if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				problem := &response.Problem{}
+				if err := json.NewDecoder(rec.Body).Decode(problem); err != nil {
 					t.Fatal(err)
 				}
 
-				assert.NotEmpty(t, body)
-				assert.Equal(t, "incorrect email or password", body["error"])
+				assert.Equal(t, response.ProblemContentType, rec.Header().Get("Content-Type"))
+				assert.Equal(t, http.StatusUnauthorized, problem.Status)
+				assert.Equal(t, "incorrect email or password", problem.Detail)
+				assert.Equal(t, rec.Header().Get(response.RequestIDHeader), problem.Instance)
 			},
 		},
-	}
+		{
+			name: "disabled",
+			user: func() request.Login {
+				if err := services.SqlStore().User().SetDisabled(context.Background(), u.ID, true); err != nil {
+					t.Fatal(err)
+				}
 
-	api := NewApi(conf, NewServices(conn, conf))
+				r.Password = u.Password
+				return r
+			},
+			expectedCode: http.StatusForbidden,
+			testBody:     func(rec *httptest.ResponseRecorder) {},
+		},
+	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -109,3 +199,1455 @@ func TestServer_Login(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_Problem(t *testing.T) {
+	api, _, _ := setUp(t)
+
+	post := func(path string, body string) *response.Problem {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		api.server.Handler.ServeHTTP(rec, req)
+
+		problem := &response.Problem{}
+		if err := json.NewDecoder(rec.Body).Decode(problem); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, rec.Code, problem.Status)
+		assert.NotEmpty(t, problem.Instance)
+
+		return problem
+	}
+
+	problem := post("/users/", `{"name": "x", "email": "not an email"}`)
+	assert.Equal(t, http.StatusBadRequest, problem.Status)
+	assert.Equal(t, response.ProblemTypeValidation, problem.Type)
+	assert.Contains(t, problem.Errors, "email")
+	assert.Contains(t, problem.Errors, "name")
+
+	problem = post("/login", `{"email": 42}`)
+	assert.Equal(t, response.ProblemTypeMalformedBody, problem.Type)
+	assert.Equal(t, []string{"must be a string"}, problem.Errors["email"])
+
+	problem = post("/login", `{`)
+	assert.Equal(t, response.ProblemTypeMalformedBody, problem.Type)
+
+	problem = post("/unknown", `{}`)
+	assert.Equal(t, http.StatusNotFound, problem.Status)
+	assert.Equal(t, response.ProblemTypeDefault, problem.Type)
+}
+
+func TestServer_PasswordReset(t *testing.T) {
+	api, services, u := setUp(t)
+	session := login(t, services, u)
+
+	call := func(method string, path string, body interface{}, token *response.Token) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		b := &bytes.Buffer{}
+
+		if body != nil {
+			if err := json.NewEncoder(b).Encode(body); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		req, _ := http.NewRequest(method, path, b)
+		if token != nil {
+			req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		}
+		api.server.Handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	// unknown emails get the same answer and no email
+	forgot := func(email string) int {
+		return call(http.MethodPost, "/password/forgot", request.PasswordForgot{Email: email}, nil).Code
+	}
+	assert.Equal(t, http.StatusAccepted, forgot("nobody@example.org"))
+	assert.Equal(t, http.StatusAccepted, forgot(u.Email))
+
+	messages, err := services.Mailer().(*mail.Outbox).Messages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, messages, 1)
+	_, token := mailedToken(t, services, u.Email)
+
+	reset := func(token string, password string) int {
+		return call(http.MethodPost, "/password/reset", request.PasswordReset{Token: token, Password: password}, nil).Code
+	}
+	assert.Equal(t, http.StatusBadRequest, reset(token, "short"))
+	assert.Equal(t, http.StatusBadRequest, reset("unknown", "new_password"))
+	assert.Equal(t, http.StatusNoContent, reset(token, "new_password"))
+	assert.Equal(t, http.StatusBadRequest, reset(token, "other_password"))
+
+	// the sessions opened with the old password are revoked
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/admin/whoami", nil, session).Code)
+
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodPost, "/login", request.Login{Email: u.Email, Password: u.Password}, nil).Code)
+	assert.Equal(t, http.StatusOK, call(http.MethodPost, "/login", request.Login{Email: u.Email, Password: "new_password"}, nil).Code)
+}
+
+func TestServer_PasswordForgot(t *testing.T) {
+	conf := config.NewConfig()
+	conf.MailThrottle.MaxPerEmail = 2
+	conf.MailThrottle.MaxPerIP = 3
+	api, services, u := setUpWithConfig(t, conf)
+
+	forgot := func(ip string, email string) *httptest.ResponseRecorder {
+		b := &bytes.Buffer{}
+		if err := json.NewEncoder(b).Encode(request.PasswordForgot{Email: email}); err != nil {
+			t.Fatal(err)
+		}
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/password/forgot", b)
+		req.RemoteAddr = ip + ":1234"
+		api.server.Handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	throttled := func(rec *httptest.ResponseRecorder) {
+		t.Helper()
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+		problem := &response.Problem{}
+		if err := json.NewDecoder(rec.Body).Decode(problem); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, response.ProblemTypeMailThrottled, problem.Type)
+	}
+
+	// the emails with and without an account are throttled alike
+	for i, email := range []string{u.Email, "nobody@example.org"} {
+		ip := "10.0.0." + strconv.Itoa(i+1)
+		assert.Equal(t, http.StatusAccepted, forgot(ip, email).Code)
+		assert.Equal(t, http.StatusAccepted, forgot(ip, email).Code)
+		throttled(forgot("10.0.1.1", email))
+	}
+
+	// and so are the addresses, whatever the emails
+	for _, email := range []string{"a@example.org", "b@example.org", "c@example.org"} {
+		assert.Equal(t, http.StatusAccepted, forgot("10.0.2.1", email).Code)
+	}
+	throttled(forgot("10.0.2.1", "d@example.org"))
+
+	// an email which can't be sent gets the same answer
+	other := &model.User{Name: "other", Email: "other@example.org", Password: "password"}
+	if err := services.SqlStore().User().Create(context.Background(), other); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(conf.Mail.OutboxDir); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusAccepted, forgot("10.0.3.1", other.Email).Code)
+}
+
+func TestServer_PasswordPolicy(t *testing.T) {
+	api, services, u := setUp(t)
+	token := login(t, services, u)
+
+	if err := services.SqlStore().Role().Grant(context.Background(), u.ID, model.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	call := func(method string, path string, body interface{}) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		b := &bytes.Buffer{}
+
+		if body != nil {
+			if err := json.NewEncoder(b).Encode(body); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		req, _ := http.NewRequest(method, path, b)
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		api.server.Handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	// refused passwords are reported like the invalid fields
+	refused := func(rec *httptest.ResponseRecorder) {
+		t.Helper()
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		problem := &response.Problem{}
+		if err := json.NewDecoder(rec.Body).Decode(problem); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, response.ProblemTypeValidation, problem.Type)
+		assert.NotEmpty(t, problem.Errors["password"])
+	}
+
+	refused(call(http.MethodPost, "/users/", request.UserCreate{Name: "new", Email: "new@example.org", Password: "password1234"}))
+	refused(call(http.MethodPost, "/users/", request.UserCreate{Name: "Meriwether", Email: "new@example.org", Password: "Meriwether 8fK#q"}))
+
+	other := &model.User{Name: "other", Email: "other@example.org", Password: "password"}
+	if err := services.SqlStore().User().Create(context.Background(), other); err != nil {
+		t.Fatal(err)
+	}
+
+	path := "/admin/users/" + strconv.FormatUint(other.ID, 10)
+	first, second := "correct horse battery staple", "xK9#mQ2$vL wombat"
+	assert.Equal(t, http.StatusOK, call(http.MethodPatch, path, map[string]string{"password": first}).Code)
+	assert.Equal(t, http.StatusOK, call(http.MethodPatch, path, map[string]string{"password": second}).Code)
+
+	// the current and the former passwords can't be chosen again
+	refused(call(http.MethodPatch, path, map[string]string{"password": second}))
+	refused(call(http.MethodPatch, path, map[string]string{"password": first}))
+
+	// a refused reset leaves the token usable
+	assert.Equal(t, http.StatusAccepted, call(http.MethodPost, "/password/forgot", request.PasswordForgot{Email: other.Email}).Code)
+	_, resetToken := mailedToken(t, services, other.Email)
+	refused(call(http.MethodPost, "/password/reset", request.PasswordReset{Token: resetToken, Password: first}))
+	assert.Equal(t, http.StatusNoContent, call(http.MethodPost, "/password/reset", request.PasswordReset{Token: resetToken, Password: "blue tangerine orbit 42"}).Code)
+}
+
+func TestServer_EmailVerification(t *testing.T) {
+	conf := config.NewConfig()
+	conf.Verification.Required = true
+	api, services, _ := setUpWithConfig(t, conf)
+
+	call := func(method string, path string, body interface{}) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		b := &bytes.Buffer{}
+
+		if body != nil {
+			if err := json.NewEncoder(b).Encode(body); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		req, _ := http.NewRequest(method, path, b)
+		api.server.Handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	signup := request.UserCreate{Name: "new", Email: "new@example.org", Password: "correct horse battery staple"}
+	assert.Equal(t, http.StatusCreated, call(http.MethodPost, "/users/", signup).Code)
+	message, first := mailedToken(t, services, signup.Email)
+	assert.Equal(t, "Verify your email", message.Subject)
+
+	login := request.Login{Email: signup.Email, Password: signup.Password}
+	rec := call(http.MethodPost, "/login", login)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	problem := &response.Problem{}
+	if err := json.NewDecoder(rec.Body).Decode(problem); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, response.ProblemTypeEmailUnverified, problem.Type)
+
+	resend := request.VerificationResend{Email: signup.Email}
+	assert.Equal(t, http.StatusAccepted, call(http.MethodPost, "/users/verify/resend", resend).Code)
+	_, second := mailedToken(t, services, signup.Email)
+
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodGet, "/users/verify?token=invalid", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodGet, "/users/verify", nil).Code)
+
+	rec = call(http.MethodGet, "/users/verify?token="+url.QueryEscape(second), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	verified := &response.User{}
+	if err := json.NewDecoder(rec.Body).Decode(verified); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(t, verified.EmailVerifiedAt)
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/users/verify?token="+url.QueryEscape(first), nil).Code)
+
+	assert.Equal(t, http.StatusOK, call(http.MethodPost, "/login", login).Code)
+
+	// a new email has to be verified again and the links sent to the old one stop working
+	email := "renamed@example.org"
+	if _, err := services.SqlStore().User().Update(context.Background(), verified.ID, &model.UserChanges{Email: &email}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodGet, "/users/verify?token="+url.QueryEscape(second), nil).Code)
+	assert.Equal(t, http.StatusForbidden, call(http.MethodPost, "/login", request.Login{Email: email, Password: signup.Password}).Code)
+
+	// a link which can't be sent gets the same answer, and the resends are throttled
+	if err := os.RemoveAll(conf.Mail.OutboxDir); err != nil {
+		t.Fatal(err)
+	}
+	resend = request.VerificationResend{Email: email}
+	for i := 0; i < conf.MailThrottle.MaxPerEmail; i++ {
+		assert.Equal(t, http.StatusAccepted, call(http.MethodPost, "/users/verify/resend", resend).Code)
+	}
+
+	rec = call(http.MethodPost, "/users/verify/resend", resend)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+	problem = &response.Problem{}
+	if err := json.NewDecoder(rec.Body).Decode(problem); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, response.ProblemTypeMailThrottled, problem.Type)
+}
+
+func TestServer_PasswordRehash(t *testing.T) {
+	api, services, _ := setUp(t)
+
+	// hashed before argon2id was the default
+	legacy, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := &model.User{Name: "legacy", Email: "legacy@example.org", EncryptedPassword: string(legacy)}
+	if err := services.SqlStore().User().Create(context.Background(), u); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, u.PasswordOutdated(services.PasswordHasher()))
+
+	b := &bytes.Buffer{}
+	if err := json.NewEncoder(b).Encode(request.Login{Email: u.Email, Password: "password"}); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/login", b)
+	api.server.Handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	upgraded, err := services.SqlStore().User().Find(context.Background(), u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, strings.HasPrefix(upgraded.EncryptedPassword, "$argon2id$"))
+	assert.False(t, upgraded.PasswordOutdated(services.PasswordHasher()))
+	assert.True(t, upgraded.ComparePassword(services.PasswordHasher(), "password"))
+}
+
+func TestServer_LoginThrottle(t *testing.T) {
+	loginAs := func(api *Api, ip string, email string, password string) *httptest.ResponseRecorder {
+		b := &bytes.Buffer{}
+		if err := json.NewEncoder(b).Encode(request.Login{Email: email, Password: password}); err != nil {
+			t.Fatal(err)
+		}
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/login", b)
+		req.RemoteAddr = ip + ":1234"
+		api.server.Handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	problemType := func(rec *httptest.ResponseRecorder) string {
+		problem := &response.Problem{}
+		if err := json.NewDecoder(rec.Body).Decode(problem); err != nil {
+			t.Fatal(err)
+		}
+
+		return problem.Type
+	}
+
+	throttleConfig := func() *config.Config {
+		conf := config.NewConfig()
+		conf.Throttle.FreeAttempts = 100
+		conf.Throttle.MaxPerEmail = 100
+		conf.Throttle.MaxPerIP = 100
+		conf.Throttle.LockoutDuration = time.Hour
+
+		return conf
+	}
+
+	t.Run("backoff", func(t *testing.T) {
+		conf := throttleConfig()
+		conf.Throttle.FreeAttempts = 2
+		conf.Throttle.BaseDelay = time.Minute
+		conf.Throttle.MaxDelay = time.Hour
+		api, _, u := setUpWithConfig(t, conf)
+
+		assert.Equal(t, http.StatusUnauthorized, loginAs(api, "10.0.0.1", u.Email, "wrong").Code)
+		assert.Equal(t, http.StatusUnauthorized, loginAs(api, "10.0.0.1", u.Email, "wrong").Code)
+
+		// even the right password has to wait
+		rec := loginAs(api, "10.0.0.2", u.Email, u.Password)
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+		assert.Equal(t, response.ProblemTypeLoginThrottled, problemType(rec))
+	})
+
+	t.Run("lockout", func(t *testing.T) {
+		conf := throttleConfig()
+		conf.Throttle.MaxPerEmail = 3
+		api, services, u := setUpWithConfig(t, conf)
+
+		admin := &model.User{Name: "admin", Email: "admin@example.org", Password: "password"}
+		if err := services.SqlStore().User().Create(context.Background(), admin); err != nil {
+			t.Fatal(err)
+		}
+		if err := services.SqlStore().Role().Grant(context.Background(), admin.ID, model.RoleAdmin); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusUnauthorized, loginAs(api, "10.0.0.1", strings.ToUpper(u.Email), "wrong").Code)
+		}
+
+		rec := loginAs(api, "10.0.0.2", u.Email, u.Password)
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "3600", rec.Header().Get("Retry-After"))
+		assert.Equal(t, response.ProblemTypeAccountLocked, problemType(rec))
+
+		rec = httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/admin/users/"+strconv.FormatUint(u.ID, 10)+"/unlock", nil)
+		req.Header.Set("Authorization", "Bearer "+login(t, services, admin).AccessToken)
+		api.server.Handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+
+		assert.Equal(t, http.StatusOK, loginAs(api, "10.0.0.2", u.Email, u.Password).Code)
+	})
+
+	t.Run("mfa", func(t *testing.T) {
+		conf := throttleConfig()
+		conf.Throttle.MaxMFAFailures = 3
+		api, services, u := setUpWithConfig(t, conf)
+
+		enrollment, enrollErr := services.MfaService().Enroll(context.Background(), response.NewUser(u))
+		if enrollErr != nil {
+			t.Fatal(enrollErr)
+		}
+		code, _ := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+		codes, confirmErr := services.MfaService().Confirm(context.Background(), u.ID, &request.TOTPConfirm{Code: code})
+		if confirmErr != nil {
+			t.Fatal(confirmErr)
+		}
+
+		challenge := func() string {
+			rec := loginAs(api, "10.0.0.1", u.Email, u.Password)
+			assert.Equal(t, http.StatusAccepted, rec.Code)
+
+			c := &response.MFAChallenge{}
+			if err := json.NewDecoder(rec.Body).Decode(c); err != nil {
+				t.Fatal(err)
+			}
+
+			return c.MFAToken
+		}
+		verify := func(token string, code request.MFACode) *httptest.ResponseRecorder {
+			b := &bytes.Buffer{}
+			if err := json.NewEncoder(b).Encode(request.LoginMFA{MFAToken: token, MFACode: code}); err != nil {
+				t.Fatal(err)
+			}
+
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/login/mfa", b)
+			api.server.Handler.ServeHTTP(rec, req)
+
+			return rec
+		}
+
+		pending := challenge()
+
+		// every right password issues a new challenge, the failed codes still add up
+		for i := 0; i < 3; i++ {
+			rec := verify(challenge(), request.MFACode{RecoveryCode: "aaaaaaaa-aaaaaaaa"})
+			assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		}
+
+		rec := loginAs(api, "10.0.0.1", u.Email, u.Password)
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, response.ProblemTypeAccountLocked, problemType(rec))
+
+		rec = verify(pending, request.MFACode{RecoveryCode: codes.RecoveryCodes[0]})
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, response.ProblemTypeAccountLocked, problemType(rec))
+	})
+
+	t.Run("mfa reset", func(t *testing.T) {
+		conf := throttleConfig()
+		conf.Throttle.MaxPerEmail = 3
+		api, services, u := setUpWithConfig(t, conf)
+
+		enrollment, enrollErr := services.MfaService().Enroll(context.Background(), response.NewUser(u))
+		if enrollErr != nil {
+			t.Fatal(enrollErr)
+		}
+		code, _ := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+		if _, err := services.MfaService().Confirm(context.Background(), u.ID, &request.TOTPConfirm{Code: code}); err != nil {
+			t.Fatal(err)
+		}
+
+		// the right password alone doesn't forget the failures
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, http.StatusUnauthorized, loginAs(api, "10.0.0.1", u.Email, "wrong").Code)
+			assert.Equal(t, http.StatusAccepted, loginAs(api, "10.0.0.1", u.Email, u.Password).Code)
+		}
+		assert.Equal(t, http.StatusUnauthorized, loginAs(api, "10.0.0.1", u.Email, "wrong").Code)
+
+		rec := loginAs(api, "10.0.0.1", u.Email, u.Password)
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, response.ProblemTypeAccountLocked, problemType(rec))
+	})
+
+	t.Run("address", func(t *testing.T) {
+		conf := throttleConfig()
+		conf.Throttle.MaxPerIP = 3
+		api, _, u := setUpWithConfig(t, conf)
+
+		// unknown emails count as failures too
+		for i := 0; i < 3; i++ {
+			email := "unknown" + strconv.Itoa(i) + "@example.org"
+			assert.Equal(t, http.StatusUnauthorized, loginAs(api, "10.0.0.1", email, "wrong").Code)
+		}
+
+		rec := loginAs(api, "10.0.0.1", u.Email, u.Password)
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, response.ProblemTypeLoginThrottled, problemType(rec))
+
+		assert.Equal(t, http.StatusOK, loginAs(api, "10.0.0.2", u.Email, u.Password).Code)
+	})
+}
+
+func TestServer_Refresh(t *testing.T) {
+	api, services, u := setUp(t)
+	token := login(t, services, u)
+
+	refresh := func(refreshToken string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		b := &bytes.Buffer{}
+
+		if err := json.NewEncoder(b).Encode(request.Refresh{RefreshToken: refreshToken}); err != nil {
+			t.Fatal(err)
+		}
+
+		req, _ := http.NewRequest(http.MethodPost, "/refresh", b)
+		api.server.Handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	rec := refresh(token.RefreshToken)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rotated := &response.Token{}
+	if err := json.NewDecoder(rec.Body).Decode(rotated); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEmpty(t, rotated.RefreshToken)
+	assert.NotEqual(t, token.RefreshToken, rotated.RefreshToken)
+
+	// replaying the rotated token revokes the whole family
+	assert.Equal(t, http.StatusUnauthorized, refresh(token.RefreshToken).Code)
+	assert.Equal(t, http.StatusUnauthorized, refresh(rotated.RefreshToken).Code)
+
+	// a disabled user loses the session, it stays revoked once the user is enabled again
+	token = login(t, services, u)
+	if err := services.SqlStore().User().SetDisabled(context.Background(), u.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusForbidden, refresh(token.RefreshToken).Code)
+	if err := services.SqlStore().User().SetDisabled(context.Background(), u.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusUnauthorized, refresh(token.RefreshToken).Code)
+
+	// and so does a deleted one
+	token = login(t, services, u)
+	if err := services.SqlStore().User().Delete(context.Background(), u); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusUnauthorized, refresh(token.RefreshToken).Code)
+	families, err := services.MemoryStore().Token().FindUserFamilies(context.Background(), u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, families)
+}
+
+func TestServer_Sessions(t *testing.T) {
+	api, services, u := setUp(t)
+	current := login(t, services, u)
+	other := login(t, services, u)
+
+	call := func(method string, path string, token *response.Token) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		api.server.Handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	rec := call(http.MethodGet, "/admin/sessions", current)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var sessions []response.Session
+	if err := json.NewDecoder(rec.Body).Decode(&sessions); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, sessions, 2)
+
+	var otherID string
+	for _, s := range sessions {
+		assert.Equal(t, "127.0.0.1", s.IP)
+		if !s.Current {
+			otherID = s.ID
+		}
+	}
+
+	assert.Equal(t, http.StatusNoContent, call(http.MethodDelete, "/admin/sessions/"+otherID, current).Code)
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/admin/whoami", other).Code)
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/admin/whoami", current).Code)
+
+	assert.Equal(t, http.StatusOK, call(http.MethodDelete, "/admin/sessions", current).Code)
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/admin/whoami", current).Code)
+}
+
+func TestServer_Profile(t *testing.T) {
+	api, services, u := setUp(t)
+	current := login(t, services, u)
+	other := login(t, services, u)
+
+	call := func(method string, path string, body interface{}, token *response.Token) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		b := &bytes.Buffer{}
+
+		if body != nil {
+			if err := json.NewEncoder(b).Encode(body); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		req, _ := http.NewRequest(method, path, b)
+		if token != nil {
+			req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		}
+		api.server.Handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	// no permission is needed to rename oneself
+	rec := call(http.MethodPatch, "/admin/me", request.ProfileUpdate{Name: "renamed"}, current)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	updated := &response.User{}
+	if err := json.NewDecoder(rec.Body).Decode(updated); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "renamed", updated.Name)
+	assert.Equal(t, u.Email, updated.Email)
+
+	// the password change needs the current password and keeps only the current session
+	newPassword := "correct horse battery staple"
+	wrong := request.PasswordChange{CurrentPassword: "wrong", Password: newPassword}
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodPost, "/admin/me/password", wrong, current).Code)
+	weak := request.PasswordChange{CurrentPassword: u.Password, Password: "password1234"}
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodPost, "/admin/me/password", weak, current).Code)
+
+	change := request.PasswordChange{CurrentPassword: u.Password, Password: newPassword}
+	rec = call(http.MethodPost, "/admin/me/password", change, current)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	revoked := &response.SessionsRevoked{}
+	if err := json.NewDecoder(rec.Body).Decode(revoked); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, revoked.Revoked)
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/admin/whoami", nil, other).Code)
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/admin/whoami", nil, current).Code)
+
+	// the email changes once the link sent to the new address is followed
+	taken := &model.User{Name: "taken", Email: "taken@example.org", Password: "password"}
+	if err := services.SqlStore().User().Create(context.Background(), taken); err != nil {
+		t.Fatal(err)
+	}
+	used := request.EmailChange{Email: taken.Email, CurrentPassword: newPassword}
+	assert.Equal(t, http.StatusUnprocessableEntity, call(http.MethodPost, "/admin/me/email", used, current).Code)
+	wrongPassword := request.EmailChange{Email: "new@example.org", CurrentPassword: u.Password}
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodPost, "/admin/me/email", wrongPassword, current).Code)
+
+	emailChange := request.EmailChange{Email: "new@example.org", CurrentPassword: newPassword}
+	assert.Equal(t, http.StatusAccepted, call(http.MethodPost, "/admin/me/email", emailChange, current).Code)
+	message, token := mailedToken(t, services, emailChange.Email)
+	assert.Equal(t, "Confirm your new email", message.Subject)
+
+	unchanged, err := services.SqlStore().User().Find(context.Background(), u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, u.Email, unchanged.Email)
+
+	rec = call(http.MethodGet, "/users/email/confirm?token="+url.QueryEscape(token), nil, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	confirmed := &response.User{}
+	if err := json.NewDecoder(rec.Body).Decode(confirmed); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, emailChange.Email, confirmed.Email)
+	assert.NotNil(t, confirmed.EmailVerifiedAt)
+
+	// the former email is told, and the link works once
+	notice, err := services.Mailer().(*mail.Outbox).Messages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, u.Email, notice[len(notice)-1].To)
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodGet, "/users/email/confirm?token="+url.QueryEscape(token), nil, nil).Code)
+
+	// the verification tokens can't confirm an email change
+	verification := &model.User{ID: u.ID, Name: u.Name, Email: emailChange.Email}
+	if err := services.VerificationService().Send(verification); err != nil {
+		t.Fatal(err)
+	}
+	_, verificationToken := mailedToken(t, services, emailChange.Email)
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodGet, "/users/email/confirm?token="+url.QueryEscape(verificationToken), nil, nil).Code)
+}
+
+func TestServer_Audit(t *testing.T) {
+	api, services, u := setUp(t)
+
+	other := &model.User{Name: "other", Email: "other@example.org", Password: "password"}
+	if err := services.SqlStore().User().Create(context.Background(), other); err != nil {
+		t.Fatal(err)
+	}
+
+	call := func(method string, path string, body interface{}, token *response.Token) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		b := &bytes.Buffer{}
+
+		if body != nil {
+			if err := json.NewEncoder(b).Encode(body); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		req, _ := http.NewRequest(method, path, b)
+		req.Header.Set("User-Agent", "audit-test")
+		if token != nil {
+			req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		}
+		api.server.Handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	list := func(path string, token *response.Token) ([]*response.AuditEvent, string) {
+		t.Helper()
+
+		rec := call(http.MethodGet, path, nil, token)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		page := &struct {
+			Data       []*response.AuditEvent `json:"data"`
+			NextCursor string                 `json:"next_cursor"`
+		}{}
+		if err := json.NewDecoder(rec.Body).Decode(page); err != nil {
+			t.Fatal(err)
+		}
+
+		return page.Data, page.NextCursor
+	}
+
+	// an invalid email isn't checked nor recorded
+	invalid := request.Login{Email: strings.Repeat("a", 300), Password: "wrong"}
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodPost, "/login", invalid, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodPost, "/login", request.Login{Email: u.Email, Password: "wrong"}, nil).Code)
+
+	rec := call(http.MethodPost, "/login", request.Login{Email: u.Email, Password: u.Password}, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	token := &response.Token{}
+	if err := json.NewDecoder(rec.Body).Decode(token); err != nil {
+		t.Fatal(err)
+	}
+
+	// browsing the log needs audit:read
+	assert.Equal(t, http.StatusForbidden, call(http.MethodGet, "/admin/audit", nil, token).Code)
+	if err := services.SqlStore().Role().Grant(context.Background(), u.ID, model.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	otherPath := "/admin/users/" + strconv.FormatUint(other.ID, 10)
+	assert.Equal(t, http.StatusOK, call(http.MethodPatch, otherPath, map[string]string{"name": "renamed"}, token).Code)
+	assert.Equal(t, http.StatusNoContent, call(http.MethodPut, otherPath+"/roles/admin", nil, token).Code)
+	login(t, services, other)
+	assert.Equal(t, http.StatusOK, call(http.MethodDelete, otherPath+"/sessions", nil, token).Code)
+	assert.Equal(t, http.StatusNoContent, call(http.MethodDelete, otherPath, nil, token).Code)
+
+	// the latest first
+	events, _ := list("/admin/audit", token)
+	actions := make([]string, 0, len(events))
+	for _, e := range events {
+		actions = append(actions, e.Action)
+	}
+	assert.Equal(t, []string{
+		model.AuditUserDelete,
+		model.AuditSessionsRevoke,
+		model.AuditRoleGrant,
+		model.AuditUserUpdate,
+		model.AuditLogin,
+		model.AuditLoginFailed,
+	}, actions)
+
+	failed := events[5]
+	assert.Nil(t, failed.ActorID)
+	assert.Equal(t, model.AuditTargetLogin, failed.TargetType)
+	assert.Equal(t, u.Email, failed.TargetID)
+	assert.Equal(t, "audit-test", failed.UserAgent)
+
+	update := events[3]
+	if assert.NotNil(t, update.ActorID) {
+		assert.Equal(t, u.ID, *update.ActorID)
+	}
+	assert.Equal(t, strconv.FormatUint(other.ID, 10), update.TargetID)
+	assert.NotEmpty(t, update.RequestID)
+	assert.Equal(t, map[string]*model.AuditChange{"name": {Before: "other", After: "renamed"}}, update.Changes)
+
+	// the sessions revoked by an admin are counted
+	revoked := events[1]
+	if assert.NotNil(t, revoked.ActorID) {
+		assert.Equal(t, u.ID, *revoked.ActorID)
+	}
+	assert.Equal(t, strconv.FormatUint(other.ID, 10), revoked.TargetID)
+	assert.Equal(t, map[string]*model.AuditChange{"revoked": {After: float64(1)}}, revoked.Changes)
+
+	deleted := events[0]
+	assert.Equal(t, "renamed", deleted.Changes["name"].Before)
+	assert.Nil(t, deleted.Changes["name"].After)
+
+	// filters and cursor pagination
+	events, _ = list("/admin/audit?filter[target_id]="+strconv.FormatUint(other.ID, 10)+"&filter[action][in]=user.update,user.delete", token)
+	assert.Len(t, events, 2)
+
+	first, next := list("/admin/audit?sort=id&limit=2", token)
+	assert.Len(t, first, 2)
+	assert.Equal(t, model.AuditLoginFailed, first[0].Action)
+	if assert.NotEmpty(t, next) {
+		second, _ := list("/admin/audit?sort=id&limit=2&cursor="+next, token)
+		if assert.Len(t, second, 2) {
+			assert.Equal(t, model.AuditUserUpdate, second[0].Action)
+		}
+	}
+
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodGet, "/admin/audit?filter[user_agent]=x", nil, token).Code)
+}
+
+func TestServer_Metrics(t *testing.T) {
+	conf := config.NewConfig()
+	conf.Metrics.Addr = "localhost:9090"
+	api, services, u := setUpWithConfig(t, conf)
+	token := login(t, services, u)
+
+	if err := services.SqlStore().Role().Grant(context.Background(), u.ID, model.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	call := func(handler http.Handler, method string, path string, body interface{}) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		b := &bytes.Buffer{}
+
+		if body != nil {
+			if err := json.NewEncoder(b).Encode(body); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		req, _ := http.NewRequest(method, path, b)
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	// the metrics are global, the test looks at what it adds
+	route := "/admin/users/{id:[0-9]+}"
+	found := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, route, "200"))
+	notFound := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, route, "404"))
+	unmatched := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, "unmatched", "404"))
+	failures := testutil.ToFloat64(metrics.LoginFailures.WithLabelValues("credentials"))
+
+	assert.Equal(t, http.StatusOK, call(api.server.Handler, http.MethodGet, "/admin/users/"+strconv.FormatUint(u.ID, 10), nil).Code)
+	assert.Equal(t, http.StatusNotFound, call(api.server.Handler, http.MethodGet, "/admin/users/999", nil).Code)
+	assert.Equal(t, http.StatusNotFound, call(api.server.Handler, http.MethodGet, "/nowhere", nil).Code)
+	login := request.Login{Email: u.Email, Password: "wrong"}
+	assert.Equal(t, http.StatusUnauthorized, call(api.server.Handler, http.MethodPost, "/login", login).Code)
+
+	assert.Equal(t, found+1, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, route, "200")))
+	assert.Equal(t, notFound+1, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, route, "404")))
+	assert.Equal(t, unmatched+1, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, "unmatched", "404")))
+	assert.Equal(t, failures+1, testutil.ToFloat64(metrics.LoginFailures.WithLabelValues("credentials")))
+
+	// the metrics have a listener of their own
+	assert.Equal(t, http.StatusNotFound, call(api.server.Handler, http.MethodGet, "/metrics", nil).Code)
+	rec := call(api.metricsServer.Handler, http.MethodGet, "/metrics", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `godmin_http_request_duration_seconds_bucket{method="GET",route="/admin/users/{id:[0-9]+}",status="200",le="+Inf"}`)
+	assert.Contains(t, rec.Body.String(), "# TYPE godmin_auth_login_failures_total counter")
+}
+
+func TestServer_Health(t *testing.T) {
+	conf := config.NewConfig()
+	conf.Health.CheckTimeout = 50 * time.Millisecond
+	conf.Health.DrainDelay = 0
+	api, services, _ := setUpWithConfig(t, conf)
+
+	probe := func(path string) (int, *response.Health) {
+		t.Helper()
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		api.server.Handler.ServeHTTP(rec, req)
+
+		health := &response.Health{}
+		if err := json.NewDecoder(rec.Body).Decode(health); err != nil {
+			t.Fatal(err)
+		}
+
+		return rec.Code, health
+	}
+
+	services.Health().AddCheck("postgres", func(ctx context.Context) error { return nil })
+
+	code, health := probe("/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, response.HealthStatusUp, health.Status)
+	if assert.Contains(t, health.Checks, "postgres") {
+		assert.Equal(t, response.HealthStatusUp, health.Checks["postgres"].Status)
+	}
+
+	// a check which doesn't answer in time fails
+	release := make(chan struct{})
+	defer close(release)
+	services.Health().AddCheck("redis", func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+
+	code, health = probe("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, response.HealthStatusDown, health.Status)
+	assert.Equal(t, response.HealthStatusUp, health.Checks["postgres"].Status)
+	assert.Equal(t, response.HealthStatusDown, health.Checks["redis"].Status)
+
+	services.Health().AddCheck("redis", func(ctx context.Context) error { return errors.New("connection refused") })
+	code, _ = probe("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+
+	// the liveness doesn't depend on anything
+	code, health = probe("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, response.HealthStatusUp, health.Status)
+
+	// the readiness fails as soon as the shutdown begins
+	services.Health().AddCheck("redis", func(ctx context.Context) error { return nil })
+	assert.NoError(t, api.Shutdown())
+	code, health = probe("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, response.HealthStatusDraining, health.Status)
+}
+
+func TestServer_Timeout(t *testing.T) {
+	conf := config.NewConfig()
+	conf.Health.CheckTimeout = time.Minute
+	conf.Health.DrainDelay = 0
+	if err := conf.Timeout.Routes.Decode("GET /readyz=20ms, /healthz=1m"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Error(t, conf.Timeout.Routes.Decode("/readyz"))
+	assert.Error(t, conf.Timeout.Routes.Decode("/readyz=soon"))
+	api, services, _ := setUpWithConfig(t, conf)
+
+	call := func(ctx context.Context, path string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+		api.server.Handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	// the check waits for the deadline of the route, not for its own timeout
+	services.Health().AddCheck("postgres", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	rec := call(context.Background(), "/readyz")
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	assert.Equal(t, response.ProblemContentType, rec.Header().Get("Content-Type"))
+	problem := &response.Problem{}
+	if assert.NoError(t, json.NewDecoder(rec.Body).Decode(problem)) {
+		assert.Equal(t, http.StatusGatewayTimeout, problem.Status)
+		assert.Equal(t, rec.Header().Get(response.RequestIDHeader), problem.Instance)
+	}
+
+	rec = call(context.Background(), "/healthz")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// a request cancelled by the client or the shutdown isn't a timeout
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec = call(cancelled, "/healthz")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	problem = &response.Problem{}
+	if assert.NoError(t, json.NewDecoder(rec.Body).Decode(problem)) {
+		assert.Equal(t, http.StatusServiceUnavailable, problem.Status)
+	}
+}
+
+func TestServer_Tracing(t *testing.T) {
+	// the router takes the provider and the propagator when it is made
+	rec := tracetest.NewSpanRecorder()
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	}()
+
+	api, services, u := setUp(t)
+	token := login(t, services, u)
+
+	if err := services.SqlStore().Role().Grant(context.Background(), u.ID, model.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	hooks := log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+	defer log.StandardLogger().ReplaceHooks(hooks)
+	logs := logtest.NewGlobal()
+
+	call := func(path string, traceparent string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		if traceparent != "" {
+			req.Header.Set("traceparent", traceparent)
+		}
+		api.server.Handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	path := "/admin/users/" + strconv.FormatUint(u.ID, 10)
+	assert.Equal(t, http.StatusOK, call(path, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01").Code)
+	assert.Equal(t, http.StatusNotFound, call("/nowhere", "not a traceparent").Code)
+
+	spans := rec.Ended()
+	if assert.Len(t, spans, 2) {
+		// the span continues the trace of the caller and is named after the route
+		found := spans[0]
+		assert.Equal(t, "/admin/users/{id:[0-9]+}", found.Name())
+		assert.Equal(t, trace.SpanKindServer, found.SpanKind())
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", found.SpanContext().TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", found.Parent().SpanID().String())
+		assert.Contains(t, found.Attributes(), semconv.HTTPRouteKey.String("/admin/users/{id:[0-9]+}"))
+		assert.Contains(t, found.Attributes(), semconv.HTTPStatusCodeKey.Int(http.StatusOK))
+
+		// an invalid traceparent starts a new trace
+		unmatched := spans[1]
+		assert.Equal(t, "HTTP GET route not found", unmatched.Name())
+		assert.NotEqual(t, "4bf92f3577b34da6a3ce929d0e0e4736", unmatched.SpanContext().TraceID().String())
+		assert.False(t, unmatched.Parent().IsValid())
+
+		// the request logs carry the ids of the request span
+		logged := 0
+		for _, entry := range logs.AllEntries() {
+			if entry.Data["trace_id"] == found.SpanContext().TraceID().String() {
+				assert.Equal(t, found.SpanContext().SpanID().String(), entry.Data["span_id"])
+				logged++
+			}
+		}
+		assert.Equal(t, 2, logged)
+	}
+}
+
+func TestServer_LoginMFA(t *testing.T) {
+	api, services, u := setUp(t)
+
+	enrollment, enrollErr := services.MfaService().Enroll(context.Background(), response.NewUser(u))
+	if enrollErr != nil {
+		t.Fatal(enrollErr)
+	}
+
+	code, _ := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+	codes, confirmErr := services.MfaService().Confirm(context.Background(), u.ID, &request.TOTPConfirm{Code: code})
+	if confirmErr != nil {
+		t.Fatal(confirmErr)
+	}
+	assert.Len(t, codes.RecoveryCodes, 10)
+
+	post := func(path string, body interface{}) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		b := &bytes.Buffer{}
+
+		if err := json.NewEncoder(b).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+
+		req, _ := http.NewRequest(http.MethodPost, path, b)
+		api.server.Handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	rec := post("/login", request.Login{Email: u.Email, Password: u.Password})
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+
+	challenge := &response.MFAChallenge{}
+	if err := json.NewDecoder(rec.Body).Decode(challenge); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, challenge.MFARequired)
+
+	// the code was burnt by the confirmation
+	assert.Equal(t, http.StatusUnauthorized, post("/login/mfa", request.LoginMFA{
+		MFAToken: challenge.MFAToken,
+		MFACode:  request.MFACode{Code: code},
+	}).Code)
+
+	rec = post("/login/mfa", request.LoginMFA{
+		MFAToken: challenge.MFAToken,
+		MFACode:  request.MFACode{RecoveryCode: codes.RecoveryCodes[0]},
+	})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// challenges and recovery codes are single-use
+	assert.Equal(t, http.StatusUnauthorized, post("/login/mfa", request.LoginMFA{
+		MFAToken: challenge.MFAToken,
+		MFACode:  request.MFACode{RecoveryCode: codes.RecoveryCodes[0]},
+	}).Code)
+
+	// the wrong codes are failed logins, the spent challenge has no user any more
+	q, err := query.Parse(url.Values{"filter[action]": {model.AuditLoginFailed}}, store.AuditSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, _, err := services.SqlStore().Audit().List(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := make([]string, 0, len(events))
+	for _, e := range events {
+		assert.Equal(t, model.AuditTargetLogin, e.TargetType)
+		targets = append(targets, e.TargetID)
+	}
+	assert.ElementsMatch(t, []string{u.Email, ""}, targets)
+}
+
+func TestServer_MFADisable(t *testing.T) {
+	conf := config.NewConfig()
+	conf.Throttle.MaxMFAFailures = 2
+	api, services, u := setUpWithConfig(t, conf)
+	token := login(t, services, u)
+
+	enrollment, enrollErr := services.MfaService().Enroll(context.Background(), response.NewUser(u))
+	if enrollErr != nil {
+		t.Fatal(enrollErr)
+	}
+	code, _ := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+	codes, confirmErr := services.MfaService().Confirm(context.Background(), u.ID, &request.TOTPConfirm{Code: code})
+	if confirmErr != nil {
+		t.Fatal(confirmErr)
+	}
+
+	disable := func(body request.MFADisable) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		b := &bytes.Buffer{}
+		if err := json.NewEncoder(b).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+
+		req, _ := http.NewRequest(http.MethodDelete, "/admin/mfa/totp", b)
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		api.server.Handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	// the token alone isn't enough
+	recovery := request.MFACode{RecoveryCode: codes.RecoveryCodes[0]}
+	assert.Equal(t, http.StatusBadRequest, disable(request.MFADisable{MFACode: recovery}).Code)
+	wrongPassword := request.MFADisable{CurrentPassword: "wrong", MFACode: recovery}
+	assert.Equal(t, http.StatusBadRequest, disable(wrongPassword).Code)
+
+	// the wrong codes lock the account like the ones of the login
+	wrong := request.MFACode{RecoveryCode: "aaaaaaaa-aaaaaaaa"}
+	for i := 0; i < conf.Throttle.MaxMFAFailures; i++ {
+		assert.Equal(
+			t,
+			http.StatusUnprocessableEntity,
+			disable(request.MFADisable{CurrentPassword: u.Password, MFACode: wrong}).Code,
+		)
+	}
+	valid := request.MFADisable{CurrentPassword: u.Password, MFACode: recovery}
+	assert.Equal(t, http.StatusTooManyRequests, disable(valid).Code)
+
+	if err := services.LoginThrottle().Unlock(context.Background(), u.ID, u.Email); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusNoContent, disable(valid).Code)
+
+	_, err := services.SqlStore().TOTP().FindByUser(context.Background(), u.ID)
+	assert.Equal(t, store.ErrRecordNotFound, err)
+}
+
+func TestServer_ApiKey(t *testing.T) {
+	api, services, u := setUp(t)
+
+	key, createErr := services.ApiKeyService().Create(context.Background(), u.ID, &request.ApiKeyCreate{Name: "ci"})
+	if createErr != nil {
+		t.Fatal(createErr)
+	}
+	assert.True(t, strings.HasPrefix(key.Key, model.ApiKeyPrefix))
+
+	whoami := func(key string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/admin/whoami", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		api.server.Handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	rec := whoami(key.Key)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	user := &response.User{}
+	if err := json.NewDecoder(rec.Body).Decode(user); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, u.ID, user.ID)
+
+	assert.Equal(t, http.StatusUnauthorized, whoami(model.ApiKeyPrefix+"unknown").Code)
+
+	// a scoped key can't mint an unrestricted one nor manage the account
+	scoped, createErr := services.ApiKeyService().Create(
+		context.Background(),
+		u.ID,
+		&request.ApiKeyCreate{Name: "read-only", Scopes: []string{model.PermissionUsersRead}},
+	)
+	if createErr != nil {
+		t.Fatal(createErr)
+	}
+
+	_, createErr = services.ApiKeyService().Create(
+		context.Background(),
+		u.ID,
+		&request.ApiKeyCreate{Name: "typo", Scopes: []string{model.PermissionUsersRead, "users:raed"}},
+	)
+	if assert.NotNil(t, createErr) {
+		assert.Equal(t, http.StatusUnprocessableEntity, createErr.GetStatusCode())
+	}
+
+	for _, route := range []struct{ method, path, body string }{
+		{http.MethodPost, "/admin/api-keys", `{"name": "escalated"}`},
+		{http.MethodGet, "/admin/api-keys", ""},
+		{http.MethodDelete, "/admin/api-keys/" + strconv.FormatUint(key.ID, 10), ""},
+		{http.MethodPatch, "/admin/me", `{"name": "renamed"}`},
+		{http.MethodPost, "/admin/me/password", `{"current_password": "x", "new_password": "y"}`},
+		{http.MethodPost, "/admin/mfa/totp", ""},
+		{http.MethodGet, "/admin/sessions", ""},
+		{http.MethodDelete, "/admin/sessions", ""},
+	} {
+		for _, k := range []string{key.Key, scoped.Key} {
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(route.method, route.path, strings.NewReader(route.body))
+			req.Header.Set("Authorization", "Bearer "+k)
+			api.server.Handler.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusForbidden, rec.Code, route.method+" "+route.path)
+		}
+	}
+	keys, listErr := services.ApiKeyService().List(context.Background(), u.ID)
+	if listErr != nil {
+		t.Fatal(listErr)
+	}
+	assert.Len(t, keys, 2)
+
+	if err := services.ApiKeyService().Revoke(context.Background(), u.ID, key.ID); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusUnauthorized, whoami(key.Key).Code)
+}
+
+func TestServer_RequirePermission(t *testing.T) {
+	api, services, u := setUp(t)
+	token := login(t, services, u)
+
+	call := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		api.server.Handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	assert.Equal(t, http.StatusForbidden, call("/admin/roles").Code)
+
+	if err := services.SqlStore().Role().Grant(context.Background(), u.ID, model.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusOK, call("/admin/roles").Code)
+
+	rec := call("/admin/whoami")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	whoami := &response.Whoami{}
+	if err := json.NewDecoder(rec.Body).Decode(whoami); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{model.RoleAdmin}, whoami.Roles)
+	assert.Contains(t, whoami.Permissions, model.PermissionRolesRead)
+}
+
+func TestServer_Resources(t *testing.T) {
+	orders := admin.Resource{
+		Table:  "orders",
+		Fields: []*admin.Field{{Name: "id", Type: admin.TypeInt, ReadOnly: true}},
+	}
+	api, services, u := setUpWithConfig(t, config.NewConfig(), orders)
+	token := login(t, services, u)
+
+	// the registry belongs to the services, another instance doesn't see the resource
+	_, others, _ := setUp(t)
+	assert.Empty(t, others.Resources())
+
+	_, err := NewServicesWithStores(
+		teststore.New(time.Now, services.PasswordHasher()),
+		teststore.NewMemoryStore(time.Now),
+		services.PasswordHasher(),
+		config.NewConfig(),
+		orders,
+		orders,
+	)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "already registered")
+	}
+
+	call := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/admin/resources", nil)
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		api.server.Handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	// describing the resources needs resources:read
+	assert.Equal(t, http.StatusForbidden, call().Code)
+
+	if err := services.SqlStore().Role().Grant(context.Background(), u.ID, model.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := call()
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resources []struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resources); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, resources, 1) {
+		assert.Equal(t, "orders", resources[0].Name)
+	}
+}
+
+func TestServer_UserCRUD(t *testing.T) {
+	api, services, u := setUp(t)
+	token := login(t, services, u)
+
+	if err := services.SqlStore().Role().Grant(context.Background(), u.ID, model.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	other := &model.User{Name: "other", Email: "other@example.org", Password: "password"}
+	if err := services.SqlStore().User().Create(context.Background(), other); err != nil {
+		t.Fatal(err)
+	}
+
+	call := func(method string, path string, body interface{}) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		b := &bytes.Buffer{}
+
+		if body != nil {
+			if err := json.NewEncoder(b).Encode(body); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		req, _ := http.NewRequest(method, path, b)
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		api.server.Handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+	rec := call(http.MethodGet, "/admin/users?limit=1&filter[email]="+url.QueryEscape(other.Email), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	list := &struct {
+		Data       []*response.User `json:"data"`
+		NextCursor string           `json:"next_cursor"`
+	}{}
+	if err := json.NewDecoder(rec.Body).Decode(list); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, list.Data, 1) {
+		assert.Equal(t, other.ID, list.Data[0].ID)
+	}
+	assert.Empty(t, list.NextCursor)
+
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodGet, "/admin/users?sort=encrypted_password", nil).Code)
+
+	path := "/admin/users/" + strconv.FormatUint(other.ID, 10)
+
+	name := "renamed"
+	rec = call(http.MethodPatch, path, map[string]string{"name": name})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	updated := &response.User{}
+	if err := json.NewDecoder(rec.Body).Decode(updated); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, name, updated.Name)
+	assert.Equal(t, other.Email, updated.Email)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, call(http.MethodPatch, path, map[string]string{"email": u.Email}).Code)
+
+	// a new password and email in one change, the sessions of the user are revoked
+	otherToken := login(t, services, other)
+	former, err := services.SqlStore().User().Find(context.Background(), other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	email := "moved@example.org"
+	rec = call(http.MethodPatch, path, map[string]string{"email": email, "password": "Another-passw0rd"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	history, err := services.SqlStore().PasswordHistory().FindByUser(context.Background(), other.ID, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{former.EncryptedPassword}, history)
+
+	refreshed, err := services.JwtService().RefreshToken(
+		context.Background(),
+		&request.Refresh{RefreshToken: otherToken.RefreshToken},
+	)
+	assert.Nil(t, refreshed)
+	assert.NotNil(t, err)
+
+	// the new email has to be verified again
+	mailedToken(t, services, email)
+
+	// the deleted user is logged out everywhere
+	login(t, services, other)
+	assert.Equal(t, http.StatusNoContent, call(http.MethodDelete, path, nil).Code)
+	families, err := services.MemoryStore().Token().FindUserFamilies(context.Background(), other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, families)
+	assert.Equal(t, http.StatusNotFound, call(http.MethodGet, path, nil).Code)
+	assert.Equal(t, http.StatusNotFound, call(http.MethodDelete, path, nil).Code)
+}
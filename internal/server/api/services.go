@@ -1,38 +1,251 @@
 package api
 
 import (
+	"context"
+	"fmt"
+	"godmin/admin"
 	"godmin/config"
+	"godmin/internal/mail"
+	"godmin/internal/metrics"
+	"godmin/internal/model"
+	"godmin/internal/password"
 	"godmin/internal/server"
 	"godmin/internal/server/service"
+	"godmin/internal/store"
 	"godmin/internal/store/memorystore"
 	"godmin/internal/store/sqlstore"
+
+	log "github.com/sirupsen/logrus"
 )
 
 type Services struct {
-	sqlStore    *sqlstore.Store
-	memoryStore *memorystore.Store
-	jwtService  *service.JWTService
+	sqlStore            store.Store
+	memoryStore         store.MemoryStore
+	hasher              *password.Hasher
+	jwtService          *service.JWTService
+	mfaService          *service.MFAService
+	apiKeyService       *service.ApiKeyService
+	passwordService     *service.PasswordService
+	verificationService *service.VerificationService
+	loginThrottle       *service.LoginThrottle
+	auditor             *service.Auditor
+	health              *service.HealthService
+	mailer              mail.Mailer
+	resources           *admin.Registry
 }
 
-func (s *Services) SqlStore() *sqlstore.Store {
+func (s *Services) SqlStore() store.Store {
 	return s.sqlStore
 }
 
-func (s *Services) MemoryStore() *memorystore.Store {
+func (s *Services) MemoryStore() store.MemoryStore {
 	return s.memoryStore
 }
 
+func (s *Services) PasswordHasher() *password.Hasher {
+	return s.hasher
+}
+
 func (s *Services) JwtService() *service.JWTService {
 	return s.jwtService
 }
 
-func NewServices(conn *server.Connections, config *config.Config) *Services {
-	sqlStore := sqlstore.New(conn.Db)
-	memoryStore := memorystore.New(conn.Redis)
+func (s *Services) MfaService() *service.MFAService {
+	return s.mfaService
+}
+
+func (s *Services) ApiKeyService() *service.ApiKeyService {
+	return s.apiKeyService
+}
+
+func (s *Services) Mailer() mail.Mailer {
+	return s.mailer
+}
+
+func (s *Services) PasswordService() *service.PasswordService {
+	return s.passwordService
+}
+
+func (s *Services) VerificationService() *service.VerificationService {
+	return s.verificationService
+}
+
+func (s *Services) LoginThrottle() *service.LoginThrottle {
+	return s.loginThrottle
+}
+
+func (s *Services) Auditor() *service.Auditor {
+	return s.auditor
+}
+
+func (s *Services) Health() *service.HealthService {
+	return s.health
+}
+
+func (s *Services) Resources() []*admin.Resource {
+	return s.resources.Resources()
+}
+
+// NewServices builds the services on the connections, whose pool stats are exported as metrics.
+// The server is ready as long as both connections answer. The resources are administered next to the introspected ones.
+func NewServices(conn *server.Connections, config *config.Config, resources ...admin.Resource) (*Services, error) {
+	metrics.RegisterDB(conn.Db.DB)
+	metrics.RegisterRedis(conn.Redis)
+
+	hasher, err := password.New(config.PasswordHash)
+	if err != nil {
+		return nil, err
+	}
+
+	services, err := NewServicesWithStores(
+		sqlstore.New(conn.Db, hasher),
+		memorystore.New(conn.Redis),
+		hasher,
+		config,
+		resources...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	services.health.AddCheck("postgres", conn.Db.PingContext)
+	services.health.AddCheck("redis", func(ctx context.Context) error {
+		return conn.Redis.WithContext(ctx).Ping().Err()
+	})
+
+	return services, nil
+}
+
+// NewServicesWithStores builds the services on top of any store implementation, e.g. the in-process teststore.
+// The passwords are verified with the hasher the store hashes them with. Every Services has a registry of its own,
+// an invalid resource is an error.
+func NewServicesWithStores(
+	sqlStore store.Store,
+	memoryStore store.MemoryStore,
+	hasher *password.Hasher,
+	config *config.Config,
+	resources ...admin.Resource,
+) (*Services, error) {
+	policy, err := password.NewPolicy(config.PasswordPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := service.NewKeySet(config.Jwt)
+	if err != nil {
+		return nil, err
+	}
+
+	mailer, err := mail.New(config.Mail)
+	if err != nil {
+		return nil, err
+	}
+
+	registry := &admin.Registry{}
+	for _, res := range resources {
+		if err := registry.Register(res); err != nil {
+			return nil, err
+		}
+	}
+
+	// the startup queries aren't bound to a request
+	ctx := context.Background()
+	if config.Admin.IntrospectSchema != "" {
+		if err := introspectResources(ctx, sqlStore, registry, config.Admin); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := createResourcePermissions(ctx, sqlStore, registry.Resources()); err != nil {
+		return nil, err
+	}
+
+	loginThrottle := service.NewLoginThrottle(memoryStore, config.Throttle)
+	mailThrottle := service.NewMailThrottle(memoryStore, config.MailThrottle)
 
 	return &Services{
 		sqlStore:    sqlStore,
 		memoryStore: memoryStore,
-		jwtService:  service.NewJwtService(sqlStore, memoryStore, config.Jwt),
+		hasher:      hasher,
+		jwtService: service.NewJwtService(
+			sqlStore,
+			memoryStore,
+			hasher,
+			keys,
+			config.Jwt,
+			config.Verification,
+			loginThrottle,
+		),
+		mfaService:    service.NewMFAService(sqlStore, memoryStore, hasher, loginThrottle, config.Mfa),
+		apiKeyService: service.NewApiKeyService(sqlStore),
+		passwordService: service.NewPasswordService(
+			sqlStore,
+			memoryStore,
+			hasher,
+			mailer,
+			config.Password,
+			policy,
+			mailThrottle,
+		),
+		verificationService: service.NewVerificationService(
+			sqlStore,
+			hasher,
+			mailer,
+			config.Verification,
+			mailThrottle,
+		),
+		loginThrottle: loginThrottle,
+		auditor:       service.NewAuditor(sqlStore),
+		health:        service.NewHealthService(config.Health),
+		mailer:        mailer,
+		resources:     registry,
+	}, nil
+}
+
+// introspectResources registers the tables of the configured schema, the resources registered by hand take precedence
+func introspectResources(
+	ctx context.Context,
+	sqlStore store.Store,
+	registry *admin.Registry,
+	conf *config.Admin,
+) error {
+	tables, err := sqlStore.Catalog().Tables(ctx, conf.IntrospectSchema)
+	if err != nil {
+		return fmt.Errorf("can't introspect the schema %s: %w", conf.IntrospectSchema, err)
+	}
+
+	for _, t := range tables {
+		if !admin.Introspectable(t.Name, conf.IntrospectTables) {
+			continue
+		}
+
+		res, err := admin.FromTable(t)
+		if err == nil {
+			err = registry.Register(res)
+		}
+		if err != nil {
+			log.Warnf("table %s is not introspected: %v", t.Name, err)
+		}
 	}
+
+	return nil
+}
+
+// createResourcePermissions makes the permissions of the registered resources grantable,
+// the admin role gets the ones which didn't exist yet
+func createResourcePermissions(ctx context.Context, sqlStore store.Store, resources []*admin.Resource) error {
+	for _, res := range resources {
+		permissions := map[string]string{
+			res.Permissions.Read:  "List and view " + res.Name,
+			res.Permissions.Write: "Create, update and delete " + res.Name,
+		}
+
+		for name, description := range permissions {
+			if err := sqlStore.Role().CreatePermission(ctx, name, description, model.RoleAdmin); err != nil {
+				return fmt.Errorf("can't create the permission %s: %w", name, err)
+			}
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"encoding/json"
+	"godmin/internal/server"
+	"godmin/internal/server/request"
+	"godmin/internal/server/response"
+	"godmin/internal/server/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type ApiKeyController struct {
+	apiKeyService   *service.ApiKeyService
+	responseHandler response.Handler
+}
+
+func (c *ApiKeyController) HandleCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value(server.CtxKeyUser).(*response.User)
+
+		req := &request.ApiKeyCreate{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		key, err := c.apiKeyService.Create(r.Context(), user.ID, req)
+		if err != nil {
+			c.responseHandler.Error(w, r, err.GetStatusCode(), err.GetError())
+			return
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusCreated, key)
+	}
+}
+
+func (c *ApiKeyController) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value(server.CtxKeyUser).(*response.User)
+
+		keys, err := c.apiKeyService.List(r.Context(), user.ID)
+		if err != nil {
+			c.responseHandler.Error(w, r, err.GetStatusCode(), err.GetError())
+			return
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusOK, keys)
+	}
+}
+
+func (c *ApiKeyController) HandleRevoke() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value(server.CtxKeyUser).(*response.User)
+
+		id, parseErr := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+		if parseErr != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, parseErr)
+			return
+		}
+
+		if err := c.apiKeyService.Revoke(r.Context(), user.ID, id); err != nil {
+			c.responseHandler.Error(w, r, err.GetStatusCode(), err.GetError())
+			return
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusNoContent, nil)
+	}
+}
+
+func NewApiKeyController(apiKeyService *service.ApiKeyService, responseHandler response.Handler) *ApiKeyController {
+	return &ApiKeyController{
+		apiKeyService:   apiKeyService,
+		responseHandler: responseHandler,
+	}
+}
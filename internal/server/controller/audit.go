@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"godmin/internal/model"
+	"godmin/internal/server"
+	"godmin/internal/server/request"
+	"godmin/internal/server/response"
+	"godmin/internal/store"
+	"godmin/internal/store/query"
+	"net/http"
+	"strconv"
+)
+
+type AuditController struct {
+	responseHandler response.Handler
+	store           store.Store
+}
+
+// HandleList returns a page of audit events, the latest first unless another sort is asked for.
+// See the query package for the filter, sort, limit and cursor parameters.
+func (c *AuditController) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		values := r.URL.Query()
+		if values.Get("sort") == "" {
+			values.Set("sort", "-id")
+		}
+
+		q, err := query.Parse(values, store.AuditSchema)
+		if err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		events, page, err := c.store.Audit().List(r.Context(), q)
+		if err != nil {
+			c.responseHandler.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		res := make([]*response.AuditEvent, 0, len(events))
+		for _, e := range events {
+			res = append(res, response.NewAuditEvent(e))
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusOK, response.NewList(res, page))
+	}
+}
+
+func NewAuditController(r response.Handler, s store.Store) *AuditController {
+	return &AuditController{responseHandler: r, store: s}
+}
+
+// newAuditEvent describes an action of the request on the target, the caller is the actor when logged in
+func newAuditEvent(r *http.Request, action string, targetType string, targetID string) *model.AuditEvent {
+	client := request.NewClient(r)
+	requestID, _ := r.Context().Value(server.CtxKeyRequestID).(string)
+
+	e := &model.AuditEvent{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		RequestID:  requestID,
+	}
+	if user, ok := r.Context().Value(server.CtxKeyUser).(*response.User); ok {
+		actorID := user.ID
+		e.ActorID = &actorID
+	}
+
+	return e
+}
+
+// newUserAuditEvent describes an action on the user, changes are computed from the user before and after it
+func newUserAuditEvent(r *http.Request, action string, id uint64, before *model.User, after *model.User) *model.AuditEvent {
+	e := newAuditEvent(r, action, model.AuditTargetUser, strconv.FormatUint(id, 10))
+	e.Changes = model.NewAuditChanges(before.AuditFields(), after.AuditFields())
+
+	return e
+}
@@ -2,15 +2,20 @@ package controller
 
 import (
 	"encoding/json"
+	"godmin/internal/model"
+	"godmin/internal/server"
 	"godmin/internal/server/request"
 	"godmin/internal/server/response"
 	"godmin/internal/server/service"
 	"net/http"
+	"strconv"
 )
 
 type AuthController struct {
 	jwtService      *service.JWTService
+	mfaService      *service.MFAService
 	responseHandler response.Handler
+	auditor         *service.Auditor
 }
 
 func (c *AuthController) HandleLogin() func(http.ResponseWriter, *http.Request) {
@@ -20,8 +25,75 @@ func (c *AuthController) HandleLogin() func(http.ResponseWriter, *http.Request)
 			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
 			return
 		}
+		if err := login.Validate(); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
 
-		token, err := c.jwtService.CreateToken(login)
+		u, err := c.jwtService.CheckCredentials(r.Context(), login, request.NewClient(r))
+		if err != nil {
+			// the throttled attempts don't check the password, they aren't failures
+			if err.GetStatusCode() != http.StatusTooManyRequests {
+				c.auditor.Record(r.Context(), newAuditEvent(r, model.AuditLoginFailed, model.AuditTargetLogin, login.Email))
+			}
+			c.responseHandler.Error(w, r, err.GetStatusCode(), err.GetError())
+			return
+		}
+
+		challenge, err := c.mfaService.Challenge(r.Context(), u)
+		if err != nil {
+			c.responseHandler.Error(w, r, err.GetStatusCode(), err.GetError())
+			return
+		}
+		if challenge != nil {
+			c.responseHandler.Respond(w, r, http.StatusAccepted, challenge)
+			return
+		}
+
+		c.issueToken(w, r, u)
+	}
+}
+
+// HandleLoginMFA exchanges the MFA challenge and a code for the token pair
+func (c *AuthController) HandleLoginMFA() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := &request.LoginMFA{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		u, err := c.mfaService.VerifyChallenge(r.Context(), req)
+		if err != nil {
+			// like a wrong password, the target is the email of the user when the challenge was still valid
+			if err.GetStatusCode() != http.StatusTooManyRequests {
+				email := ""
+				if u != nil {
+					email = u.Email
+				}
+				c.auditor.Record(r.Context(), newAuditEvent(r, model.AuditLoginFailed, model.AuditTargetLogin, email))
+			}
+			c.responseHandler.Error(w, r, err.GetStatusCode(), err.GetError())
+			return
+		}
+
+		c.issueToken(w, r, u)
+	}
+}
+
+func (c *AuthController) HandleRefresh() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := &request.Refresh{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		token, err := c.jwtService.RefreshToken(r.Context(), req)
 		if err != nil {
 			c.responseHandler.Error(w, r, err.GetStatusCode(), err.GetError())
 			return
@@ -31,6 +103,13 @@ func (c *AuthController) HandleLogin() func(http.ResponseWriter, *http.Request)
 	}
 }
 
+func (c *AuthController) HandleJWKS() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		c.responseHandler.Respond(w, r, http.StatusOK, c.jwtService.JWKS())
+	}
+}
+
 func (c *AuthController) HandleLogout() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := c.jwtService.Logout(r); err != nil {
@@ -38,13 +117,37 @@ func (c *AuthController) HandleLogout() http.HandlerFunc {
 			return
 		}
 
+		user := r.Context().Value(server.CtxKeyUser).(*response.User)
+		c.auditor.Record(r.Context(), newAuditEvent(r, model.AuditLogout, model.AuditTargetUser, strconv.FormatUint(user.ID, 10)))
+
 		c.responseHandler.Respond(w, r, http.StatusOK, "Successfully logged out")
 	}
 }
 
-func NewAuthController(jwtService *service.JWTService, responseHandler response.Handler) *AuthController {
+func (c *AuthController) issueToken(w http.ResponseWriter, r *http.Request, u *model.User) {
+	token, err := c.jwtService.IssueToken(r.Context(), u, request.NewClient(r))
+	if err != nil {
+		c.responseHandler.Error(w, r, err.GetStatusCode(), err.GetError())
+		return
+	}
+
+	e := newAuditEvent(r, model.AuditLogin, model.AuditTargetUser, strconv.FormatUint(u.ID, 10))
+	e.ActorID = &u.ID
+	c.auditor.Record(r.Context(), e)
+
+	c.responseHandler.Respond(w, r, http.StatusOK, token)
+}
+
+func NewAuthController(
+	jwtService *service.JWTService,
+	mfaService *service.MFAService,
+	responseHandler response.Handler,
+	auditor *service.Auditor,
+) *AuthController {
 	return &AuthController{
 		jwtService:      jwtService,
+		mfaService:      mfaService,
 		responseHandler: responseHandler,
+		auditor:         auditor,
 	}
 }
@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"godmin/internal/server/response"
+	"godmin/internal/server/service"
+	"net/http"
+)
+
+// HealthController answers the probes of the orchestrator and the load balancer
+type HealthController struct {
+	responseHandler response.Handler
+	healthService   *service.HealthService
+}
+
+// HandleLive tells the process is alive, it doesn't depend on anything else
+func (c *HealthController) HandleLive() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.responseHandler.Respond(w, r, http.StatusOK, &response.Health{Status: response.HealthStatusUp})
+	}
+}
+
+// HandleReady tells the server can take traffic, it answers 503 with the failed checks or while draining
+func (c *HealthController) HandleReady() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+
+		health, ready := c.healthService.Ready(r.Context())
+		if !ready {
+			c.responseHandler.Respond(w, r, http.StatusServiceUnavailable, health)
+			return
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusOK, health)
+	}
+}
+
+func NewHealthController(r response.Handler, h *service.HealthService) *HealthController {
+	return &HealthController{responseHandler: r, healthService: h}
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"encoding/json"
+	"godmin/internal/server"
+	"godmin/internal/server/request"
+	"godmin/internal/server/response"
+	"godmin/internal/server/service"
+	"net/http"
+)
+
+type MFAController struct {
+	mfaService      *service.MFAService
+	responseHandler response.Handler
+}
+
+// HandleEnroll generates a TOTP secret and the otpauth:// URI for the caller
+func (c *MFAController) HandleEnroll() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value(server.CtxKeyUser).(*response.User)
+
+		enrollment, err := c.mfaService.Enroll(r.Context(), user)
+		if err != nil {
+			c.responseHandler.Error(w, r, err.GetStatusCode(), err.GetError())
+			return
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusCreated, enrollment)
+	}
+}
+
+// HandleConfirm enables two-factor authentication once the caller proves the authenticator app works
+func (c *MFAController) HandleConfirm() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value(server.CtxKeyUser).(*response.User)
+
+		req := &request.TOTPConfirm{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		codes, err := c.mfaService.Confirm(r.Context(), user.ID, req)
+		if err != nil {
+			c.responseHandler.Error(w, r, err.GetStatusCode(), err.GetError())
+			return
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusOK, codes)
+	}
+}
+
+// HandleDisable turns two-factor authentication off, with the current password and a code or recovery code
+func (c *MFAController) HandleDisable() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value(server.CtxKeyUser).(*response.User)
+
+		req := &request.MFADisable{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := c.mfaService.Disable(r.Context(), user.ID, req); err != nil {
+			c.responseHandler.Error(w, r, err.GetStatusCode(), err.GetError())
+			return
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusNoContent, nil)
+	}
+}
+
+func NewMFAController(mfaService *service.MFAService, responseHandler response.Handler) *MFAController {
+	return &MFAController{
+		mfaService:      mfaService,
+		responseHandler: responseHandler,
+	}
+}
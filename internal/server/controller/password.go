@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"encoding/json"
+	"godmin/internal/server/request"
+	"godmin/internal/server/response"
+	"godmin/internal/server/service"
+	"net/http"
+)
+
+type PasswordController struct {
+	passwordService *service.PasswordService
+	responseHandler response.Handler
+}
+
+// HandleForgot sends a reset link, it answers the same whether the email has an account or not
+func (c *PasswordController) HandleForgot() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := &request.PasswordForgot{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := c.passwordService.Forgot(r.Context(), req, request.NewClient(r)); err != nil {
+			c.responseHandler.Error(w, r, err.GetStatusCode(), err.GetError())
+			return
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusAccepted, nil)
+	}
+}
+
+// HandleReset sets the new password with the token of the reset link
+func (c *PasswordController) HandleReset() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := &request.PasswordReset{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := c.passwordService.Reset(r.Context(), req); err != nil {
+			c.responseHandler.Error(w, r, err.GetStatusCode(), err.GetError())
+			return
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusNoContent, nil)
+	}
+}
+
+func NewPasswordController(passwordService *service.PasswordService, responseHandler response.Handler) *PasswordController {
+	return &PasswordController{
+		passwordService: passwordService,
+		responseHandler: responseHandler,
+	}
+}
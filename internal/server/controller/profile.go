@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"encoding/json"
+	"godmin/internal/model"
+	"godmin/internal/server"
+	"godmin/internal/server/request"
+	"godmin/internal/server/response"
+	"godmin/internal/server/service"
+	"godmin/internal/store"
+	"net/http"
+)
+
+// ProfileController lets the logged in users manage their own account, no permission is needed
+type ProfileController struct {
+	responseHandler     response.Handler
+	store               store.Store
+	passwordService     *service.PasswordService
+	verificationService *service.VerificationService
+	auditor             *service.Auditor
+}
+
+// HandleUpdate changes the name of the caller
+func (c *ProfileController) HandleUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := &request.ProfileUpdate{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		current, ok := c.currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		u, err := c.store.User().Update(r.Context(), current.ID, &model.UserChanges{Name: &req.Name})
+		if err != nil {
+			c.storeError(w, r, err)
+			return
+		}
+		c.auditor.Record(r.Context(), newUserAuditEvent(r, model.AuditUserUpdate, u.ID, current, u))
+
+		c.responseHandler.Respond(w, r, http.StatusOK, response.NewUser(u))
+	}
+}
+
+// HandleChangePassword sets a new password of the caller and revokes their other sessions
+func (c *ProfileController) HandleChangePassword() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := &request.PasswordChange{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		u, ok := c.currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		current, _ := r.Context().Value(server.CtxKeySessionID).(string)
+		revoked, err := c.passwordService.ChangeOwn(r.Context(), u, req, current)
+		if err != nil {
+			c.responseHandler.Error(w, r, err.GetStatusCode(), err.GetError())
+			return
+		}
+
+		e := newUserAuditEvent(r, model.AuditUserUpdate, u.ID, nil, nil)
+		e.Changes["password"] = &model.AuditChange{Before: model.AuditRedacted, After: model.AuditRedacted}
+		c.auditor.Record(r.Context(), e)
+
+		c.responseHandler.Respond(w, r, http.StatusOK, &response.SessionsRevoked{Revoked: revoked})
+	}
+}
+
+// HandleChangeEmail sends a confirmation link to the new email, the caller keeps the current one until it is followed
+func (c *ProfileController) HandleChangeEmail() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := &request.EmailChange{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		u, ok := c.currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		if err := c.verificationService.RequestEmailChange(r.Context(), u, req); err != nil {
+			c.responseHandler.Error(w, r, err.GetStatusCode(), err.GetError())
+			return
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusAccepted, nil)
+	}
+}
+
+// currentUser loads the caller with their password hash, which the context doesn't carry
+func (c *ProfileController) currentUser(w http.ResponseWriter, r *http.Request) (*model.User, bool) {
+	user := r.Context().Value(server.CtxKeyUser).(*response.User)
+
+	u, err := c.store.User().Find(r.Context(), user.ID)
+	if err != nil {
+		c.storeError(w, r, err)
+		return nil, false
+	}
+
+	return u, true
+}
+
+func (c *ProfileController) storeError(w http.ResponseWriter, r *http.Request, err error) {
+	if err == store.ErrRecordNotFound {
+		c.responseHandler.Error(w, r, http.StatusNotFound, errUserNotFound)
+		return
+	}
+
+	c.responseHandler.Error(w, r, http.StatusInternalServerError, err)
+}
+
+func NewProfileController(
+	r response.Handler,
+	s store.Store,
+	p *service.PasswordService,
+	v *service.VerificationService,
+	a *service.Auditor,
+) *ProfileController {
+	return &ProfileController{
+		responseHandler:     r,
+		store:               s,
+		passwordService:     p,
+		verificationService: v,
+		auditor:             a,
+	}
+}
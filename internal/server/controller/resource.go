@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"godmin/admin"
+	"godmin/internal/server/response"
+	"godmin/internal/store"
+	"godmin/internal/store/query"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+var errRecordNotFound = errors.New("record not found")
+
+// ResourceIndexController describes the registered resources
+type ResourceIndexController struct {
+	responseHandler response.Handler
+	resources       []*admin.Resource
+}
+
+func (c *ResourceIndexController) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res := make([]*response.Resource, 0, len(c.resources))
+		for _, resource := range c.resources {
+			res = append(res, response.NewResource(resource))
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusOK, res)
+	}
+}
+
+func NewResourceIndexController(r response.Handler, resources []*admin.Resource) *ResourceIndexController {
+	return &ResourceIndexController{responseHandler: r, resources: resources}
+}
+
+// ResourceController serves the generic routes of a registered admin.Resource
+type ResourceController struct {
+	responseHandler response.Handler
+	resource        *admin.Resource
+	repository      store.ResourceRepository
+}
+
+func (c *ResourceController) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := query.Parse(r.URL.Query(), c.resource.Schema())
+		if err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		items, page, err := c.repository.List(r.Context(), q)
+		if err != nil {
+			c.storeError(w, r, err)
+			return
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusOK, response.NewList(items, page))
+	}
+}
+
+func (c *ResourceController) HandleShow() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := c.id(w, r)
+		if !ok {
+			return
+		}
+
+		item, err := c.repository.Find(r.Context(), id)
+		if err != nil {
+			c.storeError(w, r, err)
+			return
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusOK, item)
+	}
+}
+
+func (c *ResourceController) HandleCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		values, ok := c.values(w, r, false)
+		if !ok {
+			return
+		}
+
+		item, err := c.repository.Create(r.Context(), values)
+		if err != nil {
+			c.storeError(w, r, err)
+			return
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusCreated, item)
+	}
+}
+
+// HandleUpdate partially updates the record, only the fields present in the body are changed
+func (c *ResourceController) HandleUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := c.id(w, r)
+		if !ok {
+			return
+		}
+
+		values, ok := c.values(w, r, true)
+		if !ok {
+			return
+		}
+
+		item, err := c.repository.Update(r.Context(), id, values)
+		if err != nil {
+			c.storeError(w, r, err)
+			return
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusOK, item)
+	}
+}
+
+func (c *ResourceController) HandleDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := c.id(w, r)
+		if !ok {
+			return
+		}
+
+		if err := c.repository.Delete(r.Context(), id); err != nil {
+			c.storeError(w, r, err)
+			return
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusNoContent, nil)
+	}
+}
+
+func (c *ResourceController) id(w http.ResponseWriter, r *http.Request) (interface{}, bool) {
+	id, err := c.resource.ID(mux.Vars(r)["id"])
+	if err != nil {
+		c.responseHandler.Error(w, r, http.StatusNotFound, errRecordNotFound)
+		return nil, false
+	}
+
+	return id, true
+}
+
+func (c *ResourceController) values(w http.ResponseWriter, r *http.Request, partial bool) (map[string]interface{}, bool) {
+	body := map[string]interface{}{}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	values, err := c.resource.Values(body, partial)
+	if err != nil {
+		c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	return values, true
+}
+
+// storeError maps the store errors to the response status
+func (c *ResourceController) storeError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrRecordNotFound):
+		c.responseHandler.Error(w, r, http.StatusNotFound, errRecordNotFound)
+	case errors.Is(err, store.ErrConstraintViolation):
+		c.responseHandler.Error(w, r, http.StatusUnprocessableEntity, err)
+	default:
+		c.responseHandler.Error(w, r, http.StatusInternalServerError, err)
+	}
+}
+
+func NewResourceController(r response.Handler, s store.Store, res *admin.Resource) *ResourceController {
+	return &ResourceController{
+		responseHandler: r,
+		resource:        res,
+		repository:      s.Resource(res.Schema(), res.Columns()),
+	}
+}
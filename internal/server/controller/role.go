@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"errors"
+	"godmin/internal/model"
+	"godmin/internal/server/response"
+	"godmin/internal/server/service"
+	"godmin/internal/store"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	errUserNotFound = errors.New("user not found")
+	errRoleNotFound = errors.New("role not found")
+)
+
+type RoleController struct {
+	responseHandler response.Handler
+	store           store.Store
+	auditor         *service.Auditor
+}
+
+func (c *RoleController) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roles, err := c.store.Role().FindAll(r.Context())
+		if err != nil {
+			c.responseHandler.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		res := make([]*response.Role, 0, len(roles))
+		for _, role := range roles {
+			res = append(res, response.NewRole(role))
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusOK, res)
+	}
+}
+
+// HandleGrant grants the role to the user
+func (c *RoleController) HandleGrant() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := c.findUserID(w, r)
+		if !ok {
+			return
+		}
+
+		role := mux.Vars(r)["role"]
+		err := c.store.Role().Grant(r.Context(), userID, role)
+		if err == store.ErrRecordNotFound {
+			c.responseHandler.Error(w, r, http.StatusNotFound, errRoleNotFound)
+			return
+		}
+		if err != nil {
+			c.responseHandler.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		e := newAuditEvent(r, model.AuditRoleGrant, model.AuditTargetUser, strconv.FormatUint(userID, 10))
+		e.Changes = map[string]*model.AuditChange{"role": {After: role}}
+		c.auditor.Record(r.Context(), e)
+
+		c.responseHandler.Respond(w, r, http.StatusNoContent, nil)
+	}
+}
+
+// HandleRevoke revokes the role from the user
+func (c *RoleController) HandleRevoke() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := c.findUserID(w, r)
+		if !ok {
+			return
+		}
+
+		role := mux.Vars(r)["role"]
+		err := c.store.Role().Revoke(r.Context(), userID, role)
+		if err == store.ErrRecordNotFound {
+			c.responseHandler.Error(w, r, http.StatusNotFound, errRoleNotFound)
+			return
+		}
+		if err != nil {
+			c.responseHandler.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		e := newAuditEvent(r, model.AuditRoleRevoke, model.AuditTargetUser, strconv.FormatUint(userID, 10))
+		e.Changes = map[string]*model.AuditChange{"role": {Before: role}}
+		c.auditor.Record(r.Context(), e)
+
+		c.responseHandler.Respond(w, r, http.StatusNoContent, nil)
+	}
+}
+
+// findUserID makes sure the user from the URL exists
+func (c *RoleController) findUserID(w http.ResponseWriter, r *http.Request) (uint64, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+		return 0, false
+	}
+
+	u, err := c.store.User().Find(r.Context(), id)
+	if err == store.ErrRecordNotFound {
+		c.responseHandler.Error(w, r, http.StatusNotFound, errUserNotFound)
+		return 0, false
+	}
+	if err != nil {
+		c.responseHandler.Error(w, r, http.StatusInternalServerError, err)
+		return 0, false
+	}
+
+	return u.ID, true
+}
+
+func NewRoleController(r response.Handler, s store.Store, a *service.Auditor) *RoleController {
+	return &RoleController{responseHandler: r, store: s, auditor: a}
+}
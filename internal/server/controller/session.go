@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"errors"
+	"godmin/internal/dto"
+	"godmin/internal/model"
+	"godmin/internal/server"
+	"godmin/internal/server/response"
+	"godmin/internal/server/service"
+	"godmin/internal/store"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+var errSessionNotFound = errors.New("session not found")
+
+type SessionController struct {
+	responseHandler response.Handler
+	memoryStore     store.MemoryStore
+	auditor         *service.Auditor
+}
+
+// HandleList lists the caller's active sessions
+func (c *SessionController) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value(server.CtxKeyUser).(*response.User)
+		current, _ := r.Context().Value(server.CtxKeySessionID).(string)
+
+		families, err := c.memoryStore.Token().FindUserFamilies(r.Context(), user.ID)
+		if err != nil {
+			c.responseHandler.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		sessions := make([]*response.Session, 0, len(families))
+		for _, f := range families {
+			sessions = append(sessions, response.NewSession(f, current))
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusOK, sessions)
+	}
+}
+
+// HandleShow returns one of the caller's sessions
+func (c *SessionController) HandleShow() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		current, _ := r.Context().Value(server.CtxKeySessionID).(string)
+
+		f, ok := c.findOwnSession(w, r)
+		if !ok {
+			return
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusOK, response.NewSession(f, current))
+	}
+}
+
+// HandleRevoke revokes one of the caller's sessions
+func (c *SessionController) HandleRevoke() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f, ok := c.findOwnSession(w, r)
+		if !ok {
+			return
+		}
+
+		if err := c.memoryStore.Token().RevokeFamily(r.Context(), f.ID); err != nil && err != store.ErrRecordNotFound {
+			c.responseHandler.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusNoContent, nil)
+	}
+}
+
+// HandleRevokeAll logs the caller out everywhere, the current session included
+func (c *SessionController) HandleRevokeAll() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value(server.CtxKeyUser).(*response.User)
+		c.revokeUserSessions(w, r, user.ID)
+	}
+}
+
+// HandleRevokeUser revokes every session of any user
+func (c *SessionController) HandleRevokeUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		c.revokeUserSessions(w, r, userID)
+	}
+}
+
+// revokeUserSessions records the revocation with the number of sessions revoked, like godmin token revoke --user
+func (c *SessionController) revokeUserSessions(w http.ResponseWriter, r *http.Request, userID uint64) {
+	revoked, err := c.memoryStore.Token().RevokeUserFamilies(r.Context(), userID)
+	if err != nil {
+		c.responseHandler.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	e := newAuditEvent(r, model.AuditSessionsRevoke, model.AuditTargetUser, strconv.FormatUint(userID, 10))
+	e.Changes = map[string]*model.AuditChange{"revoked": {After: revoked}}
+	c.auditor.Record(r.Context(), e)
+
+	c.responseHandler.Respond(w, r, http.StatusOK, &response.SessionsRevoked{Revoked: revoked})
+}
+
+// findOwnSession loads the session from the URL and makes sure it belongs to the caller
+func (c *SessionController) findOwnSession(w http.ResponseWriter, r *http.Request) (*dto.TokenFamily, bool) {
+	user := r.Context().Value(server.CtxKeyUser).(*response.User)
+
+	f, err := c.memoryStore.Token().FindFamily(r.Context(), mux.Vars(r)["id"])
+	if err == store.ErrRecordNotFound || (err == nil && f.UserID != user.ID) {
+		c.responseHandler.Error(w, r, http.StatusNotFound, errSessionNotFound)
+		return nil, false
+	}
+	if err != nil {
+		c.responseHandler.Error(w, r, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	return f, true
+}
+
+func NewSessionController(r response.Handler, s store.MemoryStore, a *service.Auditor) *SessionController {
+	return &SessionController{responseHandler: r, memoryStore: s, auditor: a}
+}
@@ -6,13 +6,24 @@ import (
 	"godmin/internal/server"
 	"godmin/internal/server/request"
 	"godmin/internal/server/response"
-	"godmin/internal/store/sqlstore"
+	"godmin/internal/server/service"
+	"godmin/internal/store"
+	"godmin/internal/store/query"
 	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
 )
 
 type UserController struct {
-	responseHandler response.Handler
-	store           *sqlstore.Store
+	responseHandler     response.Handler
+	store               store.Store
+	memoryStore         store.MemoryStore
+	verificationService *service.VerificationService
+	loginThrottle       *service.LoginThrottle
+	passwordService     *service.PasswordService
+	auditor             *service.Auditor
 }
 
 func (c *UserController) UserCreateHandle() func(w http.ResponseWriter, r *http.Request) {
@@ -32,21 +43,299 @@ func (c *UserController) UserCreateHandle() func(w http.ResponseWriter, r *http.
 			Email:    req.Email,
 			Password: req.Password,
 		}
+		if err := c.passwordService.Check(r.Context(), u, req.Password); err != nil {
+			c.responseHandler.Error(w, r, err.GetStatusCode(), err.GetError())
+			return
+		}
 
-		if err := c.store.User().Create(u); err != nil {
-			c.responseHandler.Error(w, r, http.StatusUnprocessableEntity, err)
+		if err := c.store.User().Create(r.Context(), u); err != nil {
+			c.storeError(w, r, err)
+			return
 		}
+		c.verificationService.Notify(u)
+		c.auditor.Record(r.Context(), newUserAuditEvent(r, model.AuditUserCreate, u.ID, nil, u))
 
 		c.responseHandler.Respond(w, r, http.StatusCreated, response.NewUser(u))
 	}
 }
 
+// HandleVerify verifies the email with the token of the verification link
+func (c *UserController) HandleVerify() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, err := c.verificationService.Verify(r.Context(), r.URL.Query().Get("token"))
+		if err != nil {
+			c.responseHandler.Error(w, r, err.GetStatusCode(), err.GetError())
+			return
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusOK, response.NewUser(u))
+	}
+}
+
+// HandleConfirmEmail switches the user to the new email with the token of the confirmation link
+func (c *UserController) HandleConfirmEmail() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		before, u, err := c.verificationService.ConfirmEmailChange(r.Context(), r.URL.Query().Get("token"))
+		if err != nil {
+			c.responseHandler.Error(w, r, err.GetStatusCode(), err.GetError())
+			return
+		}
+
+		// following the link proves the user made the change
+		e := newUserAuditEvent(r, model.AuditUserUpdate, u.ID, before, u)
+		e.ActorID = &u.ID
+		c.auditor.Record(r.Context(), e)
+
+		c.responseHandler.Respond(w, r, http.StatusOK, response.NewUser(u))
+	}
+}
+
+// HandleResendVerification sends a new verification link, it answers the same whether the email has an account or not
+func (c *UserController) HandleResendVerification() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := &request.VerificationResend{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := c.verificationService.Resend(r.Context(), req, request.NewClient(r)); err != nil {
+			c.responseHandler.Error(w, r, err.GetStatusCode(), err.GetError())
+			return
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusAccepted, nil)
+	}
+}
+
+// HandleList returns a page of users, see the query package for the filter, sort, limit and cursor parameters
+func (c *UserController) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := query.Parse(r.URL.Query(), store.UserSchema)
+		if err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		users, page, err := c.store.User().List(r.Context(), q)
+		if err != nil {
+			c.storeError(w, r, err)
+			return
+		}
+
+		res := make([]*response.User, 0, len(users))
+		for _, u := range users {
+			res = append(res, response.NewUser(u))
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusOK, response.NewList(res, page))
+	}
+}
+
+func (c *UserController) HandleShow() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := c.userID(w, r)
+		if !ok {
+			return
+		}
+
+		u, err := c.store.User().Find(r.Context(), id)
+		if err != nil {
+			c.storeError(w, r, err)
+			return
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusOK, response.NewUser(u))
+	}
+}
+
+// HandleUpdate partially updates the user, only the fields present in the body are changed
+func (c *UserController) HandleUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := c.userID(w, r)
+		if !ok {
+			return
+		}
+
+		req := &request.UserUpdate{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		current, err := c.store.User().Find(r.Context(), id)
+		if err != nil {
+			c.storeError(w, r, err)
+			return
+		}
+
+		if req.Password != nil {
+			// the policy applies to the name and email the user is about to have
+			checked := *current
+			if req.Name != nil {
+				checked.Name = *req.Name
+			}
+			if req.Email != nil {
+				checked.Email = *req.Email
+			}
+			if err := c.passwordService.Check(r.Context(), &checked, *req.Password); err != nil {
+				c.responseHandler.Error(w, r, err.GetStatusCode(), err.GetError())
+				return
+			}
+		}
+
+		u, updateErr := c.passwordService.UpdateUser(r.Context(), id, &model.UserChanges{
+			Name:     req.Name,
+			Email:    req.Email,
+			Password: req.Password,
+		})
+		if updateErr != nil {
+			c.responseHandler.Error(w, r, updateErr.GetStatusCode(), updateErr.GetError())
+			return
+		}
+		// the new email has to be verified again
+		if u.Email != current.Email {
+			c.verificationService.Notify(u)
+		}
+
+		e := newUserAuditEvent(r, model.AuditUserUpdate, id, current, u)
+		if req.Password != nil {
+			e.Changes["password"] = &model.AuditChange{Before: model.AuditRedacted, After: model.AuditRedacted}
+		}
+		c.auditor.Record(r.Context(), e)
+
+		c.responseHandler.Respond(w, r, http.StatusOK, response.NewUser(u))
+	}
+}
+
+// HandleDelete deletes the user and revokes their sessions, their refresh tokens can't be used any more
+func (c *UserController) HandleDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := c.userID(w, r)
+		if !ok {
+			return
+		}
+
+		u, err := c.store.User().Find(r.Context(), id)
+		if err != nil {
+			c.storeError(w, r, err)
+			return
+		}
+
+		if err := c.store.User().Delete(r.Context(), u); err != nil {
+			c.storeError(w, r, err)
+			return
+		}
+		c.auditor.Record(r.Context(), newUserAuditEvent(r, model.AuditUserDelete, id, u, nil))
+
+		revoked, err := c.memoryStore.Token().RevokeUserFamilies(r.Context(), id)
+		if err != nil {
+			c.responseHandler.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		log.WithFields(log.Fields{
+			"user_id":  id,
+			"sessions": revoked,
+		}).Info("user deleted, sessions revoked")
+
+		c.responseHandler.Respond(w, r, http.StatusNoContent, nil)
+	}
+}
+
+// HandleUnlock lifts the lock of the user's account after too many failed logins
+func (c *UserController) HandleUnlock() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := c.userID(w, r)
+		if !ok {
+			return
+		}
+
+		u, err := c.store.User().Find(r.Context(), id)
+		if err != nil {
+			c.storeError(w, r, err)
+			return
+		}
+
+		if err := c.loginThrottle.Unlock(r.Context(), u.ID, u.Email); err != nil {
+			c.responseHandler.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		c.auditor.Record(r.Context(), newAuditEvent(r, model.AuditUserUnlock, model.AuditTargetUser, strconv.FormatUint(id, 10)))
+
+		c.responseHandler.Respond(w, r, http.StatusNoContent, nil)
+	}
+}
+
 func (c *UserController) HandleWhoami() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		c.responseHandler.Respond(w, r, http.StatusOK, r.Context().Value(server.CtxKeyUser).(*response.User))
+		user := r.Context().Value(server.CtxKeyUser).(*response.User)
+
+		roles, err := c.store.Role().FindNamesByUser(r.Context(), user.ID)
+		if err != nil {
+			c.responseHandler.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		permissions, err := c.store.Role().FindPermissionsByUser(r.Context(), user.ID)
+		if err != nil {
+			c.responseHandler.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		c.responseHandler.Respond(w, r, http.StatusOK, &response.Whoami{
+			User:        user,
+			Roles:       roles,
+			Permissions: permissions,
+		})
 	}
 }
 
-func NewUserController(r response.Handler, s *sqlstore.Store) *UserController {
-	return &UserController{responseHandler: r, store: s}
+func (c *UserController) userID(w http.ResponseWriter, r *http.Request) (uint64, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		c.responseHandler.Error(w, r, http.StatusBadRequest, err)
+		return 0, false
+	}
+
+	return id, true
+}
+
+// storeError maps the store errors to the response status
+func (c *UserController) storeError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case store.ErrRecordNotFound:
+		c.responseHandler.Error(w, r, http.StatusNotFound, errUserNotFound)
+	case store.ErrEmailUsed:
+		c.responseHandler.Error(w, r, http.StatusUnprocessableEntity, err)
+	default:
+		c.responseHandler.Error(w, r, http.StatusInternalServerError, err)
+	}
+}
+
+func NewUserController(
+	r response.Handler,
+	s store.Store,
+	m store.MemoryStore,
+	v *service.VerificationService,
+	t *service.LoginThrottle,
+	p *service.PasswordService,
+	a *service.Auditor,
+) *UserController {
+	return &UserController{
+		responseHandler:     r,
+		store:               s,
+		memoryStore:         m,
+		verificationService: v,
+		loginThrottle:       t,
+		passwordService:     p,
+		auditor:             a,
+	}
 }
@@ -5,8 +5,10 @@ import (
 	"github.com/go-redis/redis/v7"
 	"github.com/jmoiron/sqlx"
 	log "github.com/sirupsen/logrus"
+	"godmin/admin"
 	"godmin/config"
 	"godmin/internal/server/service"
+	"godmin/internal/store"
 	"godmin/internal/store/memorystore"
 	"godmin/internal/store/sqlstore"
 )
@@ -16,12 +18,22 @@ type ctxKey int8
 const (
 	CtxKeyUser      ctxKey = iota
 	CtxKeyRequestID ctxKey = iota
+	CtxKeySessionID ctxKey = iota
+	CtxKeyApiKey    ctxKey = iota
 )
 
 type ServiceContainer interface {
-	SqlStore() *sqlstore.Store
-	MemoryStore() *memorystore.Store
+	SqlStore() store.Store
+	MemoryStore() store.MemoryStore
 	JwtService() *service.JWTService
+	MfaService() *service.MFAService
+	ApiKeyService() *service.ApiKeyService
+	PasswordService() *service.PasswordService
+	VerificationService() *service.VerificationService
+	LoginThrottle() *service.LoginThrottle
+	Auditor() *service.Auditor
+	Health() *service.HealthService
+	Resources() []*admin.Resource
 }
 
 type Connections struct {
@@ -2,35 +2,77 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"godmin/internal/model"
 	"godmin/internal/server"
 	"godmin/internal/server/response"
 	"godmin/internal/server/service"
 	"net/http"
 )
 
+var errApiKeyNotAllowed = errors.New("API keys can't be used here, log in instead")
+
 type JwtAuth struct {
 	jwtService      *service.JWTService
+	apiKeyService   *service.ApiKeyService
 	responseHandler response.Handler
 }
 
-// JwtAuthentication verify authentication by JWT
+// JwtAuthentication verify authentication by JWT or, for `Bearer gmn_...` tokens, by API key
 func (j *JwtAuth) JwtAuthentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		u, err := j.jwtService.Authenticate(r)
+		if service.IsApiKey(r) {
+			j.apiKeyAuthentication(next, w, r)
+			return
+		}
+
+		u, sessionID, err := j.jwtService.Authenticate(r)
 		if err != nil {
 			j.responseHandler.Error(w, r, err.GetStatusCode(), err.GetError())
 			return
 		}
 
-		user := response.NewUser(u)
+		ctx := context.WithValue(r.Context(), server.CtxKeyUser, response.NewUser(u))
+		ctx = context.WithValue(ctx, server.CtxKeySessionID, sessionID)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireSession refuses the requests authenticated by an API key. The keys can't manage the keys, the sessions
+// or the account of their user, so a scoped key can't mint itself an unrestricted one.
+func (j *JwtAuth) RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(server.CtxKeyApiKey).(*model.ApiKey); ok {
+			j.responseHandler.Error(w, r, http.StatusForbidden, errApiKeyNotAllowed)
+			return
+		}
 
-		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), server.CtxKeyUser, user)))
+		next.ServeHTTP(w, r)
 	})
 }
 
-func NewJwtAuth(jwtService *service.JWTService, responseHandler response.Handler) *JwtAuth {
+func (j *JwtAuth) apiKeyAuthentication(next http.Handler, w http.ResponseWriter, r *http.Request) {
+	u, k, err := j.apiKeyService.Authenticate(r)
+	if err != nil {
+		j.responseHandler.Error(w, r, err.GetStatusCode(), err.GetError())
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), server.CtxKeyUser, response.NewUser(u))
+	ctx = context.WithValue(ctx, server.CtxKeyApiKey, k)
+
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func NewJwtAuth(
+	jwtService *service.JWTService,
+	apiKeyService *service.ApiKeyService,
+	responseHandler response.Handler,
+) *JwtAuth {
 	return &JwtAuth{
 		jwtService:      jwtService,
+		apiKeyService:   apiKeyService,
 		responseHandler: responseHandler,
 	}
 }
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"errors"
+	"godmin/internal/model"
+	"godmin/internal/server"
+	"godmin/internal/server/response"
+	"godmin/internal/store"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+var errForbidden = errors.New("forbidden")
+
+type Authorization struct {
+	store           store.Store
+	responseHandler response.Handler
+}
+
+// RequirePermission allows the request only if the authenticated user has the permission through one of their roles.
+// Requests authenticated by an API key also need the key to be granted the permission as a scope.
+func (a *Authorization) RequirePermission(permission string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := r.Context().Value(server.CtxKeyUser).(*response.User)
+
+			if k, ok := r.Context().Value(server.CtxKeyApiKey).(*model.ApiKey); ok && !k.HasScope(permission) {
+				a.responseHandler.Error(w, r, http.StatusForbidden, errForbidden)
+				return
+			}
+
+			permissions, err := a.store.Role().FindPermissionsByUser(r.Context(), user.ID)
+			if err != nil {
+				a.responseHandler.Error(w, r, http.StatusInternalServerError, err)
+				return
+			}
+
+			for _, p := range permissions {
+				if p == permission {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			a.responseHandler.Error(w, r, http.StatusForbidden, errForbidden)
+		})
+	}
+}
+
+func NewAuthorization(store store.Store, responseHandler response.Handler) *Authorization {
+	return &Authorization{
+		store:           store,
+		responseHandler: responseHandler,
+	}
+}
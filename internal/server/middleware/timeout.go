@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	"godmin/config"
+	"godmin/internal/server/response"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	errTimeout     = errors.New("the request took too long")
+	errUnavailable = errors.New("the request was cancelled")
+)
+
+type Timeout struct {
+	config          *config.Timeout
+	responseHandler response.Handler
+}
+
+// Deadline bounds the handling of the request by the timeout of its route, the context of the request is cancelled
+// at the deadline so the queries in progress stop. The response is buffered until the handler returns,
+// past the deadline it is dropped for a 504. A request cancelled before, because the client is gone
+// or the server is shutting down, is answered with 503.
+func (t *Timeout) Deadline(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d := t.For(r)
+		if d <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+
+		tw := &timeoutWriter{header: w.Header().Clone(), code: http.StatusOK}
+		done := make(chan struct{})
+		panicked := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+			next.ServeHTTP(tw, r.WithContext(ctx))
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			panic(p)
+		case <-done:
+			if ctx.Err() == nil {
+				tw.flush(w)
+				return
+			}
+		case <-ctx.Done():
+		}
+
+		tw.expire()
+		if r.Context().Err() != nil {
+			t.responseHandler.Error(w, r, http.StatusServiceUnavailable, errUnavailable)
+			return
+		}
+		t.responseHandler.Error(w, r, http.StatusGatewayTimeout, errTimeout)
+	})
+}
+
+// For returns the timeout of the route of the request, the one of its method first
+func (t *Timeout) For(r *http.Request) time.Duration {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return t.config.Request
+	}
+
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return t.config.Request
+	}
+
+	if d, ok := t.config.Routes[r.Method+" "+template]; ok {
+		return d
+	}
+	if d, ok := t.config.Routes[template]; ok {
+		return d
+	}
+
+	return t.config.Request
+}
+
+func NewTimeout(config *config.Timeout, responseHandler response.Handler) *Timeout {
+	return &Timeout{
+		config:          config,
+		responseHandler: responseHandler,
+	}
+}
+
+// timeoutWriter buffers the response of the handler, the writes after the deadline fail with http.ErrHandlerTimeout
+type timeoutWriter struct {
+	mu      sync.Mutex
+	header  http.Header
+	body    bytes.Buffer
+	code    int
+	written bool
+	expired bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.expired {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.written = true
+
+	return tw.body.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.expired || tw.written {
+		return
+	}
+	tw.written = true
+	tw.code = code
+}
+
+func (tw *timeoutWriter) expire() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	tw.expired = true
+}
+
+// flush writes the buffered response, the handler has returned
+func (tw *timeoutWriter) flush(w http.ResponseWriter) {
+	dst := w.Header()
+	for k, v := range tw.header {
+		dst[k] = v
+	}
+	w.WriteHeader(tw.code)
+	_, _ = w.Write(tw.body.Bytes())
+}
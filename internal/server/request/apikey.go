@@ -0,0 +1,25 @@
+package request
+
+import (
+	"regexp"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+var scopeRegexp = regexp.MustCompile(`^[a-z][a-z0-9_]*:[a-z_]+$`)
+
+type ApiKeyCreate struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (a *ApiKeyCreate) Validate() error {
+	return validation.ValidateStruct(
+		a,
+		validation.Field(&a.Name, validation.Required, validation.Length(1, 100)),
+		validation.Field(&a.Scopes, validation.Each(validation.Required, validation.Match(scopeRegexp))),
+		validation.Field(&a.ExpiresAt, validation.Min(time.Now()).Error("must be in the future")),
+	)
+}
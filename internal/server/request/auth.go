@@ -1,6 +1,24 @@
 package request
 
+import (
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+)
+
 type Login struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
+
+// Validate bounds the email, it is the target of the failed login in the audit log
+func (l *Login) Validate() error {
+	return validation.ValidateStruct(
+		l,
+		validation.Field(&l.Email, validation.Required, is.Email),
+		validation.Field(&l.Password, validation.Required),
+	)
+}
+
+type Refresh struct {
+	RefreshToken string `json:"refresh_token"`
+}
@@ -0,0 +1,20 @@
+package request
+
+import (
+	"godmin/internal/dto"
+	"net"
+	"net/http"
+)
+
+// NewClient extracts the client address and User-Agent from the request
+func NewClient(r *http.Request) *dto.Client {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return &dto.Client{
+		IP:        ip,
+		UserAgent: r.UserAgent(),
+	}
+}
@@ -0,0 +1,62 @@
+package request
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+)
+
+type TOTPConfirm struct {
+	Code string `json:"code"`
+}
+
+func (t *TOTPConfirm) Validate() error {
+	return validation.ValidateStruct(
+		t,
+		validation.Field(&t.Code, validation.Required, is.Digit, validation.Length(6, 6)),
+	)
+}
+
+// MFACode is either a code from the authenticator app or one of the recovery codes
+type MFACode struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+func (m *MFACode) Validate() error {
+	return validation.ValidateStruct(
+		m,
+		validation.Field(
+			&m.Code,
+			validation.By(RequiredIf(m.RecoveryCode == "")),
+			is.Digit,
+			validation.Length(6, 6),
+		),
+	)
+}
+
+// MFADisable turns two-factor authentication off, the caller proves they know the password and have a code
+type MFADisable struct {
+	CurrentPassword string `json:"current_password"`
+	MFACode
+}
+
+func (m *MFADisable) Validate() error {
+	return validation.ValidateStruct(
+		m,
+		validation.Field(&m.CurrentPassword, validation.Required),
+		validation.Field(&m.MFACode),
+	)
+}
+
+type LoginMFA struct {
+	MFAToken string `json:"mfa_token"`
+	MFACode
+}
+
+func (l *LoginMFA) Validate() error {
+	return validation.ValidateStruct(
+		l,
+		validation.Field(&l.MFAToken, validation.Required),
+		validation.Field(&l.MFACode),
+	)
+}
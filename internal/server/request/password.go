@@ -0,0 +1,31 @@
+package request
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+)
+
+type PasswordForgot struct {
+	Email string `json:"email"`
+}
+
+func (p *PasswordForgot) Validate() error {
+	return validation.ValidateStruct(
+		p,
+		validation.Field(&p.Email, validation.Required, is.Email),
+	)
+}
+
+// PasswordReset sets a new password with the token of the reset link
+type PasswordReset struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (p *PasswordReset) Validate() error {
+	return validation.ValidateStruct(
+		p,
+		validation.Field(&p.Token, validation.Required),
+		validation.Field(&p.Password, validation.Required),
+	)
+}
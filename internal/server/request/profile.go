@@ -0,0 +1,47 @@
+package request
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+)
+
+// ProfileUpdate is what users may change of their own account directly
+type ProfileUpdate struct {
+	Name string `json:"name"`
+}
+
+func (p *ProfileUpdate) Validate() error {
+	return validation.ValidateStruct(
+		p,
+		validation.Field(&p.Name, validation.Required, validation.Length(2, 100)),
+	)
+}
+
+// PasswordChange sets a new password of the caller, who proves they know the current one
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password"`
+	Password        string `json:"password"`
+}
+
+func (p *PasswordChange) Validate() error {
+	return validation.ValidateStruct(
+		p,
+		validation.Field(&p.CurrentPassword, validation.Required),
+		// the password policy is applied by the service
+		validation.Field(&p.Password, validation.Required),
+	)
+}
+
+// EmailChange asks for a confirmation link sent to the new email of the caller
+type EmailChange struct {
+	Email           string `json:"email"`
+	CurrentPassword string `json:"current_password"`
+}
+
+func (e *EmailChange) Validate() error {
+	return validation.ValidateStruct(
+		e,
+		validation.Field(&e.Email, validation.Required, is.Email),
+		validation.Field(&e.CurrentPassword, validation.Required),
+	)
+}
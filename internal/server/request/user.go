@@ -16,9 +16,35 @@ func (u *UserCreate) Validate() error {
 		u,
 		validation.Field(&u.Email, validation.Required, is.Email),
 		validation.Field(&u.Name, validation.Required, validation.Length(2, 100)),
-		validation.Field(
-			&u.Password,
-			validation.Length(6, 100),
-		),
+		// the password policy is applied by the service
+		validation.Field(&u.Password, validation.Required),
+	)
+}
+
+// UserUpdate is a partial update, omitted fields are left untouched
+type UserUpdate struct {
+	Name     *string `json:"name"`
+	Email    *string `json:"email"`
+	Password *string `json:"password"`
+}
+
+func (u *UserUpdate) Validate() error {
+	return validation.ValidateStruct(
+		u,
+		validation.Field(&u.Email, validation.NilOrNotEmpty, is.Email),
+		validation.Field(&u.Name, validation.NilOrNotEmpty, validation.Length(2, 100)),
+		validation.Field(&u.Password, validation.NilOrNotEmpty),
+	)
+}
+
+// VerificationResend asks for a new verification link
+type VerificationResend struct {
+	Email string `json:"email"`
+}
+
+func (v *VerificationResend) Validate() error {
+	return validation.ValidateStruct(
+		v,
+		validation.Field(&v.Email, validation.Required, is.Email),
 	)
 }
@@ -0,0 +1,39 @@
+package response
+
+import (
+	"godmin/internal/model"
+	"time"
+)
+
+type AuditEvent struct {
+	ID         uint64                        `json:"id"`
+	ActorID    *uint64                       `json:"actor_id"`
+	Action     string                        `json:"action"`
+	TargetType string                        `json:"target_type"`
+	TargetID   string                        `json:"target_id"`
+	Changes    map[string]*model.AuditChange `json:"changes"`
+	IP         string                        `json:"ip"`
+	UserAgent  string                        `json:"user_agent"`
+	RequestID  string                        `json:"request_id"`
+	CreatedAt  time.Time                     `json:"created_at"`
+}
+
+func NewAuditEvent(e *model.AuditEvent) *AuditEvent {
+	changes := e.Changes
+	if changes == nil {
+		changes = map[string]*model.AuditChange{}
+	}
+
+	return &AuditEvent{
+		ID:         e.ID,
+		ActorID:    e.ActorID,
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		Changes:    changes,
+		IP:         e.IP,
+		UserAgent:  e.UserAgent,
+		RequestID:  e.RequestID,
+		CreatedAt:  e.CreatedAt,
+	}
+}
@@ -0,0 +1,20 @@
+package response
+
+const (
+	HealthStatusUp       = "up"
+	HealthStatusDown     = "down"
+	HealthStatusDraining = "draining"
+)
+
+// Health is the body of the probes, checks is empty for the liveness probe
+type Health struct {
+	Status string                  `json:"status"`
+	Checks map[string]*HealthCheck `json:"checks,omitempty"`
+}
+
+// HealthCheck is the result of a dependency check, the error is logged rather than detailed
+type HealthCheck struct {
+	Status string `json:"status"`
+	// Duration is how long the check took in milliseconds
+	Duration int64 `json:"duration_ms"`
+}
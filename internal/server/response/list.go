@@ -0,0 +1,18 @@
+package response
+
+import "godmin/internal/store/query"
+
+// List is a page of a listing with the cursors of the neighbouring pages
+type List struct {
+	Data       interface{} `json:"data"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	PrevCursor string      `json:"prev_cursor,omitempty"`
+}
+
+func NewList(data interface{}, p *query.Page) *List {
+	return &List{
+		Data:       data,
+		NextCursor: p.NextCursor,
+		PrevCursor: p.PrevCursor,
+	}
+}
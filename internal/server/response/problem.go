@@ -0,0 +1,136 @@
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"godmin/internal/throw"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+const (
+	// ProblemContentType is the media type of the error responses (RFC 7807)
+	ProblemContentType = "application/problem+json"
+
+	// ProblemTypeDefault means the problem has no other semantics than its HTTP status
+	ProblemTypeDefault = "about:blank"
+	// ProblemTypeValidation problems list the invalid fields in errors
+	ProblemTypeValidation = "urn:godmin:problem:validation"
+	// ProblemTypeMalformedBody problems are returned for request bodies which are not the expected JSON
+	ProblemTypeMalformedBody = "urn:godmin:problem:malformed-body"
+	// ProblemTypeEmailUnverified is returned to the users who can't log in before verifying their email
+	ProblemTypeEmailUnverified = "urn:godmin:problem:email-unverified"
+	// ProblemTypeLoginThrottled is returned while the client has to back off after failed logins
+	ProblemTypeLoginThrottled = "urn:godmin:problem:login-throttled"
+	// ProblemTypeAccountLocked is returned while the account is locked after too many failed logins
+	ProblemTypeAccountLocked = "urn:godmin:problem:account-locked"
+	// ProblemTypeMailThrottled is returned while the client has asked for too many emails
+	ProblemTypeMailThrottled = "urn:godmin:problem:mail-throttled"
+)
+
+// Problem is the body of every error response
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Instance is the id of the request, the one logged and returned in X-Request-ID
+	Instance string `json:"instance,omitempty"`
+	// Errors maps the invalid fields to their messages, nested fields are joined with dots
+	Errors map[string][]string `json:"errors,omitempty"`
+}
+
+// NewProblem describes the error, validation and JSON decoding errors get their fields listed.
+// Errors wrapped in a throw.TypedError get its problem type.
+func NewProblem(code int, err error) *Problem {
+	p := &Problem{
+		Type:   ProblemTypeDefault,
+		Title:  http.StatusText(code),
+		Status: code,
+		Detail: err.Error(),
+	}
+
+	var validationErrs validation.Errors
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var typedErr *throw.TypedError
+
+	switch {
+	case errors.As(err, &typedErr):
+		p.Type = typedErr.GetProblemType()
+	case errors.As(err, &validationErrs):
+		p.Type = ProblemTypeValidation
+		p.Title = "Invalid request fields"
+		p.Detail = "some fields of the request are invalid"
+		p.Errors = map[string][]string{}
+		flattenErrors(p.Errors, "", validationErrs)
+	case errors.As(err, &typeErr):
+		p.Type = ProblemTypeMalformedBody
+		p.Title = "Malformed request body"
+		if typeErr.Field == "" {
+			p.Detail = "the request body must be " + jsonType(typeErr.Type)
+			break
+		}
+		p.Detail = "some fields of the request have the wrong type"
+		p.Errors = map[string][]string{typeErr.Field: {"must be " + jsonType(typeErr.Type)}}
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		p.Type = ProblemTypeMalformedBody
+		p.Title = "Malformed request body"
+		p.Detail = "the request body is not valid JSON"
+	case errors.Is(err, io.EOF):
+		p.Type = ProblemTypeMalformedBody
+		p.Title = "Malformed request body"
+		p.Detail = "the request body is empty"
+	}
+
+	return p
+}
+
+func flattenErrors(dst map[string][]string, prefix string, errs validation.Errors) {
+	fields := make([]string, 0, len(errs))
+	for field := range errs {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		err := errs[field]
+		if err == nil {
+			continue
+		}
+
+		var nested validation.Errors
+		if errors.As(err, &nested) {
+			flattenErrors(dst, prefix+field+".", nested)
+			continue
+		}
+
+		dst[prefix+field] = append(dst[prefix+field], err.Error())
+	}
+}
+
+// jsonType names the JSON type the Go type is decoded from
+func jsonType(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
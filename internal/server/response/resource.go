@@ -0,0 +1,59 @@
+package response
+
+import (
+	"godmin/admin"
+	"godmin/internal/store/query"
+)
+
+type ResourceField struct {
+	Name       string     `json:"name"`
+	Type       query.Type `json:"type"`
+	Nullable   bool       `json:"nullable"`
+	Filterable bool       `json:"filterable"`
+	Sortable   bool       `json:"sortable"`
+	ReadOnly   bool       `json:"read_only"`
+	Hidden     bool       `json:"hidden"`
+	Enum       []string   `json:"enum,omitempty"`
+	References string     `json:"references,omitempty"`
+}
+
+type ResourcePermissions struct {
+	Read  string `json:"read"`
+	Write string `json:"write"`
+}
+
+// Resource describes a registered resource, e.g. to build the forms of a frontend
+type Resource struct {
+	Name        string               `json:"name"`
+	PrimaryKey  string               `json:"primary_key"`
+	Permissions *ResourcePermissions `json:"permissions"`
+	Fields      []*ResourceField     `json:"fields"`
+}
+
+func NewResource(r *admin.Resource) *Resource {
+	res := &Resource{
+		Name:       r.Name,
+		PrimaryKey: r.PrimaryKey,
+		Permissions: &ResourcePermissions{
+			Read:  r.Permissions.Read,
+			Write: r.Permissions.Write,
+		},
+		Fields: make([]*ResourceField, 0, len(r.Fields)),
+	}
+
+	for _, f := range r.Fields {
+		res.Fields = append(res.Fields, &ResourceField{
+			Name:       f.Name,
+			Type:       f.Type,
+			Nullable:   f.Nullable,
+			Filterable: f.Filterable,
+			Sortable:   f.Sortable,
+			ReadOnly:   f.ReadOnly,
+			Hidden:     f.Hidden,
+			Enum:       f.Enum,
+			References: f.References,
+		})
+	}
+
+	return res
+}
@@ -2,9 +2,19 @@ package response
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"godmin/internal/throw"
+	"math"
 	"net/http"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
 )
 
+// RequestIDHeader carries the id the request is logged with
+const RequestIDHeader = "X-Request-ID"
+
 type Handler interface {
 	Respond(w http.ResponseWriter, r *http.Request, code int, data interface{})
 	Error(w http.ResponseWriter, r *http.Request, code int, err error)
@@ -14,19 +24,43 @@ type Response struct {
 }
 
 func (res *Response) Respond(w http.ResponseWriter, r *http.Request, code int, data interface{}) {
-	w.Header().Add("Content-Type", "application/json")
+	res.write(w, code, "application/json", data)
+}
+
+// Error responds with the problem details of the error, the instance is the id of the request.
+// Server errors are logged instead of being detailed to the client.
+// A throw.RetryAfterError sets the Retry-After header in seconds.
+func (res *Response) Error(w http.ResponseWriter, r *http.Request, code int, err error) {
+	p := NewProblem(code, err)
+	p.Instance = w.Header().Get(RequestIDHeader)
+
+	var retryErr *throw.RetryAfterError
+	if errors.As(err, &retryErr) {
+		seconds := int(math.Ceil(retryErr.GetRetryAfter().Seconds()))
+		if seconds < 1 {
+			seconds = 1
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	}
+
+	if code >= http.StatusInternalServerError {
+		log.WithField("request_id", p.Instance).Error(err)
+		p.Detail = ""
+	}
+
+	res.write(w, code, ProblemContentType, p)
+}
+
+func (res *Response) write(w http.ResponseWriter, code int, contentType string, data interface{}) {
+	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(code)
 	if data != nil {
 		if err := json.NewEncoder(w).Encode(data); err != nil {
-			res.Error(w, r, http.StatusInternalServerError, err)
+			log.Error(fmt.Errorf("response encode error: %w", err))
 		}
 	}
 }
 
-func (res *Response) Error(w http.ResponseWriter, r *http.Request, code int, err error) {
-	res.Respond(w, r, code, map[string]string{"error": err.Error()})
-}
-
 func NewResponse() Handler {
 	return &Response{}
 }
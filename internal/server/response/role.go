@@ -0,0 +1,24 @@
+package response
+
+import "godmin/internal/model"
+
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+func NewRole(r *model.Role) *Role {
+	return &Role{
+		Name:        r.Name,
+		Description: r.Description,
+		Permissions: r.Permissions,
+	}
+}
+
+// Whoami is the authenticated user together with what they are allowed to do
+type Whoami struct {
+	*User
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
@@ -0,0 +1,30 @@
+package response
+
+import (
+	"godmin/internal/dto"
+	"time"
+)
+
+type Session struct {
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	Current    bool      `json:"current"`
+}
+
+func NewSession(f *dto.TokenFamily, currentID string) *Session {
+	return &Session{
+		ID:         f.ID,
+		CreatedAt:  f.CreatedAt.UTC(),
+		LastSeenAt: f.LastSeenAt.UTC(),
+		IP:         f.IP,
+		UserAgent:  f.UserAgent,
+		Current:    f.ID == currentID,
+	}
+}
+
+type SessionsRevoked struct {
+	Revoked int `json:"revoked"`
+}
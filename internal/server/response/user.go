@@ -1,17 +1,24 @@
 package response
 
-import "godmin/internal/model"
+import (
+	"godmin/internal/model"
+	"time"
+)
 
 type User struct {
-	ID    uint64 `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	ID              uint64     `json:"id"`
+	Name            string     `json:"name"`
+	Email           string     `json:"email"`
+	DisabledAt      *time.Time `json:"disabled_at,omitempty"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
 }
 
 func NewUser(u *model.User) *User {
 	return &User{
-		ID:    u.ID,
-		Name:  u.Name,
-		Email: u.Email,
+		ID:              u.ID,
+		Name:            u.Name,
+		Email:           u.Email,
+		DisabledAt:      u.DisabledAt,
+		EmailVerifiedAt: u.EmailVerifiedAt,
 	}
 }
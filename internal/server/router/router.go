@@ -2,72 +2,243 @@ package router
 
 import (
 	"context"
+	"errors"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	"go.opentelemetry.io/otel/trace"
+	"godmin/config"
+	"godmin/internal/metrics"
+	"godmin/internal/model"
 	"godmin/internal/server"
 	"godmin/internal/server/controller"
 	"godmin/internal/server/middleware"
 	"godmin/internal/server/response"
 	"net/http"
+	"strconv"
 	"time"
 )
 
-func NewRouter(s server.ServiceContainer) *mux.Router {
+var (
+	errNotFound         = errors.New("no route matches the path")
+	errMethodNotAllowed = errors.New("the method is not allowed on the path")
+)
+
+func NewRouter(s server.ServiceContainer, timeoutConfig *config.Timeout, serviceName string) *mux.Router {
+	responseHandler := response.NewResponse()
+	// the span of a request is named after its route template, it continues the trace of the caller's traceparent
+	traceRequest := otelmux.Middleware(serviceName)
+
 	router := mux.NewRouter()
 	router.Use(setRequestID)
+	router.Use(traceRequest)
 	router.Use(logRequest)
+	// after the logging, so the requests past their deadline are logged and counted with the 504
+	router.Use(middleware.NewTimeout(timeoutConfig, responseHandler).Deadline)
 
-	responseHandler := response.NewResponse()
+	// unmatched requests don't go through the middlewares, they are still identified, traced, logged and counted
+	router.NotFoundHandler = setRequestID(traceRequest(logRequest(
+		errorHandler(responseHandler, http.StatusNotFound, errNotFound),
+	)))
+	router.MethodNotAllowedHandler = setRequestID(traceRequest(logRequest(
+		errorHandler(responseHandler, http.StatusMethodNotAllowed, errMethodNotAllowed),
+	)))
 
 	// main
 	mainController := controller.NewMainController(responseHandler)
 	router.HandleFunc("/", mainController.Handle()).Methods(http.MethodGet)
 
+	// probes
+	healthController := controller.NewHealthController(responseHandler, s.Health())
+	router.HandleFunc("/healthz", healthController.HandleLive()).Methods(http.MethodGet)
+	router.HandleFunc("/readyz", healthController.HandleReady()).Methods(http.MethodGet)
+
 	// users
-	userController := controller.NewUserController(responseHandler, s.SqlStore())
+	userController := controller.NewUserController(
+		responseHandler,
+		s.SqlStore(),
+		s.MemoryStore(),
+		s.VerificationService(),
+		s.LoginThrottle(),
+		s.PasswordService(),
+		s.Auditor(),
+	)
 	user := router.PathPrefix("/users").Subrouter()
 	user.HandleFunc("/", userController.UserCreateHandle()).Methods(http.MethodPost)
+	user.HandleFunc("/verify", userController.HandleVerify()).Methods(http.MethodGet)
+	user.HandleFunc("/verify/resend", userController.HandleResendVerification()).Methods(http.MethodPost)
+	user.HandleFunc("/email/confirm", userController.HandleConfirmEmail()).Methods(http.MethodGet)
 
 	// login
-	authController := controller.NewAuthController(s.JwtService(), responseHandler)
+	authController := controller.NewAuthController(s.JwtService(), s.MfaService(), responseHandler, s.Auditor())
 	router.HandleFunc("/login", authController.HandleLogin()).Methods(http.MethodPost)
+	router.HandleFunc("/login/mfa", authController.HandleLoginMFA()).Methods(http.MethodPost)
+	router.HandleFunc("/refresh", authController.HandleRefresh()).Methods(http.MethodPost)
+	router.HandleFunc("/.well-known/jwks.json", authController.HandleJWKS()).Methods(http.MethodGet)
+
+	// password reset
+	passwordController := controller.NewPasswordController(s.PasswordService(), responseHandler)
+	router.HandleFunc("/password/forgot", passwordController.HandleForgot()).Methods(http.MethodPost)
+	router.HandleFunc("/password/reset", passwordController.HandleReset()).Methods(http.MethodPost)
 
 	// admin
 	admin := router.PathPrefix("/admin").Subrouter()
-	jwtAuthMiddleware := middleware.NewJwtAuth(s.JwtService(), responseHandler)
+	jwtAuthMiddleware := middleware.NewJwtAuth(s.JwtService(), s.ApiKeyService(), responseHandler)
 	admin.Use(jwtAuthMiddleware.JwtAuthentication)
+	authorization := middleware.NewAuthorization(s.SqlStore(), responseHandler)
+	can := authorization.RequirePermission
+	// the account, its keys and sessions are managed by its user, not by the API keys
+	session := jwtAuthMiddleware.RequireSession
 	admin.HandleFunc("/logout", authController.HandleLogout()).Methods(http.MethodGet)
 	admin.HandleFunc("/whoami", userController.HandleWhoami()).Methods(http.MethodGet)
 
+	// own account
+	profileController := controller.NewProfileController(
+		responseHandler,
+		s.SqlStore(),
+		s.PasswordService(),
+		s.VerificationService(),
+		s.Auditor(),
+	)
+	admin.Handle("/me", session(profileController.HandleUpdate())).Methods(http.MethodPatch)
+	admin.Handle("/me/password", session(profileController.HandleChangePassword())).Methods(http.MethodPost)
+	admin.Handle("/me/email", session(profileController.HandleChangeEmail())).Methods(http.MethodPost)
+
+	// users management
+	admin.Handle("/users", can(model.PermissionUsersRead)(userController.HandleList())).Methods(http.MethodGet)
+	admin.Handle("/users/{id:[0-9]+}", can(model.PermissionUsersRead)(userController.HandleShow())).Methods(http.MethodGet)
+	admin.Handle(
+		"/users/{id:[0-9]+}",
+		can(model.PermissionUsersWrite)(userController.HandleUpdate()),
+	).Methods(http.MethodPatch)
+	admin.Handle(
+		"/users/{id:[0-9]+}",
+		can(model.PermissionUsersWrite)(userController.HandleDelete()),
+	).Methods(http.MethodDelete)
+	admin.Handle(
+		"/users/{id:[0-9]+}/unlock",
+		can(model.PermissionUsersWrite)(userController.HandleUnlock()),
+	).Methods(http.MethodPost)
+
+	// two-factor authentication
+	mfaController := controller.NewMFAController(s.MfaService(), responseHandler)
+	admin.Handle("/mfa/totp", session(mfaController.HandleEnroll())).Methods(http.MethodPost)
+	admin.Handle("/mfa/totp", session(mfaController.HandleDisable())).Methods(http.MethodDelete)
+	admin.Handle("/mfa/totp/confirm", session(mfaController.HandleConfirm())).Methods(http.MethodPost)
+
+	// api keys
+	apiKeyController := controller.NewApiKeyController(s.ApiKeyService(), responseHandler)
+	admin.Handle("/api-keys", session(apiKeyController.HandleList())).Methods(http.MethodGet)
+	admin.Handle("/api-keys", session(apiKeyController.HandleCreate())).Methods(http.MethodPost)
+	admin.Handle("/api-keys/{id:[0-9]+}", session(apiKeyController.HandleRevoke())).Methods(http.MethodDelete)
+
+	// sessions
+	sessionController := controller.NewSessionController(responseHandler, s.MemoryStore(), s.Auditor())
+	admin.Handle("/sessions", session(sessionController.HandleList())).Methods(http.MethodGet)
+	admin.Handle("/sessions", session(sessionController.HandleRevokeAll())).Methods(http.MethodDelete)
+	admin.Handle("/sessions/{id}", session(sessionController.HandleShow())).Methods(http.MethodGet)
+	admin.Handle("/sessions/{id}", session(sessionController.HandleRevoke())).Methods(http.MethodDelete)
+	admin.Handle(
+		"/users/{id:[0-9]+}/sessions",
+		can(model.PermissionSessionsWrite)(sessionController.HandleRevokeUser()),
+	).Methods(http.MethodDelete)
+
+	// roles
+	roleController := controller.NewRoleController(responseHandler, s.SqlStore(), s.Auditor())
+	admin.Handle("/roles", can(model.PermissionRolesRead)(roleController.HandleList())).Methods(http.MethodGet)
+	admin.Handle(
+		"/users/{id:[0-9]+}/roles/{role}",
+		can(model.PermissionRolesWrite)(roleController.HandleGrant()),
+	).Methods(http.MethodPut)
+	admin.Handle(
+		"/users/{id:[0-9]+}/roles/{role}",
+		can(model.PermissionRolesWrite)(roleController.HandleRevoke()),
+	).Methods(http.MethodDelete)
+
+	// audit log
+	auditController := controller.NewAuditController(responseHandler, s.SqlStore())
+	admin.Handle("/audit", can(model.PermissionAuditRead)(auditController.HandleList())).Methods(http.MethodGet)
+
+	// registered resources
+	resourceIndexController := controller.NewResourceIndexController(responseHandler, s.Resources())
+	admin.Handle(
+		"/resources",
+		can(model.PermissionResourcesRead)(resourceIndexController.HandleList()),
+	).Methods(http.MethodGet)
+	for _, res := range s.Resources() {
+		resourceController := controller.NewResourceController(responseHandler, s.SqlStore(), res)
+		path := "/resources/" + res.Name
+		admin.Handle(path, can(res.Permissions.Read)(resourceController.HandleList())).Methods(http.MethodGet)
+		admin.Handle(path, can(res.Permissions.Write)(resourceController.HandleCreate())).Methods(http.MethodPost)
+		admin.Handle(path+"/{id}", can(res.Permissions.Read)(resourceController.HandleShow())).Methods(http.MethodGet)
+		admin.Handle(
+			path+"/{id}",
+			can(res.Permissions.Write)(resourceController.HandleUpdate()),
+		).Methods(http.MethodPatch)
+		admin.Handle(
+			path+"/{id}",
+			can(res.Permissions.Write)(resourceController.HandleDelete()),
+		).Methods(http.MethodDelete)
+	}
+
 	return router
 }
 
+func errorHandler(responseHandler response.Handler, code int, err error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		responseHandler.Error(w, r, code, err)
+	})
+}
+
 func setRequestID(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		id := uuid.New().String()
-		w.Header().Set("X-Request-ID", id)
+		w.Header().Set(response.RequestIDHeader, id)
 		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), server.CtxKeyRequestID, id)))
 	})
 }
 
 func logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sc := trace.SpanContextFromContext(r.Context())
 		logger := log.WithFields(log.Fields{
 			"remote_addr": r.RemoteAddr,
 			"request_id":  r.Context().Value(server.CtxKeyRequestID),
+			"trace_id":    sc.TraceID().String(),
+			"span_id":     sc.SpanID().String(),
 		})
 		logger.Infof("started %s %s", r.Method, r.RequestURI)
 
 		start := time.Now()
 		rw := &response.Writer{ResponseWriter: w, Code: http.StatusOK}
 		next.ServeHTTP(rw, r)
+		elapsed := time.Since(start)
 
 		logger.Infof(
 			"completed with %d %s in %v",
 			rw.Code,
 			http.StatusText(rw.Code),
-			time.Since(start),
+			elapsed,
 		)
+
+		route, status := routeTemplate(r), strconv.Itoa(rw.Code)
+		metrics.HTTPRequests.WithLabelValues(r.Method, route, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(r.Method, route, status).Observe(elapsed.Seconds())
 	})
 }
+
+// routeTemplate is the path template of the matched route, so the paths of a route share their metrics
+func routeTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "unmatched"
+	}
+
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return "unmatched"
+	}
+
+	return template
+}
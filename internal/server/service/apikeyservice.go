@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"godmin/internal/model"
+	"godmin/internal/server/request"
+	"godmin/internal/server/response"
+	"godmin/internal/store"
+	"godmin/internal/throw"
+	"net/http"
+	"strings"
+)
+
+var errApiKeyNotFound = errors.New("api key not found")
+
+// ApiKeyService manages personal access tokens
+type ApiKeyService struct {
+	store store.Store
+}
+
+// NewApiKeyService construct new ApiKeyService
+func NewApiKeyService(store store.Store) *ApiKeyService {
+	return &ApiKeyService{
+		store: store,
+	}
+}
+
+// Create issues a new key for the user, the plain key is returned only here
+func (s *ApiKeyService) Create(
+	ctx context.Context,
+	userID uint64,
+	req *request.ApiKeyCreate,
+) (*response.ApiKeyCreated, *throw.ResponseError) {
+	if err := s.checkScopes(ctx, req.Scopes); err != nil {
+		return nil, err
+	}
+
+	k := &model.ApiKey{
+		UserID:    userID,
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+	}
+
+	if err := s.store.ApiKey().Create(ctx, k); err != nil {
+		return nil, throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	return &response.ApiKeyCreated{
+		ApiKey: response.NewApiKey(k),
+		Key:    k.Key,
+	}, nil
+}
+
+// checkScopes refuses the scopes which aren't permissions, a typo would make the key useless
+func (s *ApiKeyService) checkScopes(ctx context.Context, scopes []string) *throw.ResponseError {
+	if len(scopes) == 0 {
+		return nil
+	}
+
+	permissions, err := s.store.Role().FindAllPermissions(ctx)
+	if err != nil {
+		return throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	known := make(map[string]bool, len(permissions))
+	for _, p := range permissions {
+		known[p] = true
+	}
+
+	for _, scope := range scopes {
+		if !known[scope] {
+			return throw.NewResponseError(http.StatusUnprocessableEntity, fmt.Errorf("unknown scope %s", scope))
+		}
+	}
+
+	return nil
+}
+
+// List returns the user's keys which are not revoked
+func (s *ApiKeyService) List(ctx context.Context, userID uint64) ([]*response.ApiKey, *throw.ResponseError) {
+	keys, err := s.store.ApiKey().FindByUser(ctx, userID)
+	if err != nil {
+		return nil, throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	res := make([]*response.ApiKey, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, response.NewApiKey(k))
+	}
+
+	return res, nil
+}
+
+// Revoke revokes one of the user's keys
+func (s *ApiKeyService) Revoke(ctx context.Context, userID uint64, id uint64) *throw.ResponseError {
+	err := s.store.ApiKey().Revoke(ctx, userID, id)
+	if err == store.ErrRecordNotFound {
+		return throw.NewResponseError(http.StatusNotFound, errApiKeyNotFound)
+	}
+	if err != nil {
+		return throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
+
+// Authenticate user by the API key from the Authorization header
+func (s *ApiKeyService) Authenticate(r *http.Request) (*model.User, *model.ApiKey, *throw.ResponseError) {
+	key := extractToken(r)
+	if !strings.HasPrefix(key, model.ApiKeyPrefix) {
+		return nil, nil, throw.NewResponseError(http.StatusUnauthorized, errNotAuthenticated)
+	}
+
+	k, err := s.store.ApiKey().Use(r.Context(), model.HashSecret(key))
+	if err != nil {
+		return nil, nil, throw.NewResponseError(http.StatusUnauthorized, errNotAuthenticated)
+	}
+
+	u, err := s.store.User().Find(r.Context(), k.UserID)
+	if err != nil || u.Disabled() {
+		return nil, nil, throw.NewResponseError(http.StatusUnauthorized, errNotAuthenticated)
+	}
+
+	return u, k, nil
+}
+
+// IsApiKey reports whether the request is authenticated with an API key rather than a JWT
+func IsApiKey(r *http.Request) bool {
+	return strings.HasPrefix(extractToken(r), model.ApiKeyPrefix)
+}
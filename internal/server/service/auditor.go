@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"godmin/internal/model"
+	"godmin/internal/store"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Auditor records who did what in the audit log
+type Auditor struct {
+	store store.Store
+}
+
+// NewAuditor construct new Auditor
+func NewAuditor(store store.Store) *Auditor {
+	return &Auditor{
+		store: store,
+	}
+}
+
+// Record stores the event. A failure is only logged with the event, the audited action has happened already.
+func (a *Auditor) Record(ctx context.Context, e *model.AuditEvent) {
+	if err := a.store.Audit().Create(ctx, e); err != nil {
+		log.WithFields(log.Fields{
+			"action":      e.Action,
+			"target_type": e.TargetType,
+			"target_id":   e.TargetID,
+			"request_id":  e.RequestID,
+		}).Error(fmt.Errorf("audit event error: %w", err))
+	}
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"godmin/config"
+	"godmin/internal/server/response"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// HealthCheck returns an error when the dependency can't be used, it should give up once ctx is done
+type HealthCheck func(ctx context.Context) error
+
+// HealthService tells whether the server can take traffic
+type HealthService struct {
+	config *config.Health
+
+	mu     sync.Mutex
+	checks map[string]HealthCheck
+
+	// draining is set once the shutdown begins
+	draining int32
+}
+
+// NewHealthService construct new HealthService
+func NewHealthService(healthConfig *config.Health) *HealthService {
+	return &HealthService{
+		config: healthConfig,
+		checks: map[string]HealthCheck{},
+	}
+}
+
+// AddCheck adds a dependency the server needs to take traffic
+func (s *HealthService) AddCheck(name string, check HealthCheck) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checks[name] = check
+}
+
+// Drain makes the readiness fail from now on, the server is shutting down
+func (s *HealthService) Drain() {
+	atomic.StoreInt32(&s.draining, 1)
+}
+
+func (s *HealthService) Draining() bool {
+	return atomic.LoadInt32(&s.draining) == 1
+}
+
+// Ready runs the checks concurrently, each within the check timeout, and returns false if any fails
+// or the server is draining
+func (s *HealthService) Ready(ctx context.Context) (*response.Health, bool) {
+	s.mu.Lock()
+	checks := make(map[string]HealthCheck, len(s.checks))
+	for name, check := range s.checks {
+		checks[name] = check
+	}
+	s.mu.Unlock()
+
+	health := &response.Health{
+		Status: response.HealthStatusUp,
+		Checks: make(map[string]*response.HealthCheck, len(checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check HealthCheck) {
+			defer wg.Done()
+
+			result := s.run(ctx, name, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			health.Checks[name] = result
+			if result.Status != response.HealthStatusUp {
+				health.Status = response.HealthStatusDown
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	if s.Draining() {
+		health.Status = response.HealthStatusDraining
+	}
+
+	return health, health.Status == response.HealthStatusUp
+}
+
+func (s *HealthService) run(ctx context.Context, name string, check HealthCheck) *response.HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, s.config.CheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+
+	// the check may not honour ctx all the way, e.g. a Redis command waits for its own read timeout
+	errc := make(chan error, 1)
+	go func() {
+		errc <- check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := &response.HealthCheck{
+		Status:   response.HealthStatusUp,
+		Duration: time.Since(start).Milliseconds(),
+	}
+
+	if err != nil {
+		log.WithField("check", name).Warn(fmt.Errorf("health check failed: %w", err))
+		result.Status = response.HealthStatusDown
+	}
+
+	return result
+}
@@ -0,0 +1,319 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"godmin/config"
+	"godmin/internal/server/response"
+	"io/ioutil"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var errUnknownKey = errors.New("unknown signing key")
+
+// jwtKey is a key able to verify access tokens and, when it holds a private part, to sign them
+type jwtKey struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+	jwk       *response.JWK
+}
+
+// KeySet holds the key access tokens are signed with and every key they are still verified with.
+// Keeping the previous key in the set while a new one signs lets keys rotate with no downtime.
+type KeySet struct {
+	signing *jwtKey
+	// legacy verifies the tokens without kid, nil once the shared secret isn't accepted anymore
+	legacy *jwtKey
+	keys   map[string]*jwtKey
+	// legacyUntil is when the shared secret stops being accepted, zero for never
+	legacyUntil time.Time
+	now         func() time.Time
+}
+
+// NewKeySet loads the access token keys.
+// Without JWT_PRIVATE_KEY_PATH access tokens are signed with the shared JWT_ACCESS_SECRET (HS256).
+// With it the shared secret isn't accepted anymore, unless until JWT_ACCESS_SECRET_UNTIL.
+func NewKeySet(conf *config.Jwt) (*KeySet, error) {
+	hmacKey := newHMACKey(conf.AccessSecret)
+	ks := &KeySet{
+		signing: hmacKey,
+		legacy:  hmacKey,
+		keys:    map[string]*jwtKey{hmacKey.id: hmacKey},
+		now:     time.Now,
+	}
+
+	if conf.PrivateKeyPath != "" {
+		delete(ks.keys, hmacKey.id)
+		ks.legacy = nil
+		if !conf.AccessSecretUntil.IsZero() {
+			ks.keys[hmacKey.id] = hmacKey
+			ks.legacy = hmacKey
+			ks.legacyUntil = conf.AccessSecretUntil
+		}
+
+		k, err := loadKey(conf.PrivateKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		if k.signKey == nil {
+			return nil, fmt.Errorf("%s: a private key is required to sign tokens", conf.PrivateKeyPath)
+		}
+
+		ks.signing = k
+		ks.keys[k.id] = k
+	}
+
+	for _, path := range conf.VerificationKeyPaths {
+		k, err := loadKey(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := ks.keys[k.id]; !ok {
+			ks.keys[k.id] = k
+		}
+	}
+
+	return ks, nil
+}
+
+// Sign creates a token signed by the current signing key and stamps its kid header
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.method, claims)
+	token.Header["kid"] = ks.signing.id
+
+	return token.SignedString(ks.signing.signKey)
+}
+
+// Parse verifies the token with the key its kid header points to.
+// Tokens without a kid were issued before keys had ids and are verified with the shared secret, as long as it is
+// accepted.
+func (ks *KeySet) Parse(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		k := ks.legacy
+		if kid, ok := token.Header["kid"]; ok {
+			id, _ := kid.(string)
+			if k, ok = ks.keys[id]; !ok {
+				return nil, errUnknownKey
+			}
+		}
+		if k == nil {
+			return nil, errUnknownKey
+		}
+		if k == ks.legacy && !ks.legacyUntil.IsZero() && !ks.now().Before(ks.legacyUntil) {
+			return nil, errUnknownKey
+		}
+
+		//Make sure that the token method conform to the key
+		if token.Method.Alg() != k.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return k.verifyKey, nil
+	})
+}
+
+// JWKS returns the public keys tokens can be verified with.
+// Shared secrets are never published.
+func (ks *KeySet) JWKS() *response.JWKS {
+	set := &response.JWKS{Keys: []response.JWK{}}
+
+	// the signing key goes first, verifiers usually pick the first matching key
+	if ks.signing.jwk != nil {
+		set.Keys = append(set.Keys, *ks.signing.jwk)
+	}
+	ids := make([]string, 0, len(ks.keys))
+	for id, k := range ks.keys {
+		if k.jwk != nil && id != ks.signing.id {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		set.Keys = append(set.Keys, *ks.keys[id].jwk)
+	}
+
+	return set
+}
+
+// hmacKeyID is the kid of the shared secret, a fixed one so the tokens don't publish anything derived from the secret
+const hmacKeyID = "hs256"
+
+func newHMACKey(secret string) *jwtKey {
+	return &jwtKey{
+		id:        hmacKeyID,
+		method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}
+}
+
+// loadKey reads a PEM encoded private or public key
+func loadKey(path string) (*jwtKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read the key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	var (
+		private crypto.Signer
+		public  crypto.PublicKey
+	)
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%s: unsupported private key type %T", path, key)
+		}
+		private = signer
+	case "RSA PRIVATE KEY":
+		if private, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	case "EC PRIVATE KEY":
+		if private, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	case "PUBLIC KEY":
+		if public, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	case "RSA PUBLIC KEY":
+		if public, err = x509.ParsePKCS1PublicKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+
+	if private != nil {
+		public = private.Public()
+	}
+
+	k, err := newAsymmetricKey(public)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if private != nil {
+		k.signKey = private
+	}
+
+	return k, nil
+}
+
+func newAsymmetricKey(public crypto.PublicKey) (*jwtKey, error) {
+	k := &jwtKey{verifyKey: public}
+
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		k.method = jwt.SigningMethodRS256
+		k.jwk = &response.JWK{
+			Kty: "RSA",
+			N:   encodeSegment(pub.N.Bytes()),
+			E:   encodeSegment(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		switch pub.Curve.Params().BitSize {
+		case 256:
+			k.method = jwt.SigningMethodES256
+		case 384:
+			k.method = jwt.SigningMethodES384
+		case 521:
+			k.method = jwt.SigningMethodES512
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", pub.Curve.Params().Name)
+		}
+		k.jwk = &response.JWK{
+			Kty: "EC",
+			Crv: pub.Curve.Params().Name,
+			X:   encodeSegment(pad(pub.X.Bytes(), size)),
+			Y:   encodeSegment(pad(pub.Y.Bytes(), size)),
+		}
+	case ed25519.PublicKey:
+		k.method = signingMethodEdDSA
+		k.jwk = &response.JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   encodeSegment(pub),
+		}
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", public)
+	}
+
+	k.id = thumbprint(k.jwk)
+	k.jwk.Kid = k.id
+	k.jwk.Use = "sig"
+	k.jwk.Alg = k.method.Alg()
+
+	return k, nil
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint used as the key id
+func thumbprint(jwk *response.JWK) string {
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+
+	// marshalling can't fail for plain string fields
+	b, _ := json.Marshal(members)
+	sum := sha256.Sum256(b)
+
+	return encodeSegment(sum[:])
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func pad(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+
+	return append(make([]byte, size-len(b)), b...)
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"godmin/config"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeKey(t *testing.T, key interface{}) string {
+	b, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestKeySet_SignAndParse(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	testCases := []struct {
+		name string
+		key  interface{}
+		alg  string
+		kty  string
+	}{
+		{name: "rsa", key: rsaKey, alg: "RS256", kty: "RSA"},
+		{name: "ecdsa", key: ecKey, alg: "ES256", kty: "EC"},
+		{name: "ed25519", key: edKey, alg: "EdDSA", kty: "OKP"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ks, err := NewKeySet(&config.Jwt{AccessSecret: "secret", PrivateKeyPath: writeKey(t, tc.key)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tokenString, err := ks.Sign(jwt.MapClaims{"user_id": 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := ks.Parse(tokenString)
+			if assert.NoError(t, err) {
+				assert.True(t, token.Valid)
+				assert.Equal(t, tc.alg, token.Method.Alg())
+			}
+
+			jwks := ks.JWKS()
+			if assert.Len(t, jwks.Keys, 1) {
+				assert.Equal(t, tc.kty, jwks.Keys[0].Kty)
+				assert.Equal(t, token.Header["kid"], jwks.Keys[0].Kid)
+			}
+		})
+	}
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	oldKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, newKey, _ := ed25519.GenerateKey(rand.Reader)
+	oldPath := writeKey(t, oldKey)
+
+	previous, err := NewKeySet(&config.Jwt{AccessSecret: "secret", PrivateKeyPath: oldPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued, _ := previous.Sign(jwt.MapClaims{"user_id": 1})
+	legacy, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": 1}).SignedString([]byte("secret"))
+
+	current, err := NewKeySet(&config.Jwt{
+		AccessSecret:         "secret",
+		PrivateKeyPath:       writeKey(t, newKey),
+		VerificationKeyPaths: []string{oldPath},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = current.Parse(issued)
+	assert.NoError(t, err)
+	assert.Len(t, current.JWKS().Keys, 2)
+
+	// the shared secret isn't accepted once a private key signs
+	_, err = current.Parse(legacy)
+	assert.Error(t, err)
+	hmacKid := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": 1})
+	hmacKid.Header["kid"] = newHMACKey("secret").id
+	withKid, _ := hmacKid.SignedString([]byte("secret"))
+	_, err = current.Parse(withKid)
+	assert.Error(t, err)
+
+	// unless until JWT_ACCESS_SECRET_UNTIL
+	transition, err := NewKeySet(&config.Jwt{
+		AccessSecret:      "secret",
+		PrivateKeyPath:    writeKey(t, newKey),
+		AccessSecretUntil: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = transition.Parse(legacy)
+	assert.NoError(t, err)
+	_, err = transition.Parse(withKid)
+	assert.NoError(t, err)
+
+	transition.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, err = transition.Parse(legacy)
+	assert.Error(t, err)
+	_, err = transition.Parse(withKid)
+	assert.Error(t, err)
+
+	withoutOld, _ := NewKeySet(&config.Jwt{AccessSecret: "secret", PrivateKeyPath: writeKey(t, newKey)})
+	_, err = withoutOld.Parse(issued)
+	assert.Error(t, err)
+}
@@ -1,16 +1,17 @@
 package service
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"godmin/config"
 	"godmin/internal/dto"
+	"godmin/internal/metrics"
 	"godmin/internal/model"
+	"godmin/internal/password"
 	"godmin/internal/server/request"
 	"godmin/internal/server/response"
-	"godmin/internal/store/memorystore"
-	"godmin/internal/store/sqlstore"
+	"godmin/internal/store"
 	"godmin/internal/throw"
 	"net/http"
 	"strconv"
@@ -19,44 +20,129 @@ import (
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
 )
 
 var (
 	errIncorrectEmailOrPassword = errors.New("incorrect email or password")
 	errNotAuthenticated         = errors.New("not authenticated")
+	errRefreshTokenExpired      = errors.New("refresh token expired")
+	errUserDisabled             = errors.New("user is disabled")
+	errEmailUnverified          = throw.NewTypedError(
+		response.ProblemTypeEmailUnverified,
+		errors.New("email is not verified, follow the link sent to it"),
+	)
 )
 
 // JWTService is JWT authentication manager
 type JWTService struct {
-	store       *sqlstore.Store
-	memoryStore *memorystore.Store
+	store       store.Store
+	memoryStore store.MemoryStore
+	hasher      *password.Hasher
+	keys        *KeySet
 	config      *config.Jwt
+	// verification decides whether users with an unverified email can log in
+	verification *config.Verification
+	throttle     *LoginThrottle
+	// timingUser is checked when the email is unknown, so the failure takes as long as a wrong password
+	timingUser *model.User
 }
 
 // NewJwtService construct new JWTService
-func NewJwtService(store *sqlstore.Store, memoryStore *memorystore.Store, jwtConfig *config.Jwt) *JWTService {
+func NewJwtService(
+	store store.Store,
+	memoryStore store.MemoryStore,
+	hasher *password.Hasher,
+	keys *KeySet,
+	jwtConfig *config.Jwt,
+	verificationConfig *config.Verification,
+	throttle *LoginThrottle,
+) *JWTService {
+	timingUser := &model.User{Password: uuid.New().String()}
+	if err := timingUser.BeforeCreate(hasher); err != nil {
+		log.Error(fmt.Errorf("timing password hash error: %w", err))
+	}
+
 	return &JWTService{
-		store:       store,
-		memoryStore: memoryStore,
-		config:      jwtConfig,
+		store:        store,
+		memoryStore:  memoryStore,
+		hasher:       hasher,
+		keys:         keys,
+		config:       jwtConfig,
+		verification: verificationConfig,
+		throttle:     throttle,
+		timingUser:   timingUser,
 	}
 }
 
-// CreateToken build new JWT
-func (s *JWTService) CreateToken(l *request.Login) (*response.Token, *throw.ResponseError) {
-	u, err := s.store.User().FindByEmail(l.Email)
-	if err != nil || !u.ComparePassword(l.Password) {
+// CheckCredentials finds the user by email and checks the password, the failures are throttled by the client.
+// With EMAIL_VERIFICATION_REQUIRED the users who haven't verified their email are refused.
+func (s *JWTService) CheckCredentials(
+	ctx context.Context,
+	l *request.Login,
+	c *dto.Client,
+) (*model.User, *throw.ResponseError) {
+	if err := s.throttle.Check(ctx, l.Email, c.IP); err != nil {
+		metrics.LoginFailures.WithLabelValues("throttled").Inc()
+		return nil, err
+	}
+
+	u, err := s.store.User().FindByEmail(ctx, l.Email)
+	if err != nil {
+		u = s.timingUser
+	}
+	if !u.ComparePassword(s.hasher, l.Password) || u == s.timingUser {
+		if err := s.throttle.Fail(ctx, l.Email, c.IP); err != nil {
+			log.Error(fmt.Errorf("login failure count error: %w", err))
+		}
+
+		metrics.LoginFailures.WithLabelValues("credentials").Inc()
 		return nil, throw.NewJWTError(http.StatusUnauthorized, errIncorrectEmailOrPassword)
 	}
+	if u.PasswordOutdated(s.hasher) {
+		s.rehashPassword(ctx, u, l.Password)
+	}
+	if u.Disabled() {
+		metrics.LoginFailures.WithLabelValues("disabled").Inc()
+		return nil, throw.NewJWTError(http.StatusForbidden, errUserDisabled)
+	}
+	if s.verification.Required && !u.EmailVerified() {
+		metrics.LoginFailures.WithLabelValues("unverified").Inc()
+		return nil, throw.NewJWTError(http.StatusForbidden, errEmailUnverified)
+	}
+
+	return u, nil
+}
+
+// rehashPassword upgrades the password hash of the user, the login goes on if it fails
+func (s *JWTService) rehashPassword(ctx context.Context, u *model.User, password string) {
+	updated, err := s.store.User().Update(ctx, u.ID, &model.UserChanges{Password: &password})
+	if err != nil {
+		log.WithField("user_id", u.ID).Error(fmt.Errorf("password rehash error: %w", err))
+		return
+	}
+
+	u.EncryptedPassword = updated.EncryptedPassword
+	log.WithField("user_id", u.ID).Info("password hash upgraded")
+}
 
-	token, err := s.createToken(u.ID)
+// IssueToken build new JWT pair starting a new session.
+// The caller is responsible for authenticating the user first, see CheckCredentials and MFAService.VerifyChallenge,
+// the failed logins of the user are forgotten here.
+func (s *JWTService) IssueToken(ctx context.Context, u *model.User, c *dto.Client) (*response.Token, *throw.ResponseError) {
+	token, err := s.createToken(u.ID, uuid.New().String())
 	if err != nil {
 		return nil, throw.NewJWTError(http.StatusUnprocessableEntity, err)
 	}
 
-	saveErr := s.memoryStore.Token().Create(u.ID, token)
+	saveErr := s.memoryStore.Token().Create(ctx, u.ID, token, c)
 	if saveErr != nil {
-		return nil, throw.NewJWTError(http.StatusUnprocessableEntity, err)
+		return nil, throw.NewJWTError(http.StatusUnprocessableEntity, saveErr)
+	}
+	metrics.Logins.Inc()
+
+	if err := s.throttle.Succeed(ctx, u.ID, u.Email); err != nil {
+		log.Error(fmt.Errorf("login failure reset error: %w", err))
 	}
 
 	return &response.Token{
@@ -65,113 +151,117 @@ func (s *JWTService) CreateToken(l *request.Login) (*response.Token, *throw.Resp
 	}, nil
 }
 
-// RefreshToken re-build JWT token
-func (s *JWTService) RefreshToken(r *http.Request) (map[string]string, *throw.ResponseError) {
-	req := &struct {
-		RefreshToken string `json:"refresh_token"`
-	}{}
-
-	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
-		return nil, throw.NewJWTError(http.StatusBadRequest, err)
-	}
-
-	token, err := jwt.Parse(req.RefreshToken, func(token *jwt.Token) (interface{}, error) {
-		//Make sure that the token method conform to "SigningMethodHMAC"
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(s.config.RefreshSecret), nil
-	})
-	//if there is an error, the token must have expired
+// RefreshToken rotates the token pair of the refresh token family.
+// Presenting a refresh token that was already rotated revokes the whole family, and so does a deleted or disabled user.
+func (s *JWTService) RefreshToken(ctx context.Context, req *request.Refresh) (*response.Token, *throw.ResponseError) {
+	details, err := s.extractRefreshMetadata(req.RefreshToken)
 	if err != nil {
-		return nil, throw.NewJWTError(http.StatusUnauthorized, errors.New("refresh token expired"))
+		metrics.Refreshes.WithLabelValues("invalid").Inc()
+		return nil, throw.NewJWTError(http.StatusUnauthorized, errRefreshTokenExpired)
 	}
-	//is token valid?
-	if _, ok := token.Claims.(jwt.Claims); !ok && !token.Valid {
-		return nil, throw.NewJWTError(http.StatusUnauthorized, err)
+
+	// the deleted and disabled users lose the session rather than refreshing it until it expires
+	u, err := s.store.User().Find(ctx, details.UserID)
+	if err != nil && err != store.ErrRecordNotFound {
+		return nil, throw.NewJWTError(http.StatusInternalServerError, err)
 	}
-	//Since token is valid, get the uuid:
-	claims, ok := token.Claims.(jwt.MapClaims) //the token claims should conform to MapClaims
-	if ok && token.Valid {
-		refreshUUID, ok := claims["refresh_uuid"].(string) //convert the interface to string
-		if !ok {
-			return nil, throw.NewJWTError(http.StatusUnprocessableEntity, err)
-		}
-		userID, err := strconv.ParseUint(fmt.Sprintf("%.f", claims["user_id"]), 10, 64)
-		if err != nil {
-			return nil, throw.NewJWTError(http.StatusUnprocessableEntity, err)
+	if err == store.ErrRecordNotFound || u.Disabled() {
+		metrics.Refreshes.WithLabelValues("refused").Inc()
+		if err := s.memoryStore.Token().RevokeFamily(ctx, details.FamilyID); err == nil {
+			metrics.Revocations.WithLabelValues("refused").Inc()
+		} else if err != store.ErrRecordNotFound {
+			log.Error(fmt.Errorf("token family revoke error: %w", err))
 		}
 
-		//Delete the previous Access Token
-		deleted, err := s.deleteToken(r)
-		if err != nil || deleted == 0 {
+		if u == nil {
 			return nil, throw.NewJWTError(http.StatusUnauthorized, errNotAuthenticated)
 		}
 
-		//Delete the previous Refresh Token
-		deleted, delErr := s.memoryStore.Token().Delete(refreshUUID)
-		if delErr != nil || deleted == 0 { //if any goes wrong
-			return nil, throw.NewJWTError(http.StatusUnauthorized, errNotAuthenticated)
-		}
-		//Create new pairs of refresh and access tokens
-		ts, createErr := s.createToken(userID)
-		if createErr != nil {
-			return nil, throw.NewJWTError(http.StatusUnprocessableEntity, createErr)
-		}
-		//save the tokens metadata to redis
-		saveErr := s.memoryStore.Token().Create(userID, ts)
-		if saveErr != nil {
-			return nil, throw.NewJWTError(http.StatusUnprocessableEntity, saveErr)
-		}
-		tokens := map[string]string{
-			"access_token":  ts.AccessToken,
-			"refresh_token": ts.RefreshToken,
+		return nil, throw.NewJWTError(http.StatusForbidden, errUserDisabled)
+	}
+
+	token, err := s.createToken(details.UserID, details.FamilyID)
+	if err != nil {
+		return nil, throw.NewJWTError(http.StatusUnprocessableEntity, err)
+	}
+
+	err = s.memoryStore.Token().Rotate(ctx, details.FamilyID, details.RefreshUUID, token)
+	if err == store.ErrTokenReused {
+		log.WithFields(log.Fields{
+			"user_id":   details.UserID,
+			"family_id": details.FamilyID,
+		}).Warn("refresh token reuse detected, token family revoked")
+
+		metrics.Refreshes.WithLabelValues("reused").Inc()
+		if err := s.memoryStore.Token().RevokeFamily(ctx, details.FamilyID); err != nil {
+			log.Error(fmt.Errorf("token family revoke error: %w", err))
+		} else {
+			metrics.Revocations.WithLabelValues("reuse").Inc()
 		}
 
-		return tokens, nil
+		return nil, throw.NewJWTError(http.StatusUnauthorized, errNotAuthenticated)
+	}
+	if err != nil {
+		metrics.Refreshes.WithLabelValues("invalid").Inc()
+		return nil, throw.NewJWTError(http.StatusUnauthorized, errNotAuthenticated)
 	}
+	metrics.Refreshes.WithLabelValues("success").Inc()
 
-	return nil, throw.NewJWTError(http.StatusUnauthorized, errors.New("refresh expired"))
+	return &response.Token{
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+	}, nil
 }
 
-// Authenticate user by JWT token
-func (s *JWTService) Authenticate(r *http.Request) (*model.User, *throw.ResponseError) {
+// Authenticate user by JWT token, returns the user and the id of the session the token belongs to
+func (s *JWTService) Authenticate(r *http.Request) (*model.User, string, *throw.ResponseError) {
 	tokenAuth, errToken := s.extractTokenMetadata(r)
 	if errToken != nil {
-		return nil, throw.NewJWTError(http.StatusUnauthorized, errNotAuthenticated)
+		return nil, "", throw.NewJWTError(http.StatusUnauthorized, errNotAuthenticated)
 	}
 
-	userID, errUserID := s.memoryStore.Token().Find(tokenAuth.AccessUUID)
+	userID, errUserID := s.memoryStore.Token().Find(r.Context(), tokenAuth.AccessUUID)
 	if errUserID != nil {
-		return nil, throw.NewJWTError(http.StatusUnauthorized, errNotAuthenticated)
+		return nil, "", throw.NewJWTError(http.StatusUnauthorized, errNotAuthenticated)
 	}
 	if userID != tokenAuth.UserID {
-		return nil, throw.NewJWTError(http.StatusUnauthorized, errNotAuthenticated)
+		return nil, "", throw.NewJWTError(http.StatusUnauthorized, errNotAuthenticated)
 	}
 
-	u, errUser := s.store.User().Find(userID)
-	if errUser != nil {
-		return nil, throw.NewJWTError(http.StatusUnauthorized, errNotAuthenticated)
+	u, errUser := s.store.User().Find(r.Context(), userID)
+	if errUser != nil || u.Disabled() {
+		return nil, "", throw.NewJWTError(http.StatusUnauthorized, errNotAuthenticated)
 	}
 
-	return u, nil
+	if err := s.memoryStore.Token().Touch(r.Context(), tokenAuth.FamilyID); err != nil {
+		log.Error(fmt.Errorf("session touch error: %w", err))
+	}
+
+	return u, tokenAuth.FamilyID, nil
 }
 
 // Logout user
 func (s *JWTService) Logout(r *http.Request) *throw.ResponseError {
-	deleted, err := s.deleteToken(r)
-	if err != nil || deleted == 0 {
+	tokenAuth, err := s.extractTokenMetadata(r)
+	if err != nil {
 		return throw.NewJWTError(http.StatusUnauthorized, errNotAuthenticated)
 	}
 
+	// revoke the refresh token too, so the session can't be continued
+	if err := s.memoryStore.Token().RevokeFamily(r.Context(), tokenAuth.FamilyID); err != nil {
+		return throw.NewJWTError(http.StatusUnauthorized, errNotAuthenticated)
+	}
+	metrics.Revocations.WithLabelValues("logout").Inc()
+
 	return nil
 }
 
-func (s *JWTService) createToken(userID uint64) (*dto.Token, error) {
+func (s *JWTService) createToken(userID uint64, familyID string) (*dto.Token, error) {
 	var err error
 	token := &dto.Token{
 		AccessUuid:          uuid.New().String(),
 		RefreshUuid:         uuid.New().String(),
+		FamilyID:            familyID,
 		RefreshTokenExpires: time.Now().Add(time.Hour * 24 * 7).Unix(),
 		AccessTokenExpires:  time.Now().Add(time.Minute * 15).Unix(),
 	}
@@ -180,19 +270,20 @@ func (s *JWTService) createToken(userID uint64) (*dto.Token, error) {
 	accessTokenClaims := jwt.MapClaims{
 		"authorized":  true,
 		"access_uuid": token.AccessUuid,
+		"family_id":   token.FamilyID,
 		"user_id":     userID,
 		"exp":         token.AccessTokenExpires,
 	}
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessTokenClaims)
 
-	token.AccessToken, err = accessToken.SignedString([]byte(s.config.AccessSecret))
+	token.AccessToken, err = s.keys.Sign(accessTokenClaims)
 	if err != nil {
 		return nil, err
 	}
 
-	// generate refresh token
+	// generate refresh token, it is only verified by godmin itself so it stays on the shared secret
 	refreshTokenClaims := jwt.MapClaims{
 		"refresh_uuid": token.RefreshUuid,
+		"family_id":    token.FamilyID,
 		"user_id":      userID,
 		"exp":          token.RefreshTokenExpires,
 	}
@@ -206,21 +297,6 @@ func (s *JWTService) createToken(userID uint64) (*dto.Token, error) {
 	return token, nil
 }
 
-func (s *JWTService) deleteToken(r *http.Request) (int64, error) {
-	tokenAuth, err := s.extractTokenMetadata(r)
-	if err != nil {
-		return 0, err
-	}
-
-	var deleted int64
-	deleted, err = s.memoryStore.Token().Delete(tokenAuth.AccessUUID)
-	if err != nil || deleted == 0 {
-		return 0, err
-	}
-
-	return deleted, nil
-}
-
 func (s *JWTService) extractTokenMetadata(r *http.Request) (*accessDetails, error) {
 	token, err := s.verifyToken(r)
 	if err != nil {
@@ -230,8 +306,9 @@ func (s *JWTService) extractTokenMetadata(r *http.Request) (*accessDetails, erro
 	if ok && token.Valid {
 		accessUUID, ok := claims["access_uuid"].(string)
 		if !ok {
-			return nil, err
+			return nil, errNotAuthenticated
 		}
+		familyID, _ := claims["family_id"].(string)
 
 		userID, err := strconv.ParseUint(fmt.Sprintf("%.f", claims["user_id"]), 10, 64)
 		if err != nil {
@@ -240,21 +317,60 @@ func (s *JWTService) extractTokenMetadata(r *http.Request) (*accessDetails, erro
 
 		return &accessDetails{
 			AccessUUID: accessUUID,
+			FamilyID:   familyID,
 			UserID:     userID,
 		}, nil
 	}
-	return nil, err
+	return nil, errNotAuthenticated
+}
+
+func (s *JWTService) extractRefreshMetadata(tokenString string) (*refreshDetails, error) {
+	token, err := parseToken(tokenString, s.config.RefreshSecret)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if ok && token.Valid {
+		refreshUUID, ok := claims["refresh_uuid"].(string)
+		if !ok {
+			return nil, errRefreshTokenExpired
+		}
+		familyID, ok := claims["family_id"].(string)
+		if !ok {
+			return nil, errRefreshTokenExpired
+		}
+
+		userID, err := strconv.ParseUint(fmt.Sprintf("%.f", claims["user_id"]), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		return &refreshDetails{
+			RefreshUUID: refreshUUID,
+			FamilyID:    familyID,
+			UserID:      userID,
+		}, nil
+	}
+	return nil, errRefreshTokenExpired
+}
+
+// JWKS returns the public keys access tokens can be verified with
+func (s *JWTService) JWKS() *response.JWKS {
+	return s.keys.JWKS()
 }
 
 func (s *JWTService) verifyToken(r *http.Request) (*jwt.Token, error) {
-	tokenString := extractToken(r)
+	return s.keys.Parse(extractToken(r))
+}
+
+func parseToken(tokenString string, secret string) (*jwt.Token, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		//Make sure that the token method conform to "SigningMethodHMAC"
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 
-		return []byte(s.config.AccessSecret), nil
+		return []byte(secret), nil
 	})
 	if err != nil {
 		return nil, err
@@ -276,5 +392,12 @@ func extractToken(r *http.Request) string {
 
 type accessDetails struct {
 	AccessUUID string
+	FamilyID   string
 	UserID     uint64
 }
+
+type refreshDetails struct {
+	RefreshUUID string
+	FamilyID    string
+	UserID      uint64
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"godmin/config"
+	"godmin/internal/server/response"
+	"godmin/internal/store"
+	"godmin/internal/throw"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	errLoginThrottled = errors.New("too many failed logins, try again later")
+	errAccountLocked  = errors.New("too many failed logins, the account is locked for a while")
+)
+
+// LoginThrottle slows down password guessing. The failures are counted by address and by email:
+// an email backs off exponentially and is locked after too many failures, an address is blocked
+// once it fails too often in the window. The failed MFA codes are counted by user and lock the account too,
+// the counts are forgotten once the login fully succeeds.
+type LoginThrottle struct {
+	memoryStore store.MemoryStore
+	config      *config.Throttle
+}
+
+// NewLoginThrottle construct new LoginThrottle
+func NewLoginThrottle(memoryStore store.MemoryStore, throttleConfig *config.Throttle) *LoginThrottle {
+	return &LoginThrottle{
+		memoryStore: memoryStore,
+		config:      throttleConfig,
+	}
+}
+
+// Check refuses the login while the email is locked or backing off, or the address is blocked.
+// The error tells when to retry.
+func (t *LoginThrottle) Check(ctx context.Context, email string, ip string) *throw.ResponseError {
+	if err := t.checkLock(ctx, email); err != nil {
+		return err
+	}
+
+	attempts := t.memoryStore.LoginAttempt()
+	now := time.Now()
+
+	byIP, err := attempts.Failures(ctx, ipKey(ip), t.config.Window)
+	if err != nil {
+		return throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+	if byIP.Count >= t.config.MaxPerIP {
+		return retryLater(byIP.Oldest.Add(t.config.Window).Sub(now), response.ProblemTypeLoginThrottled, errLoginThrottled)
+	}
+
+	byEmail, err := attempts.Failures(ctx, emailKey(email), t.config.Window)
+	if err != nil {
+		return throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+	if wait := byEmail.Latest.Add(t.backoff(byEmail.Count)).Sub(now); wait > 0 {
+		return retryLater(wait, response.ProblemTypeLoginThrottled, errLoginThrottled)
+	}
+
+	return nil
+}
+
+// Fail counts a failed login, the email is locked once it reaches the maximum of the window
+func (t *LoginThrottle) Fail(ctx context.Context, email string, ip string) error {
+	attempts := t.memoryStore.LoginAttempt()
+
+	if _, err := attempts.Fail(ctx, ipKey(ip), t.config.Window); err != nil {
+		return err
+	}
+
+	byEmail, err := attempts.Fail(ctx, emailKey(email), t.config.Window)
+	if err != nil {
+		return err
+	}
+
+	if byEmail.Count >= t.config.MaxPerEmail {
+		log.WithFields(log.Fields{
+			"email":    email,
+			"ip":       ip,
+			"failures": byEmail.Count,
+		}).Warn("too many failed logins, account locked")
+
+		if err := attempts.Lock(ctx, emailKey(email), t.config.LockoutDuration); err != nil {
+			return err
+		}
+
+		// the count starts over once the lock expires
+		return attempts.Reset(ctx, emailKey(email))
+	}
+
+	return nil
+}
+
+// CheckMFA refuses the MFA code while the account is locked
+func (t *LoginThrottle) CheckMFA(ctx context.Context, email string) *throw.ResponseError {
+	return t.checkLock(ctx, email)
+}
+
+// FailMFA counts a failed MFA code of the user, the account is locked once it reaches the maximum of the window.
+// The count doesn't depend on the challenge, every login with the password issues a new one.
+func (t *LoginThrottle) FailMFA(ctx context.Context, userID uint64, email string) error {
+	attempts := t.memoryStore.LoginAttempt()
+
+	failures, err := attempts.Fail(ctx, mfaKey(userID), t.config.Window)
+	if err != nil {
+		return err
+	}
+
+	if failures.Count >= t.config.MaxMFAFailures {
+		log.WithFields(log.Fields{
+			"user_id":  userID,
+			"failures": failures.Count,
+		}).Warn("too many failed MFA codes, account locked")
+
+		if err := attempts.Lock(ctx, emailKey(email), t.config.LockoutDuration); err != nil {
+			return err
+		}
+
+		return attempts.Reset(ctx, mfaKey(userID))
+	}
+
+	return nil
+}
+
+// Succeed forgets the failures of the email and the failed MFA codes of the user, the ones of the address still
+// count. It is called once the user is fully authenticated, not when the password alone is right.
+func (t *LoginThrottle) Succeed(ctx context.Context, userID uint64, email string) error {
+	if err := t.memoryStore.LoginAttempt().Reset(ctx, emailKey(email)); err != nil {
+		return err
+	}
+
+	return t.memoryStore.LoginAttempt().Reset(ctx, mfaKey(userID))
+}
+
+// Unlock lifts the lock of the account and forgets its failures
+func (t *LoginThrottle) Unlock(ctx context.Context, userID uint64, email string) error {
+	if err := t.memoryStore.LoginAttempt().Unlock(ctx, emailKey(email)); err != nil {
+		return err
+	}
+
+	return t.Succeed(ctx, userID, email)
+}
+
+func (t *LoginThrottle) checkLock(ctx context.Context, email string) *throw.ResponseError {
+	locked, err := t.memoryStore.LoginAttempt().LockedFor(ctx, emailKey(email))
+	if err != nil {
+		return throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+	if locked > 0 {
+		return retryLater(locked, response.ProblemTypeAccountLocked, errAccountLocked)
+	}
+
+	return nil
+}
+
+// backoff returns the wait after the latest of the failures
+func (t *LoginThrottle) backoff(failures int) time.Duration {
+	if failures < t.config.FreeAttempts || failures == 0 {
+		return 0
+	}
+
+	delay := t.config.BaseDelay
+	for i := t.config.FreeAttempts; i < failures && delay < t.config.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > t.config.MaxDelay {
+		delay = t.config.MaxDelay
+	}
+
+	return delay
+}
+
+func retryLater(wait time.Duration, problemType string, err error) *throw.ResponseError {
+	return throw.NewResponseError(
+		http.StatusTooManyRequests,
+		throw.NewRetryAfterError(wait, throw.NewTypedError(problemType, err)),
+	)
+}
+
+func emailKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func mfaKey(userID uint64) string {
+	return "mfa:" + strconv.FormatUint(userID, 10)
+}
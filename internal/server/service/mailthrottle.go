@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"godmin/config"
+	"godmin/internal/server/response"
+	"godmin/internal/store"
+	"godmin/internal/throw"
+	"net/http"
+	"time"
+)
+
+// the purposes keep the counts of the emails apart from each other and from the failed logins
+const (
+	mailPurposeReset        = "reset"
+	mailPurposeVerification = "verification"
+)
+
+var errMailThrottled = errors.New("too many emails asked for, try again later")
+
+// MailThrottle limits the emails the clients which aren't logged in can trigger, by address and by email.
+// Every request counts, the answer doesn't tell whether the email has an account.
+type MailThrottle struct {
+	memoryStore store.MemoryStore
+	config      *config.MailThrottle
+}
+
+// NewMailThrottle construct new MailThrottle
+func NewMailThrottle(memoryStore store.MemoryStore, throttleConfig *config.MailThrottle) *MailThrottle {
+	return &MailThrottle{
+		memoryStore: memoryStore,
+		config:      throttleConfig,
+	}
+}
+
+// Allow counts the request for an email of the purpose, or refuses it while the address or the email
+// has reached its maximum of the window. The error tells when to retry.
+func (t *MailThrottle) Allow(ctx context.Context, purpose string, email string, ip string) *throw.ResponseError {
+	limits := map[string]int{
+		"mail:" + purpose + ":" + ipKey(ip):       t.config.MaxPerIP,
+		"mail:" + purpose + ":" + emailKey(email): t.config.MaxPerEmail,
+	}
+
+	attempts := t.memoryStore.LoginAttempt()
+	now := time.Now()
+
+	for key, max := range limits {
+		requests, err := attempts.Failures(ctx, key, t.config.Window)
+		if err != nil {
+			return throw.NewResponseError(http.StatusInternalServerError, err)
+		}
+		if requests.Count >= max {
+			return retryLater(requests.Oldest.Add(t.config.Window).Sub(now), response.ProblemTypeMailThrottled, errMailThrottled)
+		}
+	}
+
+	for key := range limits {
+		if _, err := attempts.Fail(ctx, key, t.config.Window); err != nil {
+			return throw.NewResponseError(http.StatusInternalServerError, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,285 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"godmin/config"
+	"godmin/internal/model"
+	"godmin/internal/password"
+	"godmin/internal/server/request"
+	"godmin/internal/server/response"
+	"godmin/internal/store"
+	"godmin/internal/throw"
+	"godmin/internal/totp"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	recoveryCodesCount     = 10
+	maxChallengeAttempts   = 5
+	totpAllowedClockDrifts = 1
+)
+
+var (
+	errTOTPAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	errTOTPNotEnrolled      = errors.New("two-factor authentication is not enrolled")
+	errTOTPNotEnabled       = errors.New("two-factor authentication is not enabled")
+	errInvalidMFACode       = errors.New("invalid two-factor authentication code")
+	errMFAChallengeExpired  = errors.New("two-factor authentication challenge expired")
+	recoveryCodeEncoding    = base32.StdEncoding.WithPadding(base32.NoPadding)
+	recoveryCodeReplacement = strings.NewReplacer("-", "", " ", "")
+)
+
+// MFAService manages TOTP two-factor authentication
+type MFAService struct {
+	store       store.Store
+	memoryStore store.MemoryStore
+	hasher      *password.Hasher
+	throttle    *LoginThrottle
+	config      *config.Mfa
+}
+
+// NewMFAService construct new MFAService
+func NewMFAService(
+	store store.Store,
+	memoryStore store.MemoryStore,
+	hasher *password.Hasher,
+	throttle *LoginThrottle,
+	mfaConfig *config.Mfa,
+) *MFAService {
+	return &MFAService{
+		store:       store,
+		memoryStore: memoryStore,
+		hasher:      hasher,
+		throttle:    throttle,
+		config:      mfaConfig,
+	}
+}
+
+// Enroll generates a new TOTP secret for the user, it has to be confirmed with a code before it is used
+func (s *MFAService) Enroll(ctx context.Context, u *response.User) (*response.TOTPEnrollment, *throw.ResponseError) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	enrolled, err := s.store.TOTP().Enroll(ctx, &model.TOTP{UserID: u.ID, Secret: secret})
+	if err != nil {
+		return nil, throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+	if !enrolled {
+		return nil, throw.NewResponseError(http.StatusConflict, errTOTPAlreadyEnabled)
+	}
+
+	return &response.TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(s.config.Issuer, u.Email, secret),
+	}, nil
+}
+
+// Confirm enables two-factor authentication and returns a fresh set of recovery codes
+func (s *MFAService) Confirm(
+	ctx context.Context,
+	userID uint64,
+	req *request.TOTPConfirm,
+) (*response.RecoveryCodes, *throw.ResponseError) {
+	t, err := s.store.TOTP().FindByUser(ctx, userID)
+	if err == store.ErrRecordNotFound {
+		return nil, throw.NewResponseError(http.StatusNotFound, errTOTPNotEnrolled)
+	}
+	if err != nil {
+		return nil, throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+	if t.Enabled() {
+		return nil, throw.NewResponseError(http.StatusConflict, errTOTPAlreadyEnabled)
+	}
+
+	ok, err := s.useCode(ctx, t, req.Code)
+	if err != nil {
+		return nil, throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+	if !ok {
+		return nil, throw.NewResponseError(http.StatusUnprocessableEntity, errInvalidMFACode)
+	}
+
+	codes, err := s.newRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	if err := s.store.TOTP().Confirm(ctx, userID); err != nil {
+		return nil, throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	return &response.RecoveryCodes{RecoveryCodes: codes}, nil
+}
+
+// Disable turns two-factor authentication off, it requires the current password and a valid code or recovery code.
+// The wrong codes are counted like the ones of the login, so a stolen access token can't guess them.
+func (s *MFAService) Disable(ctx context.Context, userID uint64, req *request.MFADisable) *throw.ResponseError {
+	u, err := s.store.User().Find(ctx, userID)
+	if err == store.ErrRecordNotFound {
+		return throw.NewResponseError(http.StatusNotFound, errUserNotFound)
+	}
+	if err != nil {
+		return throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	if err := checkCurrentPassword(s.hasher, u, req.CurrentPassword); err != nil {
+		return err
+	}
+
+	t, err := s.store.TOTP().FindByUser(ctx, u.ID)
+	if err == store.ErrRecordNotFound {
+		return throw.NewResponseError(http.StatusNotFound, errTOTPNotEnabled)
+	}
+	if err != nil {
+		return throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	if t.Enabled() {
+		if err := s.throttle.CheckMFA(ctx, u.Email); err != nil {
+			return err
+		}
+
+		ok, err := s.verify(ctx, t, &req.MFACode)
+		if err != nil {
+			return throw.NewResponseError(http.StatusInternalServerError, err)
+		}
+		if !ok {
+			if err := s.throttle.FailMFA(ctx, u.ID, u.Email); err != nil {
+				log.Error(fmt.Errorf("MFA failure count error: %w", err))
+			}
+
+			return throw.NewResponseError(http.StatusUnprocessableEntity, errInvalidMFACode)
+		}
+	}
+
+	if err := s.store.RecoveryCode().DeleteByUser(ctx, u.ID); err != nil {
+		return throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+	if err := s.store.TOTP().Delete(ctx, u.ID); err != nil {
+		return throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
+
+// Challenge issues an MFA challenge if the user has two-factor authentication enabled, nil otherwise
+func (s *MFAService) Challenge(ctx context.Context, u *model.User) (*response.MFAChallenge, *throw.ResponseError) {
+	t, err := s.store.TOTP().FindByUser(ctx, u.ID)
+	if err == store.ErrRecordNotFound || (err == nil && !t.Enabled()) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	id, err := s.memoryStore.Challenge().Create(ctx, u.ID, s.config.ChallengeTTL)
+	if err != nil {
+		return nil, throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	return &response.MFAChallenge{
+		MFARequired: true,
+		MFAToken:    id,
+		ExpiresIn:   int(s.config.ChallengeTTL / time.Second),
+	}, nil
+}
+
+// VerifyChallenge exchanges the challenge and a code for the user the challenge was issued for.
+// The failed codes are counted by user, so new challenges don't give new guesses, see LoginThrottle.FailMFA.
+// The user is returned with the error of a wrong code too, so the failure can be audited.
+func (s *MFAService) VerifyChallenge(ctx context.Context, req *request.LoginMFA) (*model.User, *throw.ResponseError) {
+	userID, err := s.memoryStore.Challenge().Find(ctx, req.MFAToken)
+	if err != nil {
+		return nil, throw.NewResponseError(http.StatusUnauthorized, errMFAChallengeExpired)
+	}
+
+	u, err := s.store.User().Find(ctx, userID)
+	if err != nil || u.Disabled() {
+		return nil, throw.NewResponseError(http.StatusUnauthorized, errMFAChallengeExpired)
+	}
+
+	if err := s.throttle.CheckMFA(ctx, u.Email); err != nil {
+		return nil, err
+	}
+
+	t, err := s.store.TOTP().FindByUser(ctx, userID)
+	if err != nil {
+		return nil, throw.NewResponseError(http.StatusUnauthorized, errMFAChallengeExpired)
+	}
+
+	ok, err := s.verify(ctx, t, &req.MFACode)
+	if err != nil {
+		return nil, throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+	if !ok {
+		if err := s.throttle.FailMFA(ctx, userID, u.Email); err != nil {
+			log.Error(fmt.Errorf("MFA failure count error: %w", err))
+		}
+		if err := s.memoryStore.Challenge().Fail(ctx, req.MFAToken, maxChallengeAttempts); err != nil {
+			return u, throw.NewResponseError(http.StatusInternalServerError, err)
+		}
+
+		return u, throw.NewResponseError(http.StatusUnauthorized, errInvalidMFACode)
+	}
+
+	if err := s.memoryStore.Challenge().Delete(ctx, req.MFAToken); err != nil {
+		return nil, throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	return u, nil
+}
+
+func (s *MFAService) verify(ctx context.Context, t *model.TOTP, req *request.MFACode) (bool, error) {
+	if req.RecoveryCode != "" {
+		return s.store.RecoveryCode().Use(ctx, t.UserID, hashRecoveryCode(req.RecoveryCode))
+	}
+
+	return s.useCode(ctx, t, req.Code)
+}
+
+// useCode validates the code and burns its time step, so it can't be replayed
+func (s *MFAService) useCode(ctx context.Context, t *model.TOTP, code string) (bool, error) {
+	step, ok := totp.Validate(t.Secret, code, time.Now(), totpAllowedClockDrifts)
+	if !ok {
+		return false, nil
+	}
+
+	return s.store.TOTP().UseStep(ctx, t.UserID, step)
+}
+
+func (s *MFAService) newRecoveryCodes(ctx context.Context, userID uint64) ([]string, error) {
+	codes := make([]string, recoveryCodesCount)
+	hashes := make([]string, recoveryCodesCount)
+
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+		codes[i] = code[:8] + "-" + code[8:]
+		hashes[i] = hashRecoveryCode(code)
+	}
+
+	if err := s.store.RecoveryCode().Replace(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// hashRecoveryCode hashes the code as typed by the user, whatever its case and separators
+func hashRecoveryCode(code string) string {
+	return model.HashSecret(strings.ToLower(recoveryCodeReplacement.Replace(code)))
+}
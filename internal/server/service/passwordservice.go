@@ -0,0 +1,329 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"godmin/config"
+	"godmin/internal/dto"
+	"godmin/internal/mail"
+	"godmin/internal/model"
+	"godmin/internal/password"
+	"godmin/internal/server/request"
+	"godmin/internal/store"
+	"godmin/internal/throw"
+	"net/http"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	log "github.com/sirupsen/logrus"
+)
+
+const resetTokenBytes = 32
+
+var (
+	errInvalidResetToken = errors.New("invalid or expired password reset token")
+	errUserNotFound      = errors.New("user not found")
+	errWrongPassword     = errors.New("is wrong")
+)
+
+// PasswordService lets users who forgot their password set a new one through an emailed link
+type PasswordService struct {
+	store       store.Store
+	memoryStore store.MemoryStore
+	hasher      *password.Hasher
+	mailer      mail.Mailer
+	config      *config.Password
+	policy      *password.Policy
+	throttle    *MailThrottle
+}
+
+// NewPasswordService construct new PasswordService
+func NewPasswordService(
+	store store.Store,
+	memoryStore store.MemoryStore,
+	hasher *password.Hasher,
+	mailer mail.Mailer,
+	passwordConfig *config.Password,
+	policy *password.Policy,
+	throttle *MailThrottle,
+) *PasswordService {
+	return &PasswordService{
+		store:       store,
+		memoryStore: memoryStore,
+		hasher:      hasher,
+		mailer:      mailer,
+		config:      passwordConfig,
+		policy:      policy,
+		throttle:    throttle,
+	}
+}
+
+// Check applies the password policy to the new password of the user.
+// The former passwords of an existing user can't be chosen again.
+func (s *PasswordService) Check(ctx context.Context, u *model.User, newPassword string) *throw.ResponseError {
+	if err := s.policy.Check(newPassword, u.Email, u.Name); err != nil {
+		return passwordError(err)
+	}
+
+	if u.ID == 0 || s.policy.HistorySize() == 0 {
+		return nil
+	}
+
+	history, err := s.store.PasswordHistory().FindByUser(ctx, u.ID, s.policy.HistorySize())
+	if err != nil {
+		return throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	for _, encrypted := range append([]string{u.EncryptedPassword}, history...) {
+		if s.hasher.Verify(newPassword, encrypted) {
+			return passwordError(password.ErrReused)
+		}
+	}
+
+	return nil
+}
+
+// Change checks the new password and sets it, the former one joins the history
+func (s *PasswordService) Change(
+	ctx context.Context,
+	u *model.User,
+	newPassword string,
+) (*model.User, *throw.ResponseError) {
+	if err := s.Check(ctx, u, newPassword); err != nil {
+		return nil, err
+	}
+
+	return s.Set(ctx, u, newPassword)
+}
+
+// Set changes a password which passed Check, the former one joins the history
+func (s *PasswordService) Set(ctx context.Context, u *model.User, newPassword string) (*model.User, *throw.ResponseError) {
+	return s.update(ctx, u.ID, &model.UserChanges{Password: &newPassword})
+}
+
+// UpdateUser applies the changes of an administrator to the user in one write, a new password has to pass Check
+// first. The former password joins the history and every session of the user is revoked, like after a reset.
+func (s *PasswordService) UpdateUser(
+	ctx context.Context,
+	id uint64,
+	c *model.UserChanges,
+) (*model.User, *throw.ResponseError) {
+	u, err := s.update(ctx, id, c)
+	if err != nil || c.Password == nil {
+		return u, err
+	}
+
+	revoked, revokeErr := s.memoryStore.Token().RevokeUserFamilies(ctx, id)
+	if revokeErr != nil {
+		return nil, throw.NewResponseError(http.StatusInternalServerError, revokeErr)
+	}
+
+	log.WithFields(log.Fields{
+		"user_id":  id,
+		"sessions": revoked,
+	}).Info("password set, sessions revoked")
+
+	return u, nil
+}
+
+func (s *PasswordService) update(ctx context.Context, id uint64, c *model.UserChanges) (*model.User, *throw.ResponseError) {
+	if c.Password != nil {
+		c.KeepPasswords = s.policy.HistorySize()
+	}
+
+	updated, err := s.store.User().Update(ctx, id, c)
+	switch err {
+	case nil:
+		return updated, nil
+	case store.ErrRecordNotFound:
+		return nil, throw.NewResponseError(http.StatusNotFound, errUserNotFound)
+	case store.ErrEmailUsed:
+		return nil, throw.NewResponseError(http.StatusUnprocessableEntity, err)
+	default:
+		return nil, throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+}
+
+// ChangeOwn lets a logged in user change their password. Every session of the user but the current one is revoked,
+// the callers authenticated by an API key have no session so all of them are.
+func (s *PasswordService) ChangeOwn(
+	ctx context.Context,
+	u *model.User,
+	req *request.PasswordChange,
+	sessionID string,
+) (int, *throw.ResponseError) {
+	if err := checkCurrentPassword(s.hasher, u, req.CurrentPassword); err != nil {
+		return 0, err
+	}
+
+	if _, err := s.Change(ctx, u, req.Password); err != nil {
+		return 0, err
+	}
+
+	families, err := s.memoryStore.Token().FindUserFamilies(ctx, u.ID)
+	if err != nil {
+		return 0, throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	revoked := 0
+	for _, f := range families {
+		if f.ID == sessionID {
+			continue
+		}
+
+		if err := s.memoryStore.Token().RevokeFamily(ctx, f.ID); err == store.ErrRecordNotFound {
+			continue
+		} else if err != nil {
+			return revoked, throw.NewResponseError(http.StatusInternalServerError, err)
+		}
+		revoked++
+	}
+
+	log.WithFields(log.Fields{
+		"user_id":  u.ID,
+		"sessions": revoked,
+	}).Info("password changed, other sessions revoked")
+
+	return revoked, nil
+}
+
+// Forgot emails a reset link to the user. Unknown and disabled users are silently ignored, and the failures
+// to send the link are only logged, so the response doesn't tell which emails have an account.
+func (s *PasswordService) Forgot(ctx context.Context, req *request.PasswordForgot, c *dto.Client) *throw.ResponseError {
+	if err := s.throttle.Allow(ctx, mailPurposeReset, req.Email, c.IP); err != nil {
+		return err
+	}
+
+	u, err := s.store.User().FindByEmail(ctx, req.Email)
+	if err == store.ErrRecordNotFound {
+		return nil
+	}
+	if err != nil {
+		return throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+	if u.Disabled() {
+		return nil
+	}
+
+	if err := s.sendResetLink(ctx, u); err != nil {
+		log.WithField("user_id", u.ID).Error(err)
+	}
+
+	return nil
+}
+
+// sendResetLink stores a new reset token of the user and emails the link
+func (s *PasswordService) sendResetLink(ctx context.Context, u *model.User) error {
+	token, err := newResetToken()
+	if err != nil {
+		return err
+	}
+
+	if err := s.memoryStore.PasswordReset().Create(ctx, u.ID, model.HashSecret(token), s.config.ResetTTL); err != nil {
+		return err
+	}
+
+	link, err := s.resetLink(token)
+	if err != nil {
+		return err
+	}
+
+	if err := s.mailer.Send(&mail.Message{
+		To:      u.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nFollow the link to choose a new password, it expires in %v:\n\n%s\n\n"+
+				"If you didn't ask for it, ignore this email, your password stays the same.\n",
+			u.Name,
+			s.config.ResetTTL,
+			link,
+		),
+	}); err != nil {
+		return fmt.Errorf("password reset email error: %w", err)
+	}
+
+	return nil
+}
+
+// Reset sets the new password and revokes every session of the user, the token can't be used again.
+// A password refused by the policy leaves the token usable.
+func (s *PasswordService) Reset(ctx context.Context, req *request.PasswordReset) *throw.ResponseError {
+	tokenHash := model.HashSecret(req.Token)
+
+	userID, err := s.memoryStore.PasswordReset().Find(ctx, tokenHash)
+	if err == store.ErrRecordNotFound {
+		return throw.NewResponseError(http.StatusBadRequest, errInvalidResetToken)
+	}
+	if err != nil {
+		return throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	u, err := s.store.User().Find(ctx, userID)
+	if err == store.ErrRecordNotFound {
+		return throw.NewResponseError(http.StatusBadRequest, errInvalidResetToken)
+	}
+	if err != nil {
+		return throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	if err := s.Check(ctx, u, req.Password); err != nil {
+		return err
+	}
+
+	// consuming is what makes the token single-use, a concurrent reset may have been first
+	if _, err := s.memoryStore.PasswordReset().Consume(ctx, tokenHash); err == store.ErrRecordNotFound {
+		return throw.NewResponseError(http.StatusBadRequest, errInvalidResetToken)
+	} else if err != nil {
+		return throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	if _, err := s.Set(ctx, u, req.Password); err != nil {
+		return err
+	}
+
+	revoked, err := s.memoryStore.Token().RevokeUserFamilies(ctx, u.ID)
+	if err != nil {
+		return throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	log.WithFields(log.Fields{
+		"user_id":  u.ID,
+		"sessions": revoked,
+	}).Info("password reset, sessions revoked")
+
+	return nil
+}
+
+func (s *PasswordService) resetLink(token string) (string, error) {
+	link, err := tokenLink(s.config.ResetURL, token)
+	if err != nil {
+		return "", fmt.Errorf("invalid PASSWORD_RESET_URL: %w", err)
+	}
+
+	return link, nil
+}
+
+func newResetToken() (string, error) {
+	b := make([]byte, resetTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// checkCurrentPassword makes sure the caller knows the password of the user before a sensitive change
+func checkCurrentPassword(h *password.Hasher, u *model.User, currentPassword string) *throw.ResponseError {
+	if !u.ComparePassword(h, currentPassword) {
+		return throw.NewResponseError(http.StatusBadRequest, validation.Errors{"current_password": errWrongPassword})
+	}
+
+	return nil
+}
+
+// passwordError reports the refused password like the validation errors of the request field
+func passwordError(err error) *throw.ResponseError {
+	return throw.NewResponseError(http.StatusBadRequest, validation.Errors{"password": err})
+}
@@ -0,0 +1,302 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"godmin/config"
+	"godmin/internal/dto"
+	"godmin/internal/mail"
+	"godmin/internal/model"
+	"godmin/internal/password"
+	"godmin/internal/server/request"
+	"godmin/internal/store"
+	"godmin/internal/throw"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	validation "github.com/go-ozzo/ozzo-validation"
+	log "github.com/sirupsen/logrus"
+)
+
+// the purposes tell the verification tokens from the email change ones, and from any other token signed with the same secret
+const (
+	verificationPurpose = "email_verification"
+	emailChangePurpose  = "email_change"
+)
+
+var (
+	errInvalidVerificationToken = errors.New("invalid or expired email verification token")
+	errInvalidEmailChangeToken  = errors.New("invalid or expired email change token")
+	errSameEmail                = errors.New("is your current email already")
+)
+
+// VerificationService proves the users own their email with a signed link sent to it
+type VerificationService struct {
+	store    store.Store
+	hasher   *password.Hasher
+	mailer   mail.Mailer
+	config   *config.Verification
+	throttle *MailThrottle
+}
+
+// NewVerificationService construct new VerificationService
+func NewVerificationService(
+	store store.Store,
+	hasher *password.Hasher,
+	mailer mail.Mailer,
+	verificationConfig *config.Verification,
+	throttle *MailThrottle,
+) *VerificationService {
+	return &VerificationService{
+		store:    store,
+		hasher:   hasher,
+		mailer:   mailer,
+		config:   verificationConfig,
+		throttle: throttle,
+	}
+}
+
+// Send emails the verification link to the current email of the user
+func (s *VerificationService) Send(u *model.User) error {
+	token, err := s.createToken(jwt.MapClaims{
+		"purpose": verificationPurpose,
+		"user_id": u.ID,
+		"email":   u.Email,
+	})
+	if err != nil {
+		return err
+	}
+
+	link, err := tokenLink(s.config.URL, token)
+	if err != nil {
+		return fmt.Errorf("invalid EMAIL_VERIFICATION_URL: %w", err)
+	}
+
+	if err := s.mailer.Send(&mail.Message{
+		To:      u.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nFollow the link to verify your email, it expires in %v:\n\n%s\n",
+			u.Name,
+			s.config.TTL,
+			link,
+		),
+	}); err != nil {
+		return fmt.Errorf("email verification email error: %w", err)
+	}
+
+	return nil
+}
+
+// Notify sends the link to the user. A failure is only logged, the user can ask for a new link.
+func (s *VerificationService) Notify(u *model.User) {
+	if err := s.Send(u); err != nil {
+		log.WithField("user_id", u.ID).Error(err)
+	}
+}
+
+// Resend sends a new link. Unknown, disabled and verified users are silently ignored, and the failures
+// to send the link are only logged, so the response doesn't tell which emails have an account.
+func (s *VerificationService) Resend(
+	ctx context.Context,
+	req *request.VerificationResend,
+	c *dto.Client,
+) *throw.ResponseError {
+	if err := s.throttle.Allow(ctx, mailPurposeVerification, req.Email, c.IP); err != nil {
+		return err
+	}
+
+	u, err := s.store.User().FindByEmail(ctx, req.Email)
+	if err == store.ErrRecordNotFound {
+		return nil
+	}
+	if err != nil {
+		return throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+	if u.Disabled() || u.EmailVerified() {
+		return nil
+	}
+
+	s.Notify(u)
+
+	return nil
+}
+
+// Verify marks the email of the link verified. The link stops working once the user changes their email.
+func (s *VerificationService) Verify(ctx context.Context, token string) (*model.User, *throw.ResponseError) {
+	claims, err := s.parseToken(token, verificationPurpose)
+	if err != nil {
+		return nil, throw.NewResponseError(http.StatusBadRequest, errInvalidVerificationToken)
+	}
+
+	u, err := s.store.User().VerifyEmail(ctx, claims.userID, claims.email)
+	if err == store.ErrRecordNotFound {
+		return nil, throw.NewResponseError(http.StatusBadRequest, errInvalidVerificationToken)
+	}
+	if err != nil {
+		return nil, throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	return u, nil
+}
+
+// RequestEmailChange emails a confirmation link to the new email, the user keeps the current one until it is followed
+func (s *VerificationService) RequestEmailChange(
+	ctx context.Context,
+	u *model.User,
+	req *request.EmailChange,
+) *throw.ResponseError {
+	if err := checkCurrentPassword(s.hasher, u, req.CurrentPassword); err != nil {
+		return err
+	}
+
+	if strings.EqualFold(u.Email, req.Email) {
+		return throw.NewResponseError(http.StatusBadRequest, validation.Errors{"email": errSameEmail})
+	}
+
+	if _, err := s.store.User().FindByEmail(ctx, req.Email); err == nil {
+		return throw.NewResponseError(http.StatusUnprocessableEntity, store.ErrEmailUsed)
+	} else if err != store.ErrRecordNotFound {
+		return throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	token, err := s.createToken(jwt.MapClaims{
+		"purpose":   emailChangePurpose,
+		"user_id":   u.ID,
+		"email":     u.Email,
+		"new_email": req.Email,
+	})
+	if err != nil {
+		return throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	link, err := tokenLink(s.config.ChangeURL, token)
+	if err != nil {
+		return throw.NewResponseError(http.StatusInternalServerError, fmt.Errorf("invalid EMAIL_CHANGE_URL: %w", err))
+	}
+
+	if err := s.mailer.Send(&mail.Message{
+		To:      req.Email,
+		Subject: "Confirm your new email",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nFollow the link to use this email for your account, it expires in %v:\n\n%s\n\n"+
+				"If you didn't ask for it, ignore this email.\n",
+			u.Name,
+			s.config.TTL,
+			link,
+		),
+	}); err != nil {
+		return throw.NewResponseError(http.StatusInternalServerError, fmt.Errorf("email change email error: %w", err))
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange switches the user to the new email of the link, which is verified by following it,
+// and returns the user before and after the change. The link stops working once the user has another email,
+// so it is used only once.
+func (s *VerificationService) ConfirmEmailChange(
+	ctx context.Context,
+	token string,
+) (*model.User, *model.User, *throw.ResponseError) {
+	claims, err := s.parseToken(token, emailChangePurpose)
+	if err != nil || claims.newEmail == "" {
+		return nil, nil, throw.NewResponseError(http.StatusBadRequest, errInvalidEmailChangeToken)
+	}
+
+	u, err := s.store.User().Find(ctx, claims.userID)
+	if err == store.ErrRecordNotFound || (err == nil && u.Email != claims.email) {
+		return nil, nil, throw.NewResponseError(http.StatusBadRequest, errInvalidEmailChangeToken)
+	}
+	if err != nil {
+		return nil, nil, throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	// the link proves the new email, it is verified in the same write so it is never left unverified
+	updated, err := s.store.User().Update(ctx, u.ID, &model.UserChanges{Email: &claims.newEmail, EmailVerified: true})
+	if err == store.ErrEmailUsed {
+		return nil, nil, throw.NewResponseError(http.StatusUnprocessableEntity, err)
+	}
+	if err != nil {
+		return nil, nil, throw.NewResponseError(http.StatusInternalServerError, err)
+	}
+
+	s.notifyEmailChanged(u, claims.newEmail)
+
+	return u, updated, nil
+}
+
+// notifyEmailChanged tells the former email of the user about the change. A failure is only logged.
+func (s *VerificationService) notifyEmailChanged(u *model.User, newEmail string) {
+	if err := s.mailer.Send(&mail.Message{
+		To:      u.Email,
+		Subject: "Your email has been changed",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nThe email of your account is %s now.\n\n"+
+				"If you didn't change it, contact an administrator.\n",
+			u.Name,
+			newEmail,
+		),
+	}); err != nil {
+		log.WithField("user_id", u.ID).Error(fmt.Errorf("email change notice error: %w", err))
+	}
+}
+
+// signedClaims are the claims of the verification and email change tokens
+type signedClaims struct {
+	userID   uint64
+	email    string
+	newEmail string
+}
+
+// createToken signs the claims, they expire after the TTL
+func (s *VerificationService) createToken(claims jwt.MapClaims) (string, error) {
+	claims["exp"] = time.Now().Add(s.config.TTL).Unix()
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.config.Secret))
+}
+
+func (s *VerificationService) parseToken(tokenString string, purpose string) (*signedClaims, error) {
+	token, err := parseToken(tokenString, s.config.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["purpose"] != purpose {
+		return nil, errInvalidVerificationToken
+	}
+
+	email, ok := claims["email"].(string)
+	if !ok {
+		return nil, errInvalidVerificationToken
+	}
+
+	userID, err := strconv.ParseUint(fmt.Sprintf("%.f", claims["user_id"]), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	newEmail, _ := claims["new_email"].(string)
+
+	return &signedClaims{userID: userID, email: email, newEmail: newEmail}, nil
+}
+
+// tokenLink adds the token to the URL as the token parameter
+func tokenLink(base string, token string) (string, error) {
+	link, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+
+	q := link.Query()
+	q.Set("token", token)
+	link.RawQuery = q.Encode()
+
+	return link.String(), nil
+}
@@ -4,4 +4,8 @@ import "errors"
 
 var (
 	ErrRecordNotFound = errors.New("record not found")
+	ErrTokenReused    = errors.New("refresh token reused")
+	ErrEmailUsed      = errors.New("already used email")
+	// ErrConstraintViolation is wrapped with the database message, e.g. a duplicate key or a missing reference
+	ErrConstraintViolation = errors.New("constraint violation")
 )
@@ -0,0 +1,71 @@
+package memorystore
+
+import (
+	"context"
+	"github.com/go-redis/redis/v7"
+	"github.com/google/uuid"
+	"godmin/internal/store"
+	"strconv"
+	"time"
+)
+
+const challengeKeyPrefix = "mfa_challenge:"
+
+// failChallenge counts a failed attempt and drops the challenge once ARGV[1] attempts are reached.
+// A challenge that has expired in the meantime is left alone.
+var failChallenge = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+if redis.call("HINCRBY", KEYS[1], "attempts", 1) >= tonumber(ARGV[1]) then
+	redis.call("DEL", KEYS[1])
+end
+return 1
+`)
+
+// ChallengeRepository keeps the MFA challenges issued after a successful password check
+type ChallengeRepository struct {
+	store *Store
+}
+
+// Create issues a new challenge for the user and returns its id
+func (r *ChallengeRepository) Create(ctx context.Context, userId uint64, ttl time.Duration) (string, error) {
+	id := uuid.New().String()
+
+	_, err := r.store.client.WithContext(ctx).TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HSet(challengeKey(id), "user_id", strconv.FormatUint(userId, 10), "attempts", 0)
+		pipe.Expire(challengeKey(id), ttl)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// Find returns the id of the user the challenge was issued for
+func (r *ChallengeRepository) Find(ctx context.Context, id string) (uint64, error) {
+	userIdRaw, err := r.store.client.WithContext(ctx).HGet(challengeKey(id), "user_id").Result()
+	if err == redis.Nil {
+		return 0, store.ErrRecordNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(userIdRaw, 10, 64)
+}
+
+// Fail counts a failed attempt, the challenge is dropped once maxAttempts is reached
+func (r *ChallengeRepository) Fail(ctx context.Context, id string, maxAttempts int) error {
+	return failChallenge.Run(r.store.client.WithContext(ctx), []string{challengeKey(id)}, maxAttempts).Err()
+}
+
+func (r *ChallengeRepository) Delete(ctx context.Context, id string) error {
+	return r.store.client.WithContext(ctx).Del(challengeKey(id)).Err()
+}
+
+func challengeKey(id string) string {
+	return challengeKeyPrefix + id
+}
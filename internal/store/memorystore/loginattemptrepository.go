@@ -0,0 +1,152 @@
+package memorystore
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v7"
+	"github.com/google/uuid"
+	"godmin/internal/dto"
+	"strconv"
+	"time"
+)
+
+const (
+	loginFailuresKeyPrefix = "login_failures:"
+	loginLockKeyPrefix     = "login_lock:"
+)
+
+// loginFailures returns the count and the oldest and latest scores of the failures of the window.
+// KEYS[1] is the sorted set of the failure times in milliseconds, ARGV[1] is now and ARGV[2] the window.
+const loginFailures = `
+local min = "(" .. (tonumber(ARGV[1]) - tonumber(ARGV[2]))
+local count = redis.call("ZCOUNT", KEYS[1], min, "+inf")
+if count == 0 then
+	return {0, "0", "0"}
+end
+local oldest = redis.call("ZRANGEBYSCORE", KEYS[1], min, "+inf", "WITHSCORES", "LIMIT", 0, 1)
+local latest = redis.call("ZREVRANGEBYSCORE", KEYS[1], "+inf", min, "WITHSCORES", "LIMIT", 0, 1)
+return {count, oldest[2], latest[2]}
+`
+
+// failLogin drops the failures which left the window and records a new one, ARGV[3] is its unique member
+var failLogin = redis.NewScript(`
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", tonumber(ARGV[1]) - tonumber(ARGV[2]))
+redis.call("ZADD", KEYS[1], ARGV[1], ARGV[3])
+redis.call("PEXPIRE", KEYS[1], ARGV[2])
+` + loginFailures)
+
+var countLoginFailures = redis.NewScript(loginFailures)
+
+// LoginAttemptRepository counts the failed logins in sliding windows and keeps the lockouts
+type LoginAttemptRepository struct {
+	store *Store
+}
+
+// Fail records a failed login and returns the failures of the window, the new one included
+func (r *LoginAttemptRepository) Fail(ctx context.Context, key string, window time.Duration) (*dto.LoginFailures, error) {
+	res, err := failLogin.Run(
+		r.store.client.WithContext(ctx),
+		[]string{loginFailuresKey(key)},
+		time.Now().UnixNano()/int64(time.Millisecond),
+		window.Milliseconds(),
+		uuid.New().String(),
+	).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseLoginFailures(res)
+}
+
+// Failures returns the failures of the window
+func (r *LoginAttemptRepository) Failures(
+	ctx context.Context,
+	key string,
+	window time.Duration,
+) (*dto.LoginFailures, error) {
+	res, err := countLoginFailures.Run(
+		r.store.client.WithContext(ctx),
+		[]string{loginFailuresKey(key)},
+		time.Now().UnixNano()/int64(time.Millisecond),
+		window.Milliseconds(),
+	).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseLoginFailures(res)
+}
+
+// Reset forgets the failures of the key
+func (r *LoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	return r.store.client.WithContext(ctx).Del(loginFailuresKey(key)).Err()
+}
+
+func (r *LoginAttemptRepository) Lock(ctx context.Context, key string, d time.Duration) error {
+	return r.store.client.WithContext(ctx).Set(loginLockKey(key), 1, d).Err()
+}
+
+// LockedFor returns how long the key stays locked, zero if it isn't
+func (r *LoginAttemptRepository) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := r.store.client.WithContext(ctx).PTTL(loginLockKey(key)).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	// negative for a missing key
+	if ttl < 0 {
+		return 0, nil
+	}
+
+	return ttl, nil
+}
+
+func (r *LoginAttemptRepository) Unlock(ctx context.Context, key string) error {
+	return r.store.client.WithContext(ctx).Del(loginLockKey(key)).Err()
+}
+
+func parseLoginFailures(res interface{}) (*dto.LoginFailures, error) {
+	values, ok := res.([]interface{})
+	if !ok || len(values) != 3 {
+		return nil, fmt.Errorf("unexpected login failures reply %v", res)
+	}
+
+	count, ok := values[0].(int64)
+	if !ok {
+		return nil, fmt.Errorf("unexpected login failures count %v", values[0])
+	}
+
+	f := &dto.LoginFailures{Count: int(count)}
+	if count == 0 {
+		return f, nil
+	}
+
+	var err error
+	if f.Oldest, err = parseMilliseconds(values[1]); err != nil {
+		return nil, err
+	}
+	if f.Latest, err = parseMilliseconds(values[2]); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func parseMilliseconds(v interface{}) (time.Time, error) {
+	// scores are doubles
+	s, _ := v.(string)
+	ms, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unexpected login failure time %v", v)
+	}
+
+	return time.Unix(0, int64(ms)*int64(time.Millisecond)), nil
+}
+
+func loginFailuresKey(key string) string {
+	return loginFailuresKeyPrefix + key
+}
+
+func loginLockKey(key string) string {
+	return loginLockKeyPrefix + key
+}
@@ -0,0 +1,95 @@
+package memorystore
+
+import (
+	"context"
+	"github.com/go-redis/redis/v7"
+	"godmin/internal/store"
+	"strconv"
+	"time"
+)
+
+const (
+	passwordResetKeyPrefix     = "password_reset:"
+	userPasswordResetKeyPrefix = "user_password_reset:"
+)
+
+// createPasswordReset replaces the user's token: KEYS[1] is the user's index, KEYS[2] the new token,
+// ARGV[1] the user id, ARGV[2] the new hash and ARGV[3] the ttl in milliseconds
+var createPasswordReset = redis.NewScript(`
+local previous = redis.call("GET", KEYS[1])
+if previous then
+	redis.call("DEL", "` + passwordResetKeyPrefix + `" .. previous)
+end
+redis.call("SET", KEYS[2], ARGV[1], "PX", ARGV[3])
+redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+return 1
+`)
+
+// consumePasswordReset gets and deletes the token at once, so it is used only once.
+// KEYS[1] is the token, ARGV[1] its hash.
+var consumePasswordReset = redis.NewScript(`
+local userId = redis.call("GET", KEYS[1])
+if not userId then
+	return false
+end
+redis.call("DEL", KEYS[1])
+local index = "` + userPasswordResetKeyPrefix + `" .. userId
+if redis.call("GET", index) == ARGV[1] then
+	redis.call("DEL", index)
+end
+return userId
+`)
+
+// PasswordResetRepository keeps the hashes of the password reset tokens
+type PasswordResetRepository struct {
+	store *Store
+}
+
+// Create stores the token hash of the user, the previous token of the user stops working
+func (r *PasswordResetRepository) Create(ctx context.Context, userId uint64, tokenHash string, ttl time.Duration) error {
+	return createPasswordReset.Run(
+		r.store.client.WithContext(ctx),
+		[]string{userPasswordResetKey(userId), passwordResetKey(tokenHash)},
+		strconv.FormatUint(userId, 10),
+		tokenHash,
+		ttl.Milliseconds(),
+	).Err()
+}
+
+// Find returns the id of the user of the token without using it
+func (r *PasswordResetRepository) Find(ctx context.Context, tokenHash string) (uint64, error) {
+	userIdRaw, err := r.store.client.WithContext(ctx).Get(passwordResetKey(tokenHash)).Result()
+	if err == redis.Nil {
+		return 0, store.ErrRecordNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(userIdRaw, 10, 64)
+}
+
+// Consume deletes the token and returns the id of its user
+func (r *PasswordResetRepository) Consume(ctx context.Context, tokenHash string) (uint64, error) {
+	userIdRaw, err := consumePasswordReset.Run(
+		r.store.client.WithContext(ctx),
+		[]string{passwordResetKey(tokenHash)},
+		tokenHash,
+	).Text()
+	if err == redis.Nil {
+		return 0, store.ErrRecordNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(userIdRaw, 10, 64)
+}
+
+func passwordResetKey(tokenHash string) string {
+	return passwordResetKeyPrefix + tokenHash
+}
+
+func userPasswordResetKey(userId uint64) string {
+	return userPasswordResetKeyPrefix + strconv.FormatUint(userId, 10)
+}
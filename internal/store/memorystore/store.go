@@ -2,12 +2,17 @@ package memorystore
 
 import (
 	"github.com/go-redis/redis/v7"
+	"godmin/internal/store"
+	"godmin/internal/tracing"
 )
 
 type Store struct {
 	client *redis.Client
 
-	tokenRepository *TokenRepository
+	tokenRepository         *TokenRepository
+	challengeRepository     *ChallengeRepository
+	passwordResetRepository *PasswordResetRepository
+	loginAttemptRepository  *LoginAttemptRepository
 }
 
 func New(client *redis.Client) *Store {
@@ -16,7 +21,7 @@ func New(client *redis.Client) *Store {
 	}
 }
 
-func (s *Store) Token() *TokenRepository {
+func (s *Store) Token() store.TokenRepository {
 	if s.tokenRepository != nil {
 		return s.tokenRepository
 	}
@@ -28,10 +33,49 @@ func (s *Store) Token() *TokenRepository {
 	return s.tokenRepository
 }
 
+func (s *Store) Challenge() store.ChallengeRepository {
+	if s.challengeRepository != nil {
+		return s.challengeRepository
+	}
+
+	s.challengeRepository = &ChallengeRepository{
+		store: s,
+	}
+
+	return s.challengeRepository
+}
+
+func (s *Store) PasswordReset() store.PasswordResetRepository {
+	if s.passwordResetRepository != nil {
+		return s.passwordResetRepository
+	}
+
+	s.passwordResetRepository = &PasswordResetRepository{
+		store: s,
+	}
+
+	return s.passwordResetRepository
+}
+
+func (s *Store) LoginAttempt() store.LoginAttemptRepository {
+	if s.loginAttemptRepository != nil {
+		return s.loginAttemptRepository
+	}
+
+	s.loginAttemptRepository = &LoginAttemptRepository{
+		store: s,
+	}
+
+	return s.loginAttemptRepository
+}
+
+// NewClient connects to Redis, the commands are traced
 func NewClient(memoryStoreUrl string) (*redis.Client, error) {
 	client := redis.NewClient(&redis.Options{
 		Addr: memoryStoreUrl,
 	})
+	// before any WithContext, the clones keep the hooks they were made with
+	client.AddHook(tracing.RedisHook{})
 
 	if _, err := client.Ping().Result(); err != nil {
 		return nil, err
@@ -1,35 +1,51 @@
 package memorystore
 
 import (
+	"context"
+	"github.com/go-redis/redis/v7"
 	"godmin/internal/dto"
+	"godmin/internal/store"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
+const (
+	familyKeyPrefix       = "token_family:"
+	userSessionsKeyPrefix = "user_sessions:"
+)
+
+// touchFamily updates last_seen_at only if the family still exists,
+// so a revoked session is never recreated without an expiry.
+var touchFamily = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return redis.call("HSET", KEYS[1], "last_seen_at", ARGV[1])
+end
+return 0
+`)
+
 type TokenRepository struct {
 	store *Store
 }
 
-func (r *TokenRepository) Create(userId uint64, t *dto.Token) error {
-	at := time.Unix(t.AccessTokenExpires, 0) //converting Unix to UTC(to Time object)
-	rt := time.Unix(t.RefreshTokenExpires, 0)
-	now := time.Now()
+func (r *TokenRepository) Create(ctx context.Context, userId uint64, t *dto.Token, c *dto.Client) error {
+	_, err := r.store.client.WithContext(ctx).TxPipelined(func(pipe redis.Pipeliner) error {
+		setToken(pipe, userId, t)
+		pipe.HSet(
+			familyKey(t.FamilyID),
+			"created_at", strconv.FormatInt(time.Now().Unix(), 10),
+			"ip", c.IP,
+			"user_agent", c.UserAgent,
+		)
+		return nil
+	})
 
-	errAccess := r.store.client.Set(t.AccessUuid, strconv.Itoa(int(userId)), at.Sub(now)).Err()
-	if errAccess != nil {
-		return errAccess
-	}
-
-	errRefresh := r.store.client.Set(t.RefreshUuid, strconv.Itoa(int(userId)), rt.Sub(now)).Err()
-	if errRefresh != nil {
-		return errRefresh
-	}
-
-	return nil
+	return err
 }
 
-func (r *TokenRepository) Find(accessUuid string) (uint64, error) {
-	userIdRaw, err := r.store.client.Get(accessUuid).Result()
+func (r *TokenRepository) Find(ctx context.Context, accessUuid string) (uint64, error) {
+	userIdRaw, err := r.store.client.WithContext(ctx).Get(accessUuid).Result()
 	if err != nil {
 		return 0, err
 	}
@@ -39,11 +55,221 @@ func (r *TokenRepository) Find(accessUuid string) (uint64, error) {
 	return userId, nil
 }
 
-func (r *TokenRepository) Delete(accessUuid string) (int64, error) {
-	deleted, err := r.store.client.Del(accessUuid).Result()
+func (r *TokenRepository) Delete(ctx context.Context, accessUuid string) (int64, error) {
+	deleted, err := r.store.client.WithContext(ctx).Del(accessUuid).Result()
 	if err != nil {
 		return 0, err
 	}
 
 	return deleted, nil
 }
+
+// FindFamily returns the current state of the token family
+func (r *TokenRepository) FindFamily(ctx context.Context, familyID string) (*dto.TokenFamily, error) {
+	return findFamily(r.store.client.WithContext(ctx), familyID)
+}
+
+// FindUserFamilies returns the active token families (sessions) of the user, the most recent first
+func (r *TokenRepository) FindUserFamilies(ctx context.Context, userId uint64) ([]*dto.TokenFamily, error) {
+	client := r.store.client.WithContext(ctx)
+
+	ids, err := client.SMembers(userSessionsKey(userId)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	families := make([]*dto.TokenFamily, 0, len(ids))
+	for _, id := range ids {
+		f, err := r.FindFamily(ctx, id)
+		if err == store.ErrRecordNotFound {
+			// the family has expired, drop it from the index
+			client.SRem(userSessionsKey(userId), id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		families = append(families, f)
+	}
+
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].CreatedAt.After(families[j].CreatedAt)
+	})
+
+	return families, nil
+}
+
+// Touch records the family has just been used
+func (r *TokenRepository) Touch(ctx context.Context, familyID string) error {
+	return touchFamily.Run(
+		r.store.client.WithContext(ctx),
+		[]string{familyKey(familyID)},
+		strconv.FormatInt(time.Now().Unix(), 10),
+	).Err()
+}
+
+// Rotate replaces the family's current token pair with the next one.
+// It returns store.ErrTokenReused if refreshUuid is not the latest refresh token of the family.
+func (r *TokenRepository) Rotate(ctx context.Context, familyID string, refreshUuid string, next *dto.Token) error {
+	return r.store.client.WithContext(ctx).Watch(func(tx *redis.Tx) error {
+		f, err := findFamily(tx, familyID)
+		if err != nil {
+			return err
+		}
+
+		if f.RefreshUuid != refreshUuid {
+			return store.ErrTokenReused
+		}
+
+		_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+			pipe.Del(f.AccessUuid, f.RefreshUuid)
+			setToken(pipe, f.UserID, next)
+			return nil
+		})
+
+		return err
+	}, familyKey(familyID))
+}
+
+// RevokeFamily deletes the family together with its current access and refresh tokens
+func (r *TokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	f, err := r.FindFamily(ctx, familyID)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.store.client.WithContext(ctx).TxPipelined(func(pipe redis.Pipeliner) error {
+		revokeFamily(pipe, f)
+		return nil
+	})
+
+	return err
+}
+
+// RevokeUserFamilies deletes every token family of the user and returns how many were revoked
+func (r *TokenRepository) RevokeUserFamilies(ctx context.Context, userId uint64) (int, error) {
+	families, err := r.FindUserFamilies(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = r.store.client.WithContext(ctx).TxPipelined(func(pipe redis.Pipeliner) error {
+		for _, f := range families {
+			revokeFamily(pipe, f)
+		}
+		pipe.Del(userSessionsKey(userId))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(families), nil
+}
+
+// RevokeAll deletes every token family of every user and returns how many were revoked
+func (r *TokenRepository) RevokeAll(ctx context.Context) (int, error) {
+	client := r.store.client.WithContext(ctx)
+	revoked := 0
+
+	iter := client.Scan(0, familyKeyPrefix+"*", 100).Iterator()
+	for iter.Next() {
+		f, err := findFamily(client, strings.TrimPrefix(iter.Val(), familyKeyPrefix))
+		if err == store.ErrRecordNotFound {
+			continue
+		}
+		if err != nil {
+			return revoked, err
+		}
+
+		if _, err := client.TxPipelined(func(pipe redis.Pipeliner) error {
+			revokeFamily(pipe, f)
+			return nil
+		}); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	if err := iter.Err(); err != nil {
+		return revoked, err
+	}
+
+	// drop the indexes of the families which expired on their own
+	iter = client.Scan(0, userSessionsKeyPrefix+"*", 100).Iterator()
+	for iter.Next() {
+		if err := client.Del(iter.Val()).Err(); err != nil {
+			return revoked, err
+		}
+	}
+
+	return revoked, iter.Err()
+}
+
+func setToken(pipe redis.Pipeliner, userId uint64, t *dto.Token) {
+	at := time.Unix(t.AccessTokenExpires, 0) //converting Unix to UTC(to Time object)
+	rt := time.Unix(t.RefreshTokenExpires, 0)
+	now := time.Now()
+
+	pipe.Set(t.AccessUuid, strconv.Itoa(int(userId)), at.Sub(now))
+	pipe.Set(t.RefreshUuid, strconv.Itoa(int(userId)), rt.Sub(now))
+
+	pipe.HSet(
+		familyKey(t.FamilyID),
+		"user_id", strconv.Itoa(int(userId)),
+		"access_uuid", t.AccessUuid,
+		"refresh_uuid", t.RefreshUuid,
+		"last_seen_at", strconv.FormatInt(now.Unix(), 10),
+	)
+	pipe.ExpireAt(familyKey(t.FamilyID), rt)
+
+	// the index lives as long as the most recently refreshed family
+	pipe.SAdd(userSessionsKey(userId), t.FamilyID)
+	pipe.ExpireAt(userSessionsKey(userId), rt)
+}
+
+func revokeFamily(pipe redis.Pipeliner, f *dto.TokenFamily) {
+	pipe.Del(f.AccessUuid, f.RefreshUuid, familyKey(f.ID))
+	pipe.SRem(userSessionsKey(f.UserID), f.ID)
+}
+
+func findFamily(c redis.Cmdable, familyID string) (*dto.TokenFamily, error) {
+	fields, err := c.HGetAll(familyKey(familyID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) == 0 {
+		return nil, store.ErrRecordNotFound
+	}
+
+	userId, err := strconv.ParseUint(fields["user_id"], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.TokenFamily{
+		ID:          familyID,
+		UserID:      userId,
+		AccessUuid:  fields["access_uuid"],
+		RefreshUuid: fields["refresh_uuid"],
+		CreatedAt:   parseUnix(fields["created_at"]),
+		LastSeenAt:  parseUnix(fields["last_seen_at"]),
+		IP:          fields["ip"],
+		UserAgent:   fields["user_agent"],
+	}, nil
+}
+
+func parseUnix(s string) time.Time {
+	sec, _ := strconv.ParseInt(s, 10, 64)
+
+	return time.Unix(sec, 0)
+}
+
+func familyKey(familyID string) string {
+	return familyKeyPrefix + familyID
+}
+
+func userSessionsKey(userId uint64) string {
+	return userSessionsKeyPrefix + strconv.FormatUint(userId, 10)
+}
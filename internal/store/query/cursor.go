@@ -0,0 +1,124 @@
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Page holds the cursors of the neighbouring pages, empty if there is no such page
+type Page struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+type cursor struct {
+	values   []interface{}
+	backward bool
+}
+
+type cursorPayload struct {
+	Sort     string   `json:"s"`
+	Values   []string `json:"v"`
+	Backward bool     `json:"b,omitempty"`
+}
+
+// Paginate drops the extra row fetched by Build, restores the order of a backward page and builds the cursors.
+// items is a pointer to the slice of fetched rows, key returns the value of the column for the i-th row.
+func (q *Query) Paginate(items interface{}, key func(i int, column string) interface{}) *Page {
+	slice := reflect.ValueOf(items).Elem()
+
+	more := slice.Len() > q.Limit
+	if more {
+		slice.Set(slice.Slice(0, q.Limit))
+	}
+
+	if q.backward() {
+		swap := reflect.Swapper(slice.Interface())
+		for i, j := 0, slice.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+
+	page := &Page{}
+	n := slice.Len()
+	if n == 0 {
+		return page
+	}
+
+	hasNext, hasPrev := more, q.cursor != nil
+	if q.backward() {
+		hasNext, hasPrev = true, more
+	}
+
+	if hasNext {
+		page.NextCursor = q.encodeCursor(n-1, key, false)
+	}
+	if hasPrev {
+		page.PrevCursor = q.encodeCursor(0, key, true)
+	}
+
+	return page
+}
+
+func (q *Query) backward() bool {
+	return q.cursor != nil && q.cursor.backward
+}
+
+func (q *Query) sortSignature() string {
+	fields := make([]string, 0, len(q.Sort))
+	for _, s := range q.Sort {
+		if s.Desc {
+			fields = append(fields, "-"+s.Column.Name)
+		} else {
+			fields = append(fields, s.Column.Name)
+		}
+	}
+
+	return strings.Join(fields, ",")
+}
+
+func (q *Query) encodeCursor(i int, key func(i int, column string) interface{}, backward bool) string {
+	p := cursorPayload{
+		Sort:     q.sortSignature(),
+		Backward: backward,
+	}
+	for _, s := range q.Sort {
+		p.Values = append(p.Values, formatValue(key(i, s.Column.Name)))
+	}
+
+	// marshalling can't fail for strings
+	b, _ := json.Marshal(p)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(raw string, q *Query) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+
+	p := &cursorPayload{}
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+
+	// a cursor only makes sense for the sort it was issued for
+	if p.Sort != q.sortSignature() || len(p.Values) != len(q.Sort) {
+		return nil, fmt.Errorf("%w: the cursor doesn't match the sort", ErrInvalidQuery)
+	}
+
+	c := &cursor{backward: p.Backward}
+	for i, s := range q.Sort {
+		v, err := parseValue(s.Column.Type, p.Values[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+		}
+		c.values = append(c.values, v)
+	}
+
+	return c, nil
+}
@@ -0,0 +1,225 @@
+package query
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Select evaluates the query on rows held in memory the way the statement of Build does:
+// it keeps the matching rows after the cursor in the page order, at most one more than the limit,
+// so the result can be handed to Paginate. items is a pointer to the slice of rows,
+// value returns the value of the column for the i-th row, nil standing for NULL.
+func (q *Query) Select(items interface{}, value func(i int, column string) interface{}) {
+	slice := reflect.ValueOf(items).Elem()
+
+	// value reads the slice by index, so the rows are picked and ordered by index before they are moved
+	indexes := make([]int, 0, slice.Len())
+	for i := 0; i < slice.Len(); i++ {
+		if q.match(i, value) {
+			indexes = append(indexes, i)
+		}
+	}
+
+	sort.SliceStable(indexes, func(a, b int) bool {
+		return q.compareRows(indexes[a], indexes[b], value) < 0
+	})
+
+	if len(indexes) > q.Limit+1 {
+		indexes = indexes[:q.Limit+1]
+	}
+
+	selected := reflect.MakeSlice(slice.Type(), 0, len(indexes))
+	for _, i := range indexes {
+		selected = reflect.Append(selected, slice.Index(i))
+	}
+	slice.Set(selected)
+}
+
+func (q *Query) match(i int, value func(i int, column string) interface{}) bool {
+	for _, f := range q.Filters {
+		if !f.match(value(i, f.Column.Name)) {
+			return false
+		}
+	}
+
+	if q.cursor == nil {
+		return true
+	}
+
+	// the row must come after the cursor in the page order
+	for k, s := range q.Sort {
+		c := compareValues(value(i, s.Column.Name), q.cursor.values[k])
+		if s.Desc != q.cursor.backward {
+			c = -c
+		}
+		if c != 0 {
+			return c > 0
+		}
+	}
+
+	return false
+}
+
+// compareRows orders the rows like ORDER BY of Build, a backward page is fetched in the reverse order
+func (q *Query) compareRows(a int, b int, value func(i int, column string) interface{}) int {
+	for _, s := range q.Sort {
+		c := compareValues(value(a, s.Column.Name), value(b, s.Column.Name))
+		if s.Desc != q.backward() {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+
+	return 0
+}
+
+func (f *Filter) match(v interface{}) bool {
+	v = normalize(v)
+	if f.Operator == OpNull {
+		return (v == nil) == f.Values[0].(bool)
+	}
+	// like in SQL, no comparison holds for NULL
+	if v == nil {
+		return false
+	}
+
+	switch f.Operator {
+	case OpIn:
+		for _, fv := range f.Values {
+			if compareValues(v, fv) == 0 {
+				return true
+			}
+		}
+		return false
+	case OpLike, OpILike:
+		s, _ := v.(string)
+		pattern, _ := f.Values[0].(string)
+		return likeRegexp(pattern, f.Operator == OpILike).MatchString(s)
+	}
+
+	c := compareValues(v, f.Values[0])
+	switch f.Operator {
+	case OpNe:
+		return c != 0
+	case OpLt:
+		return c < 0
+	case OpLte:
+		return c <= 0
+	case OpGt:
+		return c > 0
+	case OpGte:
+		return c >= 0
+	default:
+		return c == 0
+	}
+}
+
+// likeRegexp translates the LIKE pattern, % matches any sequence and _ any single character
+func likeRegexp(pattern string, insensitive bool) *regexp.Regexp {
+	var b strings.Builder
+	if insensitive {
+		b.WriteString("(?i)")
+	}
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+
+	return regexp.MustCompile("(?s)" + b.String())
+}
+
+// compareValues compares values of the same column type, integers of any kind compare with each other.
+// NULL sorts after any value as it does in Postgres.
+func compareValues(a interface{}, b interface{}) int {
+	a, b = normalize(a), normalize(b)
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return 1
+		default:
+			return -1
+		}
+	}
+
+	switch av := a.(type) {
+	case int64:
+		switch bv := b.(type) {
+		case int64:
+			return compareOrdered(av < bv, av > bv)
+		case float64:
+			return compareOrdered(float64(av) < bv, float64(av) > bv)
+		}
+	case float64:
+		switch bv := b.(type) {
+		case int64:
+			return compareOrdered(av < float64(bv), av > float64(bv))
+		case float64:
+			return compareOrdered(av < bv, av > bv)
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv)
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			return compareOrdered(!av && bv, av && !bv)
+		}
+	case time.Time:
+		if bv, ok := b.(time.Time); ok {
+			return compareOrdered(av.Before(bv), av.After(bv))
+		}
+	}
+
+	return 0
+}
+
+func compareOrdered(less bool, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// normalize converts the numbers to int64 or float64 and dereferences times, a nil time becomes NULL
+func normalize(v interface{}) interface{} {
+	switch val := v.(type) {
+	case *time.Time:
+		if val == nil {
+			return nil
+		}
+		return *val
+	case time.Time, string, bool:
+		return v
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	default:
+		return v
+	}
+}
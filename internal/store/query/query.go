@@ -0,0 +1,308 @@
+// Package query turns list request parameters into safe, parameterised SQL with keyset pagination.
+//
+//	?filter[email][like]=%@example.org&filter[id][gt]=10&sort=-id&limit=50&cursor=...
+//
+// Only the columns whitelisted by the Schema can be filtered and sorted on, and pages are
+// navigated with opaque cursors, so a listing never runs COUNT(*).
+package query
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 100
+)
+
+// ErrInvalidQuery is wrapped by every error caused by bad request parameters
+var ErrInvalidQuery = errors.New("invalid query")
+
+var filterParam = regexp.MustCompile(`^filter\[([a-zA-Z0-9_]+)\](?:\[([a-z]+)\])?$`)
+
+type Type int
+
+const (
+	TypeText Type = iota
+	TypeInt
+	TypeFloat
+	TypeBool
+	TypeTime
+)
+
+var typeNames = map[Type]string{
+	TypeText:  "text",
+	TypeInt:   "int",
+	TypeFloat: "float",
+	TypeBool:  "bool",
+	TypeTime:  "time",
+}
+
+func (t Type) String() string {
+	return typeNames[t]
+}
+
+// MarshalText makes the type readable in JSON
+func (t Type) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+type Operator string
+
+const (
+	OpEq    Operator = "eq"
+	OpNe    Operator = "ne"
+	OpLt    Operator = "lt"
+	OpLte   Operator = "lte"
+	OpGt    Operator = "gt"
+	OpGte   Operator = "gte"
+	OpLike  Operator = "like"
+	OpILike Operator = "ilike"
+	OpIn    Operator = "in"
+	OpNull  Operator = "null"
+)
+
+var operators = map[Type][]Operator{
+	TypeText:  {OpEq, OpNe, OpLike, OpILike, OpIn},
+	TypeInt:   {OpEq, OpNe, OpLt, OpLte, OpGt, OpGte, OpIn},
+	TypeFloat: {OpEq, OpNe, OpLt, OpLte, OpGt, OpGte},
+	TypeBool:  {OpEq, OpNe},
+	TypeTime:  {OpEq, OpNe, OpLt, OpLte, OpGt, OpGte},
+}
+
+// Column is a whitelisted column
+type Column struct {
+	Name       string
+	Type       Type
+	Nullable   bool
+	Filterable bool
+	// Sortable columns take part in the keyset, they must not be nullable
+	Sortable bool
+}
+
+// Schema describes what a listing can be filtered and sorted by
+type Schema struct {
+	Table string
+	// PrimaryKey is appended to every sort, so the keyset is unique
+	PrimaryKey string
+	Columns    []*Column
+}
+
+func (s *Schema) Column(name string) (*Column, bool) {
+	for _, c := range s.Columns {
+		if c.Name == name {
+			return c, true
+		}
+	}
+
+	return nil, false
+}
+
+// Parse parses the raw value of the column, e.g. a path parameter
+func (c *Column) Parse(raw string) (interface{}, error) {
+	return parseValue(c.Type, raw)
+}
+
+type Filter struct {
+	Column   *Column
+	Operator Operator
+	Values   []interface{}
+}
+
+type Sort struct {
+	Column *Column
+	Desc   bool
+}
+
+// Query is a parsed listing request
+type Query struct {
+	schema  *Schema
+	Filters []*Filter
+	Sort    []*Sort
+	Limit   int
+	cursor  *cursor
+}
+
+// Parse parses filter, sort, limit and cursor parameters against the schema
+func Parse(values url.Values, schema *Schema) (*Query, error) {
+	q := &Query{
+		schema: schema,
+		Limit:  DefaultLimit,
+	}
+
+	params := make([]string, 0, len(values))
+	for param := range values {
+		params = append(params, param)
+	}
+	// keep the generated SQL stable
+	sort.Strings(params)
+
+	for _, param := range params {
+		m := filterParam.FindStringSubmatch(param)
+		if m == nil {
+			continue
+		}
+
+		f, err := parseFilter(schema, m[1], Operator(m[2]), values.Get(param))
+		if err != nil {
+			return nil, err
+		}
+		q.Filters = append(q.Filters, f)
+	}
+
+	if err := q.parseSort(values.Get("sort")); err != nil {
+		return nil, err
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 || l > MaxLimit {
+			return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, MaxLimit)
+		}
+		q.Limit = l
+	}
+
+	if c := values.Get("cursor"); c != "" {
+		cur, err := decodeCursor(c, q)
+		if err != nil {
+			return nil, err
+		}
+		q.cursor = cur
+	}
+
+	return q, nil
+}
+
+// Where adds a condition the caller doesn't control, e.g. scoping the listing to an owner
+func (q *Query) Where(column *Column, op Operator, value interface{}) *Query {
+	q.Filters = append(q.Filters, &Filter{Column: column, Operator: op, Values: []interface{}{value}})
+	return q
+}
+
+func parseFilter(schema *Schema, name string, op Operator, raw string) (*Filter, error) {
+	c, ok := schema.Column(name)
+	if !ok || !c.Filterable {
+		return nil, fmt.Errorf("%w: can't filter by %q", ErrInvalidQuery, name)
+	}
+
+	if op == "" {
+		op = OpEq
+	}
+
+	if op == OpNull {
+		if !c.Nullable {
+			return nil, fmt.Errorf("%w: %q is never null", ErrInvalidQuery, name)
+		}
+
+		isNull, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: filter[%s][null] must be true or false", ErrInvalidQuery, name)
+		}
+
+		return &Filter{Column: c, Operator: op, Values: []interface{}{isNull}}, nil
+	}
+
+	if !supports(c.Type, op) {
+		return nil, fmt.Errorf("%w: operator %q is not supported for %q", ErrInvalidQuery, op, name)
+	}
+
+	raws := []string{raw}
+	if op == OpIn {
+		raws = strings.Split(raw, ",")
+	}
+
+	f := &Filter{Column: c, Operator: op}
+	for _, r := range raws {
+		v, err := parseValue(c.Type, r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: filter[%s]: %v", ErrInvalidQuery, name, err)
+		}
+		f.Values = append(f.Values, v)
+	}
+
+	return f, nil
+}
+
+func (q *Query) parseSort(raw string) error {
+	seen := map[string]bool{}
+
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		desc := strings.HasPrefix(field, "-")
+		name := strings.TrimPrefix(field, "-")
+
+		c, ok := q.schema.Column(name)
+		if !ok || !c.Sortable {
+			return fmt.Errorf("%w: can't sort by %q", ErrInvalidQuery, name)
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		q.Sort = append(q.Sort, &Sort{Column: c, Desc: desc})
+	}
+
+	// the primary key makes the keyset unique
+	if !seen[q.schema.PrimaryKey] {
+		pk, ok := q.schema.Column(q.schema.PrimaryKey)
+		if !ok {
+			return fmt.Errorf("primary key %q is not a column of %s", q.schema.PrimaryKey, q.schema.Table)
+		}
+
+		desc := false
+		if len(q.Sort) > 0 {
+			desc = q.Sort[len(q.Sort)-1].Desc
+		}
+		q.Sort = append(q.Sort, &Sort{Column: pk, Desc: desc})
+	}
+
+	return nil
+}
+
+func supports(t Type, op Operator) bool {
+	for _, o := range operators[t] {
+		if o == op {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseValue(t Type, raw string) (interface{}, error) {
+	switch t {
+	case TypeInt:
+		return strconv.ParseInt(raw, 10, 64)
+	case TypeFloat:
+		return strconv.ParseFloat(raw, 64)
+	case TypeBool:
+		return strconv.ParseBool(raw)
+	case TypeTime:
+		return time.Parse(time.RFC3339Nano, raw)
+	default:
+		return raw, nil
+	}
+}
+
+func formatValue(v interface{}) string {
+	switch val := v.(type) {
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	case []byte:
+		return string(val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
@@ -0,0 +1,162 @@
+package query
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+var testSchema = &Schema{
+	Table:      "users",
+	PrimaryKey: "id",
+	Columns: []*Column{
+		{Name: "id", Type: TypeInt, Filterable: true, Sortable: true},
+		{Name: "name", Type: TypeText, Filterable: true, Sortable: true},
+		{Name: "email", Type: TypeText, Filterable: true},
+		{Name: "encrypted_password", Type: TypeText},
+	},
+}
+
+type row struct {
+	id   int64
+	name string
+}
+
+func parse(t *testing.T, raw string) *Query {
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := Parse(values, testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return q
+}
+
+func TestParse_Build(t *testing.T) {
+	q := parse(t, "filter[email][like]=%25@example.org&filter[id][in]=1,2&sort=-name&limit=10")
+
+	sql, args := q.Build([]string{"id", "name"})
+
+	assert.Equal(
+		t,
+		`SELECT "id", "name" FROM "users" WHERE "email" LIKE $1 AND "id" IN ($2, $3) ORDER BY "name" DESC, "id" DESC LIMIT $4`,
+		sql,
+	)
+	assert.Equal(t, []interface{}{"%@example.org", int64(1), int64(2), 11}, args)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	testCases := []string{
+		"filter[encrypted_password]=x",
+		"filter[unknown]=x",
+		"filter[name][gt]=x",
+		"filter[id]=abc",
+		"filter[id][null]=true",
+		"sort=email",
+		"limit=1000",
+		"cursor=garbage",
+	}
+
+	for _, tc := range testCases {
+		values, _ := url.ParseQuery(tc)
+		_, err := Parse(values, testSchema)
+		assert.True(t, errors.Is(err, ErrInvalidQuery), tc)
+	}
+}
+
+func TestQuery_Paginate(t *testing.T) {
+	key := func(rows *[]row) func(i int, column string) interface{} {
+		return func(i int, column string) interface{} {
+			if column == "id" {
+				return (*rows)[i].id
+			}
+			return (*rows)[i].name
+		}
+	}
+
+	// first page, one row more than the limit was fetched
+	first := parse(t, "sort=name&limit=2")
+	rows := []row{{1, "a"}, {2, "b"}, {3, "c"}}
+	page := first.Paginate(&rows, key(&rows))
+
+	assert.Equal(t, []row{{1, "a"}, {2, "b"}}, rows)
+	assert.Empty(t, page.PrevCursor)
+	assert.NotEmpty(t, page.NextCursor)
+
+	// the next page continues after the last row
+	next := parse(t, "sort=name&limit=2&cursor="+page.NextCursor)
+	sql, args := next.Build([]string{"id", "name"})
+	assert.Contains(t, sql, `(("name" > $1) OR ("name" = $1 AND "id" > $2))`)
+	assert.Equal(t, []interface{}{"b", int64(2), 3}, args)
+
+	rows = []row{{3, "c"}}
+	page = next.Paginate(&rows, key(&rows))
+	assert.Empty(t, page.NextCursor)
+	assert.NotEmpty(t, page.PrevCursor)
+
+	// the previous page is fetched in the reverse order and restored
+	prev := parse(t, "sort=name&limit=2&cursor="+page.PrevCursor)
+	sql, _ = prev.Build([]string{"id", "name"})
+	assert.Contains(t, sql, `ORDER BY "name" DESC, "id" DESC`)
+	assert.Contains(t, sql, `(("name" < $1) OR ("name" = $1 AND "id" < $2))`)
+
+	rows = []row{{2, "b"}, {1, "a"}}
+	page = prev.Paginate(&rows, key(&rows))
+	assert.Equal(t, []row{{1, "a"}, {2, "b"}}, rows)
+	assert.Empty(t, page.PrevCursor)
+	assert.NotEmpty(t, page.NextCursor)
+
+	// a cursor is bound to its sort
+	values, _ := url.ParseQuery("sort=-name&cursor=" + page.NextCursor)
+	_, err := Parse(values, testSchema)
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+}
+
+func TestQuery_Select(t *testing.T) {
+	all := []row{{1, "b"}, {2, "a"}, {3, "c"}, {4, "b"}, {5, "d"}}
+	value := func(rows *[]row) func(i int, column string) interface{} {
+		return func(i int, column string) interface{} {
+			if column == "id" {
+				return (*rows)[i].id
+			}
+			return (*rows)[i].name
+		}
+	}
+
+	first := parse(t, "filter[id][ne]=5&sort=name&limit=2")
+	rows := append([]row(nil), all...)
+	first.Select(&rows, value(&rows))
+	assert.Equal(t, []row{{2, "a"}, {1, "b"}, {4, "b"}}, rows)
+
+	page := first.Paginate(&rows, value(&rows))
+	assert.Equal(t, []row{{2, "a"}, {1, "b"}}, rows)
+
+	// the keyset continues after the duplicated name
+	next := parse(t, "filter[id][ne]=5&sort=name&limit=2&cursor="+page.NextCursor)
+	rows = append([]row(nil), all...)
+	next.Select(&rows, value(&rows))
+	page = next.Paginate(&rows, value(&rows))
+	assert.Equal(t, []row{{4, "b"}, {3, "c"}}, rows)
+	assert.Empty(t, page.NextCursor)
+
+	prev := parse(t, "filter[id][ne]=5&sort=name&limit=2&cursor="+page.PrevCursor)
+	rows = append([]row(nil), all...)
+	prev.Select(&rows, value(&rows))
+	prev.Paginate(&rows, value(&rows))
+	assert.Equal(t, []row{{2, "a"}, {1, "b"}}, rows)
+
+	like := parse(t, "filter[name][in]=a,d&filter[email][like]=%25")
+	rows = append([]row(nil), all...)
+	like.Select(&rows, func(i int, column string) interface{} {
+		if column == "email" {
+			return "x@example.org"
+		}
+		return value(&rows)(i, column)
+	})
+	assert.Equal(t, []row{{2, "a"}, {5, "d"}}, rows)
+}
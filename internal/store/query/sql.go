@@ -0,0 +1,115 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+var comparisons = map[Operator]string{
+	OpEq:    "=",
+	OpNe:    "<>",
+	OpLt:    "<",
+	OpLte:   "<=",
+	OpGt:    ">",
+	OpGte:   ">=",
+	OpLike:  "LIKE",
+	OpILike: "ILIKE",
+}
+
+// Build returns the SELECT statement of the page and its arguments.
+// One row more than the limit is fetched to find out whether there is a next page.
+func (q *Query) Build(columns []string) (string, []interface{}) {
+	b := &builder{}
+
+	quoted := make([]string, 0, len(columns))
+	for _, c := range columns {
+		quoted = append(quoted, QuoteIdent(c))
+	}
+
+	conditions := make([]string, 0, len(q.Filters)+1)
+	for _, f := range q.Filters {
+		conditions = append(conditions, b.filter(f))
+	}
+	if q.cursor != nil {
+		conditions = append(conditions, b.keyset(q.Sort, q.cursor))
+	}
+
+	order := make([]string, 0, len(q.Sort))
+	for _, s := range q.Sort {
+		dir := "ASC"
+		if s.Desc != q.backward() {
+			dir = "DESC"
+		}
+		order = append(order, QuoteIdent(s.Column.Name)+" "+dir)
+	}
+
+	sql := "SELECT " + strings.Join(quoted, ", ") + " FROM " + QuoteIdent(q.schema.Table)
+	if len(conditions) > 0 {
+		sql += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	sql += " ORDER BY " + strings.Join(order, ", ")
+	sql += " LIMIT " + b.arg(q.Limit+1)
+
+	return sql, b.args
+}
+
+type builder struct {
+	args []interface{}
+}
+
+func (b *builder) arg(v interface{}) string {
+	b.args = append(b.args, v)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+func (b *builder) filter(f *Filter) string {
+	col := QuoteIdent(f.Column.Name)
+
+	switch f.Operator {
+	case OpNull:
+		if f.Values[0].(bool) {
+			return col + " IS NULL"
+		}
+		return col + " IS NOT NULL"
+	case OpIn:
+		placeholders := make([]string, 0, len(f.Values))
+		for _, v := range f.Values {
+			placeholders = append(placeholders, b.arg(v))
+		}
+		return col + " IN (" + strings.Join(placeholders, ", ") + ")"
+	default:
+		return col + " " + comparisons[f.Operator] + " " + b.arg(f.Values[0])
+	}
+}
+
+// keyset builds the condition selecting the rows after the cursor in the sort order:
+// (a > $1) OR (a = $1 AND b > $2) OR ..., the comparison flips for descending keys and backward pages
+func (b *builder) keyset(sort []*Sort, c *cursor) string {
+	placeholders := make([]string, 0, len(sort))
+	for i := range sort {
+		placeholders = append(placeholders, b.arg(c.values[i]))
+	}
+
+	alternatives := make([]string, 0, len(sort))
+	for i, s := range sort {
+		parts := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			parts = append(parts, QuoteIdent(sort[j].Column.Name)+" = "+placeholders[j])
+		}
+
+		op := ">"
+		if s.Desc != c.backward {
+			op = "<"
+		}
+		parts = append(parts, QuoteIdent(s.Column.Name)+" "+op+" "+placeholders[i])
+
+		alternatives = append(alternatives, "("+strings.Join(parts, " AND ")+")")
+	}
+
+	return "(" + strings.Join(alternatives, " OR ") + ")"
+}
+
+// QuoteIdent quotes a table or column name
+func QuoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
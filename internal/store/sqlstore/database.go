@@ -1,19 +1,34 @@
 package sqlstore
 
 import (
+	"database/sql/driver"
 	"fmt"
-	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/XSAM/otelsql"
+	"github.com/jackc/pgx/v4/stdlib"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
 	"godmin/config"
 )
 
+// NewDB connects to the database, the statements are traced
 func NewDB(config *config.Database) (*sqlx.DB, error) {
-	db, err := sqlx.Connect("pgx", dbUrl(config))
+	connector, err := stdlib.GetDefaultDriver().(driver.DriverContext).OpenConnector(dbUrl(config))
 	if err != nil {
 		return nil, errors.Wrap(err, "Unable to connect to database: %v")
 	}
 
+	// the driver name keeps the bind vars of pgx
+	db := sqlx.NewDb(otelsql.OpenDB(
+		connector,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{DisableErrSkip: true}),
+	), "pgx")
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "Unable to connect to database: %v")
+	}
+
 	db.SetMaxOpenConns(config.MaxOpenConns)
 	db.SetMaxIdleConns(config.MaxIdleConns)
 	db.SetConnMaxLifetime(config.ConnMaxLifeTime)
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"godmin/internal/model"
+	"godmin/internal/store"
+	"strings"
+)
+
+const apiKeyColumns = "id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, created_at, revoked_at"
+
+type ApiKey struct {
+	db *sqlx.DB
+}
+
+func (ar *ApiKey) Create(ctx context.Context, k *model.ApiKey) error {
+	if err := k.BeforeCreate(); err != nil {
+		return err
+	}
+
+	return ar.db.QueryRowContext(
+		ctx,
+		`INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`,
+		k.UserID,
+		k.Name,
+		k.Prefix,
+		k.KeyHash,
+		strings.Join(k.Scopes, " "),
+		k.ExpiresAt,
+	).Scan(&k.ID, &k.CreatedAt)
+}
+
+// FindByUser returns the user's keys which are not revoked, expired keys included
+func (ar *ApiKey) FindByUser(ctx context.Context, userID uint64) ([]*model.ApiKey, error) {
+	rows, err := ar.db.QueryContext(
+		ctx,
+		"SELECT "+apiKeyColumns+" FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL ORDER BY id",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]*model.ApiKey, 0)
+	for rows.Next() {
+		k, err := scanApiKey(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
+
+// Use finds an active key by its hash and records the usage
+func (ar *ApiKey) Use(ctx context.Context, keyHash string) (*model.ApiKey, error) {
+	k, err := scanApiKey(ar.db.QueryRowContext(
+		ctx,
+		`UPDATE api_keys SET last_used_at = now()
+		WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now())
+		RETURNING `+apiKeyColumns,
+		keyHash,
+	))
+	if err == sql.ErrNoRows {
+		return nil, store.ErrRecordNotFound
+	}
+
+	return k, err
+}
+
+// Revoke revokes the user's key
+func (ar *ApiKey) Revoke(ctx context.Context, userID uint64, id uint64) error {
+	res, err := ar.db.ExecContext(
+		ctx,
+		"UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL",
+		id,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return store.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// RevokeByUser revokes every active key of the user and returns how many were revoked
+func (ar *ApiKey) RevokeByUser(ctx context.Context, userID uint64) (int64, error) {
+	res, err := ar.db.ExecContext(ctx, "UPDATE api_keys SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL", userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func NewApiKey(db *sqlx.DB) *ApiKey {
+	return &ApiKey{
+		db: db,
+	}
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanApiKey(row scanner) (*model.ApiKey, error) {
+	k := &model.ApiKey{}
+	var scopes string
+
+	if err := row.Scan(
+		&k.ID,
+		&k.UserID,
+		&k.Name,
+		&k.Prefix,
+		&k.KeyHash,
+		&scopes,
+		&k.ExpiresAt,
+		&k.LastUsedAt,
+		&k.CreatedAt,
+		&k.RevokedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	k.Scopes = strings.Fields(scopes)
+
+	return k, nil
+}
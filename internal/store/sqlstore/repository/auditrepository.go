@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jmoiron/sqlx"
+	"godmin/internal/model"
+	"godmin/internal/store/query"
+	"strings"
+)
+
+type Audit struct {
+	db *sqlx.DB
+}
+
+const auditColumns = "id, actor_id, action, target_type, target_id, changes, ip, user_agent, request_id, created_at"
+
+func (ar *Audit) Create(ctx context.Context, e *model.AuditEvent) error {
+	changes, err := json.Marshal(e.Changes)
+	if err != nil {
+		return err
+	}
+	if e.Changes == nil {
+		changes = []byte("{}")
+	}
+
+	return ar.db.QueryRowContext(
+		ctx,
+		`INSERT INTO audit_events (actor_id, action, target_type, target_id, changes, ip, user_agent, request_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at`,
+		e.ActorID,
+		e.Action,
+		e.TargetType,
+		e.TargetID,
+		changes,
+		e.IP,
+		e.UserAgent,
+		e.RequestID,
+	).Scan(&e.ID, &e.CreatedAt)
+}
+
+// List returns a page of events matching the query
+func (ar *Audit) List(ctx context.Context, q *query.Query) ([]*model.AuditEvent, *query.Page, error) {
+	sql, args := q.Build(strings.Split(auditColumns, ", "))
+
+	rows, err := ar.db.QueryContext(ctx, sql, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	events := make([]*model.AuditEvent, 0, q.Limit+1)
+	for rows.Next() {
+		e := &model.AuditEvent{}
+		var changes []byte
+		if err := rows.Scan(
+			&e.ID,
+			&e.ActorID,
+			&e.Action,
+			&e.TargetType,
+			&e.TargetID,
+			&changes,
+			&e.IP,
+			&e.UserAgent,
+			&e.RequestID,
+			&e.CreatedAt,
+		); err != nil {
+			return nil, nil, err
+		}
+		if err := json.Unmarshal(changes, &e.Changes); err != nil {
+			return nil, nil, err
+		}
+
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	page := q.Paginate(&events, func(i int, column string) interface{} {
+		switch column {
+		case "created_at":
+			return events[i].CreatedAt
+		default:
+			return events[i].ID
+		}
+	})
+
+	return events, page, nil
+}
+
+func NewAudit(db *sqlx.DB) *Audit {
+	return &Audit{
+		db: db,
+	}
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jmoiron/sqlx"
+	"godmin/internal/model"
+)
+
+// Catalog reads the table definitions from information_schema and pg_catalog
+type Catalog struct {
+	db *sqlx.DB
+}
+
+// Tables returns the base tables of the schema with their columns, primary keys and foreign keys
+func (cr *Catalog) Tables(ctx context.Context, schema string) ([]*model.Table, error) {
+	rows, err := cr.db.QueryContext(
+		ctx,
+		`SELECT c.table_name,
+			c.column_name,
+			c.udt_name,
+			c.is_nullable = 'YES',
+			c.column_default IS NOT NULL,
+			c.is_identity = 'YES' OR c.is_generated = 'ALWAYS' OR COALESCE(c.column_default LIKE 'nextval(%', FALSE),
+			c.character_maximum_length,
+			(
+				SELECT COALESCE(json_agg(e.enumlabel ORDER BY e.enumsortorder), '[]')::TEXT
+				FROM pg_enum e
+				JOIN pg_type t ON t.oid = e.enumtypid
+				JOIN pg_namespace n ON n.oid = t.typnamespace
+				WHERE t.typname = c.udt_name AND n.nspname = c.udt_schema
+			)
+		FROM information_schema.columns c
+		JOIN information_schema.tables t ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+		WHERE c.table_schema = $1 AND t.table_type = 'BASE TABLE'
+		ORDER BY c.table_name, c.ordinal_position`,
+		schema,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tables := make([]*model.Table, 0)
+	byName := map[string]*model.Table{}
+	for rows.Next() {
+		var tableName, enum string
+		c := &model.TableColumn{}
+
+		if err := rows.Scan(
+			&tableName,
+			&c.Name,
+			&c.Type,
+			&c.Nullable,
+			&c.HasDefault,
+			&c.Generated,
+			&c.MaxLength,
+			&enum,
+		); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(enum), &c.Enum); err != nil {
+			return nil, err
+		}
+
+		t, ok := byName[tableName]
+		if !ok {
+			t = &model.Table{Name: tableName}
+			byName[tableName] = t
+			tables = append(tables, t)
+		}
+		t.Columns = append(t.Columns, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := cr.constraints(ctx, schema, byName); err != nil {
+		return nil, err
+	}
+
+	return tables, nil
+}
+
+// constraints fills the primary keys and the single column foreign keys
+func (cr *Catalog) constraints(ctx context.Context, schema string, tables map[string]*model.Table) error {
+	rows, err := cr.db.QueryContext(
+		ctx,
+		`SELECT cl.relname,
+			a.attname,
+			con.contype,
+			array_length(con.conkey, 1),
+			COALESCE(fcl.relname, ''),
+			COALESCE(fa.attname, '')
+		FROM pg_constraint con
+		JOIN pg_class cl ON cl.oid = con.conrelid
+		JOIN pg_namespace n ON n.oid = cl.relnamespace
+		CROSS JOIN LATERAL unnest(con.conkey, con.confkey) WITH ORDINALITY AS k(attnum, fattnum, position)
+		JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+		LEFT JOIN pg_class fcl ON fcl.oid = con.confrelid
+		LEFT JOIN pg_attribute fa ON fa.attrelid = con.confrelid AND fa.attnum = k.fattnum
+		WHERE n.nspname = $1 AND con.contype IN ('p', 'f')
+		ORDER BY cl.relname, con.conname, k.position`,
+		schema,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tableName, columnName, kind, foreignTable, foreignColumn string
+		var size int
+
+		if err := rows.Scan(&tableName, &columnName, &kind, &size, &foreignTable, &foreignColumn); err != nil {
+			return err
+		}
+
+		t, ok := tables[tableName]
+		if !ok {
+			continue
+		}
+
+		switch kind {
+		case "p":
+			t.PrimaryKey = append(t.PrimaryKey, columnName)
+		case "f":
+			if c, ok := t.Column(columnName); ok && size == 1 {
+				c.References = foreignTable + "." + foreignColumn
+			}
+		}
+	}
+
+	return rows.Err()
+}
+
+func NewCatalog(db *sqlx.DB) *Catalog {
+	return &Catalog{
+		db: db,
+	}
+}
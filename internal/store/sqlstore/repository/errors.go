@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"godmin/internal/store"
+	"strings"
+
+	"github.com/jackc/pgconn"
+)
+
+const (
+	uniqueViolation = "23505"
+	// integrity constraint violations: not null, foreign key, unique, check and exclusion
+	integrityConstraintViolationClass = "23"
+)
+
+// isUniqueViolation reports whether err violates the unique constraint
+func isUniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == uniqueViolation && pgErr.ConstraintName == constraint
+	}
+
+	return false
+}
+
+// constraintError wraps the integrity constraint violations with store.ErrConstraintViolation
+func constraintError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && strings.HasPrefix(pgErr.Code, integrityConstraintViolationClass) {
+		return fmt.Errorf("%w: %s", store.ErrConstraintViolation, pgErr.Message)
+	}
+
+	return err
+}
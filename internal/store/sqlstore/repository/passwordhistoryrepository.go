@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+)
+
+type PasswordHistory struct {
+	db *sqlx.DB
+}
+
+// Add records a former password hash of the user and keeps only the keep latest ones
+func (pr *PasswordHistory) Add(ctx context.Context, userID uint64, encryptedPassword string, keep int) error {
+	tx, err := pr.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO password_history (user_id, encrypted_password) VALUES ($1, $2)",
+		userID,
+		encryptedPassword,
+	); err != nil {
+		return err
+	}
+
+	if err := trimPasswordHistory(ctx, tx, userID, keep); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// FindByUser returns the latest former password hashes of the user, the latest first
+func (pr *PasswordHistory) FindByUser(ctx context.Context, userID uint64, limit int) ([]string, error) {
+	hashes := make([]string, 0, limit)
+	err := pr.db.SelectContext(
+		ctx,
+		&hashes,
+		"SELECT encrypted_password FROM password_history WHERE user_id = $1 ORDER BY id DESC LIMIT $2",
+		userID,
+		limit,
+	)
+
+	return hashes, err
+}
+
+// trimPasswordHistory keeps only the keep latest former passwords of the user
+func trimPasswordHistory(ctx context.Context, tx *sqlx.Tx, userID uint64, keep int) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`DELETE FROM password_history WHERE user_id = $1 AND id NOT IN (
+			SELECT id FROM password_history WHERE user_id = $1 ORDER BY id DESC LIMIT $2
+		)`,
+		userID,
+		keep,
+	)
+
+	return err
+}
+
+func NewPasswordHistory(db *sqlx.DB) *PasswordHistory {
+	return &PasswordHistory{
+		db: db,
+	}
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+)
+
+type RecoveryCode struct {
+	db *sqlx.DB
+}
+
+// Replace drops the user's recovery codes and stores the new ones
+func (rr *RecoveryCode) Replace(ctx context.Context, userID uint64, hashes []string) error {
+	tx, err := rr.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+
+	for _, hash := range hashes {
+		if _, err := tx.ExecContext(
+			ctx,
+			"INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)",
+			userID,
+			hash,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Use marks the code as used, it returns false if there is no such unused code
+func (rr *RecoveryCode) Use(ctx context.Context, userID uint64, hash string) (bool, error) {
+	res, err := rr.db.ExecContext(
+		ctx,
+		"UPDATE user_recovery_codes SET used_at = now() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL",
+		userID,
+		hash,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+func (rr *RecoveryCode) DeleteByUser(ctx context.Context, userID uint64) error {
+	_, err := rr.db.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1", userID)
+	return err
+}
+
+func NewRecoveryCode(db *sqlx.DB) *RecoveryCode {
+	return &RecoveryCode{
+		db: db,
+	}
+}
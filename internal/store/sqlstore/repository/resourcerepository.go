@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"godmin/internal/store"
+	"godmin/internal/store/query"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Resource is a generic repository of a table, rows are maps of the column values
+type Resource struct {
+	db      *sqlx.DB
+	schema  *query.Schema
+	columns []string
+}
+
+// List returns a page of rows matching the query
+func (rr *Resource) List(ctx context.Context, q *query.Query) ([]map[string]interface{}, *query.Page, error) {
+	sql, args := q.Build(rr.columns)
+
+	rows, err := rr.db.QueryxContext(ctx, sql, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	items := make([]map[string]interface{}, 0, q.Limit+1)
+	for rows.Next() {
+		item, err := scanRow(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	page := q.Paginate(&items, func(i int, column string) interface{} {
+		return items[i][column]
+	})
+
+	return items, page, nil
+}
+
+func (rr *Resource) Find(ctx context.Context, id interface{}) (map[string]interface{}, error) {
+	return rr.one(
+		ctx,
+		"SELECT "+rr.selectList()+" FROM "+query.QuoteIdent(rr.schema.Table)+" WHERE "+rr.pkCondition(),
+		id,
+	)
+}
+
+// Create inserts the values and returns the created row
+func (rr *Resource) Create(ctx context.Context, values map[string]interface{}) (map[string]interface{}, error) {
+	names, args := sortedValues(values)
+
+	sql := "INSERT INTO " + query.QuoteIdent(rr.schema.Table)
+	if len(names) == 0 {
+		sql += " DEFAULT VALUES"
+	} else {
+		columns := make([]string, 0, len(names))
+		placeholders := make([]string, 0, len(names))
+		for i, name := range names {
+			columns = append(columns, query.QuoteIdent(name))
+			placeholders = append(placeholders, "$"+strconv.Itoa(i+1))
+		}
+		sql += " (" + strings.Join(columns, ", ") + ") VALUES (" + strings.Join(placeholders, ", ") + ")"
+	}
+
+	return rr.one(ctx, sql+" RETURNING "+rr.selectList(), args...)
+}
+
+// Update applies the values and returns the updated row
+func (rr *Resource) Update(
+	ctx context.Context,
+	id interface{},
+	values map[string]interface{},
+) (map[string]interface{}, error) {
+	if len(values) == 0 {
+		return rr.Find(ctx, id)
+	}
+
+	names, args := sortedValues(values)
+
+	sets := make([]string, 0, len(names))
+	for i, name := range names {
+		sets = append(sets, query.QuoteIdent(name)+" = $"+strconv.Itoa(i+2))
+	}
+
+	return rr.one(
+		ctx,
+		"UPDATE "+query.QuoteIdent(rr.schema.Table)+" SET "+strings.Join(sets, ", ")+
+			" WHERE "+rr.pkCondition()+" RETURNING "+rr.selectList(),
+		append([]interface{}{id}, args...)...,
+	)
+}
+
+func (rr *Resource) Delete(ctx context.Context, id interface{}) error {
+	res, err := rr.db.ExecContext(ctx, "DELETE FROM "+query.QuoteIdent(rr.schema.Table)+" WHERE "+rr.pkCondition(), id)
+	if err != nil {
+		return constraintError(err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return store.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (rr *Resource) one(ctx context.Context, sql string, args ...interface{}) (map[string]interface{}, error) {
+	rows, err := rr.db.QueryxContext(ctx, sql, args...)
+	if err != nil {
+		return nil, constraintError(err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, constraintError(err)
+		}
+
+		return nil, store.ErrRecordNotFound
+	}
+
+	return scanRow(rows)
+}
+
+func (rr *Resource) selectList() string {
+	quoted := make([]string, 0, len(rr.columns))
+	for _, c := range rr.columns {
+		quoted = append(quoted, query.QuoteIdent(c))
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+func (rr *Resource) pkCondition() string {
+	return query.QuoteIdent(rr.schema.PrimaryKey) + " = $1"
+}
+
+// sortedValues keeps the generated SQL stable
+func sortedValues(values map[string]interface{}) ([]string, []interface{}) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		args = append(args, values[name])
+	}
+
+	return names, args
+}
+
+func scanRow(rows *sqlx.Rows) (map[string]interface{}, error) {
+	item := map[string]interface{}{}
+	if err := rows.MapScan(item); err != nil {
+		return nil, err
+	}
+
+	// types the driver doesn't decode, e.g. numeric, come as text
+	for k, v := range item {
+		if b, ok := v.([]byte); ok {
+			item[k] = string(b)
+		}
+	}
+
+	return item, nil
+}
+
+// NewResource constructs the repository of the schema table, columns are selected for every returned row
+func NewResource(db *sqlx.DB, schema *query.Schema, columns []string) *Resource {
+	return &Resource{
+		db:      db,
+		schema:  schema,
+		columns: columns,
+	}
+}
@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"godmin/internal/model"
+	"godmin/internal/store"
+)
+
+type Role struct {
+	db *sqlx.DB
+}
+
+// FindAll returns every role with its permissions
+func (rr *Role) FindAll(ctx context.Context) ([]*model.Role, error) {
+	rows, err := rr.db.QueryContext(
+		ctx,
+		`SELECT r.id, r.name, r.description, p.name
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		LEFT JOIN permissions p ON p.id = rp.permission_id
+		ORDER BY r.name, p.name`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := make([]*model.Role, 0)
+	var role *model.Role
+	for rows.Next() {
+		r := &model.Role{}
+		var permission sql.NullString
+
+		if err := rows.Scan(&r.ID, &r.Name, &r.Description, &permission); err != nil {
+			return nil, err
+		}
+
+		if role == nil || role.ID != r.ID {
+			role = r
+			role.Permissions = []string{}
+			roles = append(roles, role)
+		}
+		if permission.Valid {
+			role.Permissions = append(role.Permissions, permission.String)
+		}
+	}
+
+	return roles, rows.Err()
+}
+
+// FindNamesByUser returns the names of the roles granted to the user
+func (rr *Role) FindNamesByUser(ctx context.Context, userID uint64) ([]string, error) {
+	names := make([]string, 0)
+
+	err := rr.db.SelectContext(
+		ctx,
+		&names,
+		"SELECT r.name FROM roles r JOIN user_roles ur ON ur.role_id = r.id WHERE ur.user_id = $1 ORDER BY r.name",
+		userID,
+	)
+
+	return names, err
+}
+
+// FindPermissionsByUser returns the permissions the user has through any of their roles
+func (rr *Role) FindPermissionsByUser(ctx context.Context, userID uint64) ([]string, error) {
+	permissions := make([]string, 0)
+
+	err := rr.db.SelectContext(
+		ctx,
+		&permissions,
+		`SELECT DISTINCT p.name
+		FROM permissions p
+		JOIN role_permissions rp ON rp.permission_id = p.id
+		JOIN user_roles ur ON ur.role_id = rp.role_id
+		WHERE ur.user_id = $1
+		ORDER BY p.name`,
+		userID,
+	)
+
+	return permissions, err
+}
+
+// Grant grants the role to the user, it returns store.ErrRecordNotFound if there is no such role
+func (rr *Role) Grant(ctx context.Context, userID uint64, roleName string) error {
+	var roleID uint64
+	if err := rr.db.QueryRowContext(ctx, "SELECT id FROM roles WHERE name = $1", roleName).Scan(&roleID); err != nil {
+		if err == sql.ErrNoRows {
+			return store.ErrRecordNotFound
+		}
+
+		return err
+	}
+
+	_, err := rr.db.ExecContext(
+		ctx,
+		"INSERT INTO user_roles (user_id, role_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		userID,
+		roleID,
+	)
+
+	return err
+}
+
+// Revoke revokes the role from the user, it returns store.ErrRecordNotFound if the user doesn't have it
+func (rr *Role) Revoke(ctx context.Context, userID uint64, roleName string) error {
+	res, err := rr.db.ExecContext(
+		ctx,
+		"DELETE FROM user_roles ur USING roles r WHERE ur.role_id = r.id AND ur.user_id = $1 AND r.name = $2",
+		userID,
+		roleName,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return store.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// FindAllPermissions returns the names of every permission, granted to a role or not
+func (rr *Role) FindAllPermissions(ctx context.Context) ([]string, error) {
+	permissions := make([]string, 0)
+
+	err := rr.db.SelectContext(ctx, &permissions, "SELECT name FROM permissions ORDER BY name")
+
+	return permissions, err
+}
+
+// CreatePermission creates the permission unless it exists, a new permission is granted to the role
+func (rr *Role) CreatePermission(ctx context.Context, name string, description string, roleName string) error {
+	_, err := rr.db.ExecContext(
+		ctx,
+		`WITH created AS (
+			INSERT INTO permissions (name, description) VALUES ($1, $2)
+			ON CONFLICT (name) DO NOTHING
+			RETURNING id
+		)
+		INSERT INTO role_permissions (role_id, permission_id)
+		SELECT r.id, c.id FROM roles r CROSS JOIN created c WHERE r.name = $3`,
+		name,
+		description,
+		roleName,
+	)
+
+	return err
+}
+
+func NewRole(db *sqlx.DB) *Role {
+	return &Role{
+		db: db,
+	}
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"godmin/internal/model"
+	"godmin/internal/store"
+)
+
+type TOTP struct {
+	db *sqlx.DB
+}
+
+func (tr *TOTP) FindByUser(ctx context.Context, userID uint64) (*model.TOTP, error) {
+	t := &model.TOTP{}
+
+	if err := tr.db.QueryRowContext(
+		ctx,
+		"SELECT user_id, secret, confirmed_at, last_used_step FROM user_totp WHERE user_id = $1",
+		userID,
+	).Scan(
+		&t.UserID,
+		&t.Secret,
+		&t.ConfirmedAt,
+		&t.LastUsedStep,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, store.ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Enroll stores a new unconfirmed secret.
+// A confirmed enrollment is never replaced, false is returned in that case.
+func (tr *TOTP) Enroll(ctx context.Context, t *model.TOTP) (bool, error) {
+	res, err := tr.db.ExecContext(
+		ctx,
+		`INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_used_step = 0
+		WHERE user_totp.confirmed_at IS NULL`,
+		t.UserID,
+		t.Secret,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+func (tr *TOTP) Confirm(ctx context.Context, userID uint64) error {
+	_, err := tr.db.ExecContext(ctx, "UPDATE user_totp SET confirmed_at = now() WHERE user_id = $1", userID)
+	return err
+}
+
+// UseStep marks the time step as used. It returns false when the step or a later one was already used,
+// so every code is accepted only once.
+func (tr *TOTP) UseStep(ctx context.Context, userID uint64, step int64) (bool, error) {
+	res, err := tr.db.ExecContext(
+		ctx,
+		"UPDATE user_totp SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2",
+		userID,
+		step,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+func (tr *TOTP) Delete(ctx context.Context, userID uint64) error {
+	_, err := tr.db.ExecContext(ctx, "DELETE FROM user_totp WHERE user_id = $1", userID)
+	return err
+}
+
+func NewTOTP(db *sqlx.DB) *TOTP {
+	return &TOTP{
+		db: db,
+	}
+}
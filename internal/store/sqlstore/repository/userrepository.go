@@ -1,50 +1,97 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 	"github.com/jmoiron/sqlx"
 	"godmin/internal/model"
+	"godmin/internal/password"
 	"godmin/internal/store"
+	"godmin/internal/store/query"
+	"strings"
 )
 
 type User struct {
-	db *sqlx.DB
+	db     *sqlx.DB
+	hasher *password.Hasher
 }
 
-func (ur *User) Create(u *model.User) error {
-	emailExists, err := ur.EmailExists(u)
-	if err != nil {
-		return err
-	}
-
-	if emailExists {
-		return fmt.Errorf("already used email: %s", u.Email)
-	}
+const (
+	usersEmailKey = "users_email_key"
+	userColumns   = "id, name, email, encrypted_password, disabled_at, email_verified_at"
+)
 
-	if err := u.BeforeCreate(); err != nil {
+func (ur *User) Create(ctx context.Context, u *model.User) error {
+	if err := u.BeforeCreate(ur.hasher); err != nil {
 		return err
 	}
 
-	return ur.db.QueryRow(
-		"INSERT INTO users (name, email, encrypted_password) VALUES ($1, $2, $3) RETURNING id",
+	err := ur.db.QueryRowContext(
+		ctx,
+		"INSERT INTO users (name, email, encrypted_password, email_verified_at) VALUES ($1, $2, $3, $4) RETURNING id",
 		u.Name,
 		u.Email,
 		u.EncryptedPassword,
+		u.EmailVerifiedAt,
 	).Scan(&u.ID)
+	if isUniqueViolation(err, usersEmailKey) {
+		return store.ErrEmailUsed
+	}
+
+	return err
+}
+
+// List returns a page of users matching the query
+func (ur *User) List(ctx context.Context, q *query.Query) ([]*model.User, *query.Page, error) {
+	sql, args := q.Build(strings.Split(userColumns, ", "))
+
+	rows, err := ur.db.QueryContext(ctx, sql, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	users := make([]*model.User, 0, q.Limit+1)
+	for rows.Next() {
+		u := &model.User{}
+		if err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.EncryptedPassword, &u.DisabledAt, &u.EmailVerifiedAt); err != nil {
+			return nil, nil, err
+		}
+
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	page := q.Paginate(&users, func(i int, column string) interface{} {
+		switch column {
+		case "name":
+			return users[i].Name
+		case "email":
+			return users[i].Email
+		default:
+			return users[i].ID
+		}
+	})
+
+	return users, page, nil
 }
 
-func (ur *User) Find(id uint64) (*model.User, error) {
+func (ur *User) Find(ctx context.Context, id uint64) (*model.User, error) {
 	u := &model.User{}
 
-	if err := ur.db.QueryRow(
-		"SELECT id, name, email, encrypted_password FROM users WHERE id = $1",
+	if err := ur.db.QueryRowContext(
+		ctx,
+		"SELECT "+userColumns+" FROM users WHERE id = $1",
 		id,
 	).Scan(
 		&u.ID,
 		&u.Name,
 		&u.Email,
 		&u.EncryptedPassword,
+		&u.DisabledAt,
+		&u.EmailVerifiedAt,
 	); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, store.ErrRecordNotFound
@@ -56,17 +103,20 @@ func (ur *User) Find(id uint64) (*model.User, error) {
 	return u, nil
 }
 
-func (ur *User) FindByEmail(email string) (*model.User, error) {
+func (ur *User) FindByEmail(ctx context.Context, email string) (*model.User, error) {
 	u := &model.User{}
 
-	if err := ur.db.QueryRow(
-		"SELECT id, name, email, encrypted_password FROM users WHERE email = $1",
+	if err := ur.db.QueryRowContext(
+		ctx,
+		"SELECT "+userColumns+" FROM users WHERE email = $1",
 		email,
 	).Scan(
 		&u.ID,
 		&u.Name,
 		&u.Email,
 		&u.EncryptedPassword,
+		&u.DisabledAt,
+		&u.EmailVerifiedAt,
 	); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, store.ErrRecordNotFound
@@ -78,27 +128,159 @@ func (ur *User) FindByEmail(email string) (*model.User, error) {
 	return u, nil
 }
 
-func (ur *User) EmailExists(u *model.User) (bool, error) {
-	var count int
+// Update applies the changes and returns the updated user.
+// A new password and the history of the former one are written in one transaction.
+func (ur *User) Update(ctx context.Context, id uint64, c *model.UserChanges) (*model.User, error) {
+	if err := c.BeforeUpdate(ur.hasher); err != nil {
+		return nil, err
+	}
 
-	err := ur.db.QueryRow(
-		"SELECT count(1) FROM users WHERE email = $1",
-		u.Email,
-	).Scan(&count)
+	if c.EncryptedPassword == nil || c.KeepPasswords == 0 {
+		return ur.update(ctx, ur.db, id, c)
+	}
+
+	tx, err := ur.db.BeginTxx(ctx, nil)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// the hash is read in the transaction, so the history gets the one which is replaced
+	if _, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO password_history (user_id, encrypted_password) SELECT id, encrypted_password FROM users WHERE id = $1",
+		id,
+	); err != nil {
+		return nil, err
+	}
+	if err := trimPasswordHistory(ctx, tx, id, c.KeepPasswords); err != nil {
+		return nil, err
+	}
+
+	u, err := ur.update(ctx, tx, id, c)
+	if err != nil {
+		return nil, err
 	}
 
-	return count > 0, nil
+	return u, tx.Commit()
 }
 
-func (ur *User) Delete(u *model.User) error {
-	_, err := ur.db.Exec("DELETE FROM users WHERE id = $1", u.ID)
-	return err
+func (ur *User) update(ctx context.Context, q sqlx.QueryerContext, id uint64, c *model.UserChanges) (*model.User, error) {
+	u := &model.User{}
+
+	if err := q.QueryRowxContext(
+		ctx,
+		`UPDATE users SET
+			name = COALESCE($2, name),
+			email = COALESCE($3, email),
+			encrypted_password = COALESCE($4, encrypted_password),
+			email_verified_at = COALESCE(
+				CASE WHEN $3 IS NULL OR $3 = email THEN email_verified_at END,
+				CASE WHEN $5 THEN now() END
+			)
+		WHERE id = $1
+		RETURNING `+userColumns,
+		id,
+		c.Name,
+		c.Email,
+		c.EncryptedPassword,
+		c.EmailVerified,
+	).Scan(
+		&u.ID,
+		&u.Name,
+		&u.Email,
+		&u.EncryptedPassword,
+		&u.DisabledAt,
+		&u.EmailVerifiedAt,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, store.ErrRecordNotFound
+		}
+		if isUniqueViolation(err, usersEmailKey) {
+			return nil, store.ErrEmailUsed
+		}
+
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// VerifyEmail marks the email of the user verified, it returns ErrRecordNotFound if the user has another email now
+func (ur *User) VerifyEmail(ctx context.Context, id uint64, email string) (*model.User, error) {
+	u := &model.User{}
+
+	if err := ur.db.QueryRowContext(
+		ctx,
+		`UPDATE users SET email_verified_at = COALESCE(email_verified_at, now())
+		WHERE id = $1 AND email = $2
+		RETURNING `+userColumns,
+		id,
+		email,
+	).Scan(
+		&u.ID,
+		&u.Name,
+		&u.Email,
+		&u.EncryptedPassword,
+		&u.DisabledAt,
+		&u.EmailVerifiedAt,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, store.ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// SetDisabled disables the user or enables it again, the time of the first disabling is kept
+func (ur *User) SetDisabled(ctx context.Context, id uint64, disabled bool) error {
+	res, err := ur.db.ExecContext(
+		ctx,
+		"UPDATE users SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, now()) END WHERE id = $1",
+		id,
+		disabled,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return store.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (ur *User) Delete(ctx context.Context, u *model.User) error {
+	res, err := ur.db.ExecContext(ctx, "DELETE FROM users WHERE id = $1", u.ID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return store.ErrRecordNotFound
+	}
+
+	return nil
 }
 
-func NewUser(db *sqlx.DB) *User {
+// NewUser hashes the passwords with the hasher
+func NewUser(db *sqlx.DB, hasher *password.Hasher) *User {
 	return &User{
-		db: db,
+		db:     db,
+		hasher: hasher,
 	}
 }
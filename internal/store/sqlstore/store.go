@@ -2,26 +2,114 @@ package sqlstore
 
 import (
 	"github.com/jmoiron/sqlx"
+	"godmin/internal/password"
+	"godmin/internal/store"
+	"godmin/internal/store/query"
 	"godmin/internal/store/sqlstore/repository"
 )
 
 type Store struct {
-	db             *sqlx.DB
-	userRepository *repository.User
+	db                        *sqlx.DB
+	hasher                    *password.Hasher
+	userRepository            *repository.User
+	totpRepository            *repository.TOTP
+	recoveryCodeRepository    *repository.RecoveryCode
+	passwordHistoryRepository *repository.PasswordHistory
+	apiKeyRepository          *repository.ApiKey
+	roleRepository            *repository.Role
+	catalogRepository         *repository.Catalog
+	auditRepository           *repository.Audit
 }
 
-func New(db *sqlx.DB) *Store {
+// New builds the store on the database, the user passwords are hashed with the hasher
+func New(db *sqlx.DB, hasher *password.Hasher) *Store {
 	return &Store{
-		db: db,
+		db:     db,
+		hasher: hasher,
 	}
 }
 
-func (s *Store) User() *repository.User {
+func (s *Store) User() store.UserRepository {
 	if s.userRepository != nil {
 		return s.userRepository
 	}
 
-	s.userRepository = repository.NewUser(s.db)
+	s.userRepository = repository.NewUser(s.db, s.hasher)
 
 	return s.userRepository
 }
+
+func (s *Store) TOTP() store.TOTPRepository {
+	if s.totpRepository != nil {
+		return s.totpRepository
+	}
+
+	s.totpRepository = repository.NewTOTP(s.db)
+
+	return s.totpRepository
+}
+
+func (s *Store) PasswordHistory() store.PasswordHistoryRepository {
+	if s.passwordHistoryRepository != nil {
+		return s.passwordHistoryRepository
+	}
+
+	s.passwordHistoryRepository = repository.NewPasswordHistory(s.db)
+
+	return s.passwordHistoryRepository
+}
+
+func (s *Store) RecoveryCode() store.RecoveryCodeRepository {
+	if s.recoveryCodeRepository != nil {
+		return s.recoveryCodeRepository
+	}
+
+	s.recoveryCodeRepository = repository.NewRecoveryCode(s.db)
+
+	return s.recoveryCodeRepository
+}
+
+func (s *Store) ApiKey() store.ApiKeyRepository {
+	if s.apiKeyRepository != nil {
+		return s.apiKeyRepository
+	}
+
+	s.apiKeyRepository = repository.NewApiKey(s.db)
+
+	return s.apiKeyRepository
+}
+
+func (s *Store) Role() store.RoleRepository {
+	if s.roleRepository != nil {
+		return s.roleRepository
+	}
+
+	s.roleRepository = repository.NewRole(s.db)
+
+	return s.roleRepository
+}
+
+func (s *Store) Catalog() store.CatalogRepository {
+	if s.catalogRepository != nil {
+		return s.catalogRepository
+	}
+
+	s.catalogRepository = repository.NewCatalog(s.db)
+
+	return s.catalogRepository
+}
+
+func (s *Store) Audit() store.AuditRepository {
+	if s.auditRepository != nil {
+		return s.auditRepository
+	}
+
+	s.auditRepository = repository.NewAudit(s.db)
+
+	return s.auditRepository
+}
+
+// Resource returns a generic repository of the schema table
+func (s *Store) Resource(schema *query.Schema, columns []string) store.ResourceRepository {
+	return repository.NewResource(s.db, schema, columns)
+}
@@ -0,0 +1,207 @@
+// Package store defines the repositories the server works with.
+// sqlstore and memorystore implement them on Postgres and Redis, teststore keeps everything in process.
+package store
+
+import (
+	"context"
+	"godmin/internal/dto"
+	"godmin/internal/model"
+	"godmin/internal/store/query"
+	"time"
+)
+
+// Store keeps the persistent data
+type Store interface {
+	User() UserRepository
+	TOTP() TOTPRepository
+	RecoveryCode() RecoveryCodeRepository
+	PasswordHistory() PasswordHistoryRepository
+	ApiKey() ApiKeyRepository
+	Role() RoleRepository
+	Catalog() CatalogRepository
+	Audit() AuditRepository
+	// Resource returns a generic repository of the schema table, columns are returned for every row
+	Resource(schema *query.Schema, columns []string) ResourceRepository
+}
+
+// MemoryStore keeps the short-lived data, entries expire on their own
+type MemoryStore interface {
+	Token() TokenRepository
+	Challenge() ChallengeRepository
+	PasswordReset() PasswordResetRepository
+	LoginAttempt() LoginAttemptRepository
+}
+
+// UserSchema whitelists what the users list can be filtered and sorted by
+var UserSchema = &query.Schema{
+	Table:      "users",
+	PrimaryKey: "id",
+	Columns: []*query.Column{
+		{Name: "id", Type: query.TypeInt, Filterable: true, Sortable: true},
+		{Name: "name", Type: query.TypeText, Filterable: true, Sortable: true},
+		{Name: "email", Type: query.TypeText, Filterable: true, Sortable: true},
+		{Name: "disabled_at", Type: query.TypeTime, Nullable: true, Filterable: true},
+		{Name: "email_verified_at", Type: query.TypeTime, Nullable: true, Filterable: true},
+	},
+}
+
+// AuditSchema whitelists what the audit log can be filtered and sorted by
+var AuditSchema = &query.Schema{
+	Table:      "audit_events",
+	PrimaryKey: "id",
+	Columns: []*query.Column{
+		{Name: "id", Type: query.TypeInt, Filterable: true, Sortable: true},
+		{Name: "actor_id", Type: query.TypeInt, Nullable: true, Filterable: true},
+		{Name: "action", Type: query.TypeText, Filterable: true},
+		{Name: "target_type", Type: query.TypeText, Filterable: true},
+		{Name: "target_id", Type: query.TypeText, Filterable: true},
+		{Name: "ip", Type: query.TypeText, Filterable: true},
+		{Name: "request_id", Type: query.TypeText, Filterable: true},
+		{Name: "created_at", Type: query.TypeTime, Filterable: true, Sortable: true},
+	},
+}
+
+type UserRepository interface {
+	// Create hashes the password and stores the user, it returns ErrEmailUsed if the email is taken
+	Create(ctx context.Context, u *model.User) error
+	// List returns a page of users matching the query of UserSchema
+	List(ctx context.Context, q *query.Query) ([]*model.User, *query.Page, error)
+	Find(ctx context.Context, id uint64) (*model.User, error)
+	FindByEmail(ctx context.Context, email string) (*model.User, error)
+	// Update applies the changes and returns the updated user, a new email has to be verified again
+	// unless the changes say it is, see model.UserChanges.EmailVerified.
+	// The former password hash joins the history in the same write, see model.UserChanges.KeepPasswords.
+	Update(ctx context.Context, id uint64, c *model.UserChanges) (*model.User, error)
+	// VerifyEmail marks the email of the user verified, it returns ErrRecordNotFound if the user has another email now.
+	// The time of the first verification is kept.
+	VerifyEmail(ctx context.Context, id uint64, email string) (*model.User, error)
+	// SetDisabled disables the user or enables it again, the time of the first disabling is kept
+	SetDisabled(ctx context.Context, id uint64, disabled bool) error
+	Delete(ctx context.Context, u *model.User) error
+}
+
+type TOTPRepository interface {
+	FindByUser(ctx context.Context, userID uint64) (*model.TOTP, error)
+	// Enroll stores a new unconfirmed secret, it returns false if a confirmed enrollment exists
+	Enroll(ctx context.Context, t *model.TOTP) (bool, error)
+	Confirm(ctx context.Context, userID uint64) error
+	// UseStep marks the time step as used, it returns false when the step or a later one was already used
+	UseStep(ctx context.Context, userID uint64, step int64) (bool, error)
+	Delete(ctx context.Context, userID uint64) error
+}
+
+type RecoveryCodeRepository interface {
+	// Replace drops the user's recovery codes and stores the new ones
+	Replace(ctx context.Context, userID uint64, hashes []string) error
+	// Use marks the code as used, it returns false if there is no such unused code
+	Use(ctx context.Context, userID uint64, hash string) (bool, error)
+	DeleteByUser(ctx context.Context, userID uint64) error
+}
+
+type PasswordHistoryRepository interface {
+	// Add records a former password hash of the user and keeps only the keep latest ones
+	Add(ctx context.Context, userID uint64, encryptedPassword string, keep int) error
+	// FindByUser returns the latest former password hashes of the user, the latest first
+	FindByUser(ctx context.Context, userID uint64, limit int) ([]string, error)
+}
+
+type ApiKeyRepository interface {
+	// Create generates the key and stores its hash
+	Create(ctx context.Context, k *model.ApiKey) error
+	// FindByUser returns the user's keys which are not revoked, expired keys included
+	FindByUser(ctx context.Context, userID uint64) ([]*model.ApiKey, error)
+	// Use finds an active key by its hash and records the usage
+	Use(ctx context.Context, keyHash string) (*model.ApiKey, error)
+	Revoke(ctx context.Context, userID uint64, id uint64) error
+	// RevokeByUser revokes every active key of the user and returns how many were revoked
+	RevokeByUser(ctx context.Context, userID uint64) (int64, error)
+}
+
+type RoleRepository interface {
+	// FindAll returns every role with its permissions
+	FindAll(ctx context.Context) ([]*model.Role, error)
+	FindNamesByUser(ctx context.Context, userID uint64) ([]string, error)
+	// FindPermissionsByUser returns the permissions the user has through any of their roles
+	FindPermissionsByUser(ctx context.Context, userID uint64) ([]string, error)
+	// Grant grants the role to the user, it returns ErrRecordNotFound if there is no such role
+	Grant(ctx context.Context, userID uint64, roleName string) error
+	// Revoke revokes the role from the user, it returns ErrRecordNotFound if the user doesn't have it
+	Revoke(ctx context.Context, userID uint64, roleName string) error
+	// FindAllPermissions returns the names of every permission, granted to a role or not
+	FindAllPermissions(ctx context.Context) ([]string, error)
+	// CreatePermission creates the permission unless it exists, a new permission is granted to the role
+	CreatePermission(ctx context.Context, name string, description string, roleName string) error
+}
+
+type CatalogRepository interface {
+	// Tables describes the tables of the database schema
+	Tables(ctx context.Context, schema string) ([]*model.Table, error)
+}
+
+type AuditRepository interface {
+	Create(ctx context.Context, e *model.AuditEvent) error
+	// List returns a page of events matching the query of AuditSchema
+	List(ctx context.Context, q *query.Query) ([]*model.AuditEvent, *query.Page, error)
+}
+
+// ResourceRepository stores the rows of a table as maps of the column values
+type ResourceRepository interface {
+	List(ctx context.Context, q *query.Query) ([]map[string]interface{}, *query.Page, error)
+	Find(ctx context.Context, id interface{}) (map[string]interface{}, error)
+	Create(ctx context.Context, values map[string]interface{}) (map[string]interface{}, error)
+	Update(ctx context.Context, id interface{}, values map[string]interface{}) (map[string]interface{}, error)
+	Delete(ctx context.Context, id interface{}) error
+}
+
+type TokenRepository interface {
+	// Create stores the token pair of a new token family started by the client
+	Create(ctx context.Context, userId uint64, t *dto.Token, c *dto.Client) error
+	// Find returns the id of the user the access token was issued to
+	Find(ctx context.Context, accessUuid string) (uint64, error)
+	Delete(ctx context.Context, accessUuid string) (int64, error)
+	FindFamily(ctx context.Context, familyID string) (*dto.TokenFamily, error)
+	// FindUserFamilies returns the active token families of the user, the most recent first
+	FindUserFamilies(ctx context.Context, userId uint64) ([]*dto.TokenFamily, error)
+	// Touch records the family has just been used
+	Touch(ctx context.Context, familyID string) error
+	// Rotate replaces the family's token pair, it returns ErrTokenReused if refreshUuid is not the latest one
+	Rotate(ctx context.Context, familyID string, refreshUuid string, next *dto.Token) error
+	RevokeFamily(ctx context.Context, familyID string) error
+	RevokeUserFamilies(ctx context.Context, userId uint64) (int, error)
+	RevokeAll(ctx context.Context) (int, error)
+}
+
+type ChallengeRepository interface {
+	// Create issues a new challenge for the user and returns its id
+	Create(ctx context.Context, userId uint64, ttl time.Duration) (string, error)
+	// Find returns the id of the user the challenge was issued for
+	Find(ctx context.Context, id string) (uint64, error)
+	// Fail counts a failed attempt, the challenge is dropped once maxAttempts is reached
+	Fail(ctx context.Context, id string, maxAttempts int) error
+	Delete(ctx context.Context, id string) error
+}
+
+// PasswordResetRepository keeps the hashes of the password reset tokens until they are used or expire
+type PasswordResetRepository interface {
+	// Create stores the token hash of the user, the previous token of the user stops working
+	Create(ctx context.Context, userId uint64, tokenHash string, ttl time.Duration) error
+	// Find returns the id of the user of the token without using it
+	Find(ctx context.Context, tokenHash string) (uint64, error)
+	// Consume deletes the token and returns the id of its user, ErrRecordNotFound if it is unknown, used or expired
+	Consume(ctx context.Context, tokenHash string) (uint64, error)
+}
+
+// LoginAttemptRepository counts the failed logins in sliding windows and keeps the lockouts.
+// The keys tell what is throttled, e.g. an address or an email.
+type LoginAttemptRepository interface {
+	// Fail records a failed login and returns the failures of the window, the new one included
+	Fail(ctx context.Context, key string, window time.Duration) (*dto.LoginFailures, error)
+	// Failures returns the failures of the window
+	Failures(ctx context.Context, key string, window time.Duration) (*dto.LoginFailures, error)
+	// Reset forgets the failures of the key
+	Reset(ctx context.Context, key string) error
+	Lock(ctx context.Context, key string, d time.Duration) error
+	// LockedFor returns how long the key stays locked, zero if it isn't
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+	Unlock(ctx context.Context, key string) error
+}
@@ -0,0 +1,110 @@
+package teststore
+
+import (
+	"context"
+	"godmin/internal/model"
+	"godmin/internal/store"
+	"sort"
+)
+
+type ApiKeyRepository struct {
+	store *Store
+}
+
+func (r *ApiKeyRepository) Create(ctx context.Context, k *model.ApiKey) error {
+	if err := k.BeforeCreate(); err != nil {
+		return err
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	k.ID = r.store.nextID()
+	k.CreatedAt = r.store.clock()
+
+	// like the database, only the hash of the key is kept
+	stored := *k
+	stored.Key = ""
+	stored.Scopes = append([]string(nil), k.Scopes...)
+	r.store.apiKeys[k.ID] = &stored
+
+	return nil
+}
+
+// FindByUser returns the user's keys which are not revoked, expired keys included
+func (r *ApiKeyRepository) FindByUser(ctx context.Context, userID uint64) ([]*model.ApiKey, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	keys := make([]*model.ApiKey, 0)
+	for _, k := range r.store.apiKeys {
+		if k.UserID == userID && k.RevokedAt == nil {
+			keys = append(keys, copyApiKey(k))
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+
+	return keys, nil
+}
+
+// Use finds an active key by its hash and records the usage
+func (r *ApiKeyRepository) Use(ctx context.Context, keyHash string) (*model.ApiKey, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	now := r.store.clock()
+	for _, k := range r.store.apiKeys {
+		if k.KeyHash != keyHash || k.RevokedAt != nil || (k.ExpiresAt != nil && !k.ExpiresAt.After(now)) {
+			continue
+		}
+
+		k.LastUsedAt = &now
+
+		return copyApiKey(k), nil
+	}
+
+	return nil, store.ErrRecordNotFound
+}
+
+// Revoke revokes the user's key
+func (r *ApiKeyRepository) Revoke(ctx context.Context, userID uint64, id uint64) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	k, ok := r.store.apiKeys[id]
+	if !ok || k.UserID != userID || k.RevokedAt != nil {
+		return store.ErrRecordNotFound
+	}
+
+	now := r.store.clock()
+	k.RevokedAt = &now
+
+	return nil
+}
+
+// RevokeByUser revokes every active key of the user and returns how many were revoked
+func (r *ApiKeyRepository) RevokeByUser(ctx context.Context, userID uint64) (int64, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	now := r.store.clock()
+	var revoked int64
+	for _, k := range r.store.apiKeys {
+		if k.UserID == userID && k.RevokedAt == nil {
+			k.RevokedAt = &now
+			revoked++
+		}
+	}
+
+	return revoked, nil
+}
+
+func copyApiKey(k *model.ApiKey) *model.ApiKey {
+	c := *k
+	c.Scopes = append([]string(nil), k.Scopes...)
+
+	return &c
+}
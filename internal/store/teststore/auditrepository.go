@@ -0,0 +1,79 @@
+package teststore
+
+import (
+	"context"
+	"encoding/json"
+	"godmin/internal/model"
+	"godmin/internal/store/query"
+)
+
+type AuditRepository struct {
+	store *Store
+}
+
+// Create stores a copy of the event, the changes go through JSON as they do in the JSONB column
+func (r *AuditRepository) Create(ctx context.Context, e *model.AuditEvent) error {
+	changes, err := json.Marshal(e.Changes)
+	if err != nil {
+		return err
+	}
+
+	stored := *e
+	stored.Changes = nil
+	if err := json.Unmarshal(changes, &stored.Changes); err != nil {
+		return err
+	}
+	if e.ActorID != nil {
+		actorID := *e.ActorID
+		stored.ActorID = &actorID
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	stored.ID = r.store.nextID()
+	stored.CreatedAt = r.store.clock()
+	r.store.auditEvents = append(r.store.auditEvents, &stored)
+
+	e.ID = stored.ID
+	e.CreatedAt = stored.CreatedAt
+
+	return nil
+}
+
+func (r *AuditRepository) List(ctx context.Context, q *query.Query) ([]*model.AuditEvent, *query.Page, error) {
+	r.store.mu.Lock()
+	// events are never modified, they can be shared
+	events := append([]*model.AuditEvent{}, r.store.auditEvents...)
+	r.store.mu.Unlock()
+
+	key := func(i int, column string) interface{} {
+		e := events[i]
+		switch column {
+		case "actor_id":
+			if e.ActorID == nil {
+				return nil
+			}
+			return *e.ActorID
+		case "action":
+			return e.Action
+		case "target_type":
+			return e.TargetType
+		case "target_id":
+			return e.TargetID
+		case "ip":
+			return e.IP
+		case "request_id":
+			return e.RequestID
+		case "created_at":
+			return e.CreatedAt
+		default:
+			return e.ID
+		}
+	}
+
+	q.Select(&events, key)
+	page := q.Paginate(&events, key)
+
+	return events, page, nil
+}
@@ -0,0 +1,76 @@
+package teststore
+
+import (
+	"context"
+	"godmin/internal/store"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const challengeKeyPrefix = "mfa_challenge:"
+
+type challenge struct {
+	userId   uint64
+	attempts int
+}
+
+// ChallengeRepository keeps the MFA challenges issued after a successful password check
+type ChallengeRepository struct {
+	store *MemoryStore
+}
+
+// Create issues a new challenge for the user and returns its id
+func (r *ChallengeRepository) Create(ctx context.Context, userId uint64, ttl time.Duration) (string, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	id := uuid.New().String()
+	r.store.set(challengeKey(id), &challenge{userId: userId}, r.store.clock().Add(ttl))
+
+	return id, nil
+}
+
+// Find returns the id of the user the challenge was issued for
+func (r *ChallengeRepository) Find(ctx context.Context, id string) (uint64, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	c, ok := r.store.get(challengeKey(id)).(*challenge)
+	if !ok {
+		return 0, store.ErrRecordNotFound
+	}
+
+	return c.userId, nil
+}
+
+// Fail counts a failed attempt, the challenge is dropped once maxAttempts is reached
+func (r *ChallengeRepository) Fail(ctx context.Context, id string, maxAttempts int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	c, ok := r.store.get(challengeKey(id)).(*challenge)
+	if !ok {
+		return nil
+	}
+
+	c.attempts++
+	if c.attempts >= maxAttempts {
+		r.store.del(challengeKey(id))
+	}
+
+	return nil
+}
+
+func (r *ChallengeRepository) Delete(ctx context.Context, id string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.del(challengeKey(id))
+
+	return nil
+}
+
+func challengeKey(id string) string {
+	return challengeKeyPrefix + id
+}
@@ -0,0 +1,105 @@
+package teststore
+
+import (
+	"context"
+	"godmin/internal/dto"
+	"time"
+)
+
+const (
+	loginFailuresKeyPrefix = "login_failures:"
+	loginLockKeyPrefix     = "login_lock:"
+)
+
+// LoginAttemptRepository counts the failed logins in sliding windows and keeps the lockouts
+type LoginAttemptRepository struct {
+	store *MemoryStore
+}
+
+// Fail records a failed login and returns the failures of the window, the new one included
+func (r *LoginAttemptRepository) Fail(ctx context.Context, key string, window time.Duration) (*dto.LoginFailures, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	now := r.store.clock()
+	failures := append(r.failures(key, now, window), now)
+	r.store.set(loginFailuresKeyPrefix+key, failures, now.Add(window))
+
+	return newLoginFailures(failures), nil
+}
+
+// Failures returns the failures of the window
+func (r *LoginAttemptRepository) Failures(
+	ctx context.Context,
+	key string,
+	window time.Duration,
+) (*dto.LoginFailures, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	return newLoginFailures(r.failures(key, r.store.clock(), window)), nil
+}
+
+// Reset forgets the failures of the key
+func (r *LoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.del(loginFailuresKeyPrefix + key)
+
+	return nil
+}
+
+func (r *LoginAttemptRepository) Lock(ctx context.Context, key string, d time.Duration) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.set(loginLockKeyPrefix+key, true, r.store.clock().Add(d))
+
+	return nil
+}
+
+// LockedFor returns how long the key stays locked, zero if it isn't
+func (r *LoginAttemptRepository) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if r.store.get(loginLockKeyPrefix+key) == nil {
+		return 0, nil
+	}
+
+	return r.store.entries[loginLockKeyPrefix+key].expiresAt.Sub(r.store.clock()), nil
+}
+
+func (r *LoginAttemptRepository) Unlock(ctx context.Context, key string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.del(loginLockKeyPrefix + key)
+
+	return nil
+}
+
+// failures returns the failure times still in the window, the oldest first
+func (r *LoginAttemptRepository) failures(key string, now time.Time, window time.Duration) []time.Time {
+	all, _ := r.store.get(loginFailuresKeyPrefix + key).([]time.Time)
+
+	failures := make([]time.Time, 0, len(all)+1)
+	for _, t := range all {
+		if t.After(now.Add(-window)) {
+			failures = append(failures, t)
+		}
+	}
+
+	return failures
+}
+
+func newLoginFailures(failures []time.Time) *dto.LoginFailures {
+	f := &dto.LoginFailures{Count: len(failures)}
+	if len(failures) > 0 {
+		f.Oldest = failures[0]
+		f.Latest = failures[len(failures)-1]
+	}
+
+	return f
+}
@@ -0,0 +1,133 @@
+package teststore
+
+import (
+	"godmin/internal/store"
+	"sync"
+	"time"
+)
+
+// MemoryStore is the in-process store.MemoryStore.
+// Like Redis keys, entries expire at their deadline, which is checked against the clock on every read.
+type MemoryStore struct {
+	mu      sync.Mutex
+	clock   Clock
+	entries map[string]*entry
+
+	tokenRepository         *TokenRepository
+	challengeRepository     *ChallengeRepository
+	passwordResetRepository *PasswordResetRepository
+	loginAttemptRepository  *LoginAttemptRepository
+}
+
+type entry struct {
+	value interface{}
+	// expiresAt is zero for entries which never expire
+	expiresAt time.Time
+}
+
+func NewMemoryStore(clock Clock) *MemoryStore {
+	return &MemoryStore{
+		clock:   clock,
+		entries: map[string]*entry{},
+	}
+}
+
+func (s *MemoryStore) Token() store.TokenRepository {
+	if s.tokenRepository != nil {
+		return s.tokenRepository
+	}
+
+	s.tokenRepository = &TokenRepository{
+		store: s,
+	}
+
+	return s.tokenRepository
+}
+
+func (s *MemoryStore) Challenge() store.ChallengeRepository {
+	if s.challengeRepository != nil {
+		return s.challengeRepository
+	}
+
+	s.challengeRepository = &ChallengeRepository{
+		store: s,
+	}
+
+	return s.challengeRepository
+}
+
+func (s *MemoryStore) PasswordReset() store.PasswordResetRepository {
+	if s.passwordResetRepository != nil {
+		return s.passwordResetRepository
+	}
+
+	s.passwordResetRepository = &PasswordResetRepository{
+		store: s,
+	}
+
+	return s.passwordResetRepository
+}
+
+func (s *MemoryStore) LoginAttempt() store.LoginAttemptRepository {
+	if s.loginAttemptRepository != nil {
+		return s.loginAttemptRepository
+	}
+
+	s.loginAttemptRepository = &LoginAttemptRepository{
+		store: s,
+	}
+
+	return s.loginAttemptRepository
+}
+
+// get returns the value of the key, nil once it has expired.
+// The callers hold the lock, values are modified in place.
+func (s *MemoryStore) get(key string) interface{} {
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+
+	if !e.expiresAt.IsZero() && !s.clock().Before(e.expiresAt) {
+		delete(s.entries, key)
+		return nil
+	}
+
+	return e.value
+}
+
+func (s *MemoryStore) set(key string, value interface{}, expiresAt time.Time) {
+	s.entries[key] = &entry{value: value, expiresAt: expiresAt}
+}
+
+// expireAt moves the deadline of an existing key
+func (s *MemoryStore) expireAt(key string, expiresAt time.Time) {
+	if s.get(key) != nil {
+		s.entries[key].expiresAt = expiresAt
+	}
+}
+
+// del deletes the keys and returns how many of them existed
+func (s *MemoryStore) del(keys ...string) int64 {
+	var deleted int64
+	for _, key := range keys {
+		if s.get(key) != nil {
+			delete(s.entries, key)
+			deleted++
+		}
+	}
+
+	return deleted
+}
+
+// keys returns the live keys, in no particular order
+func (s *MemoryStore) keys() []string {
+	keys := make([]string, 0, len(s.entries))
+	for key := range s.entries {
+		if s.get(key) != nil {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
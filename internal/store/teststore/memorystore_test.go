@@ -0,0 +1,143 @@
+package teststore
+
+import (
+	"context"
+	"godmin/internal/dto"
+	"godmin/internal/store"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock only moves when told to
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func testToken(familyID string, suffix string, now time.Time) *dto.Token {
+	return &dto.Token{
+		AccessUuid:          "access-" + suffix,
+		RefreshUuid:         "refresh-" + suffix,
+		FamilyID:            familyID,
+		AccessTokenExpires:  now.Add(15 * time.Minute).Unix(),
+		RefreshTokenExpires: now.Add(24 * time.Hour).Unix(),
+	}
+}
+
+func TestTokenRepository_Expiry(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	tokens := NewMemoryStore(clock.Now).Token()
+
+	if err := tokens.Create(ctx, 1, testToken("f", "1", clock.now), &dto.Client{IP: "127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	userId, err := tokens.Find(ctx, "access-1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), userId)
+
+	// the access token expires first, the session lives as long as the refresh token
+	clock.now = clock.now.Add(time.Hour)
+	_, err = tokens.Find(ctx, "access-1")
+	assert.Equal(t, store.ErrRecordNotFound, err)
+
+	families, _ := tokens.FindUserFamilies(ctx, 1)
+	assert.Len(t, families, 1)
+
+	clock.now = clock.now.Add(24 * time.Hour)
+	_, err = tokens.FindFamily(ctx, "f")
+	assert.Equal(t, store.ErrRecordNotFound, err)
+
+	families, _ = tokens.FindUserFamilies(ctx, 1)
+	assert.Empty(t, families)
+}
+
+func TestTokenRepository_Rotate(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	tokens := NewMemoryStore(clock.Now).Token()
+
+	if err := tokens.Create(ctx, 1, testToken("f", "1", clock.now), &dto.Client{IP: "127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, tokens.Rotate(ctx, "f", "refresh-1", testToken("f", "2", clock.now)))
+	assert.Equal(t, store.ErrTokenReused, tokens.Rotate(ctx, "f", "refresh-1", testToken("f", "3", clock.now)))
+
+	f, err := tokens.FindFamily(ctx, "f")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "refresh-2", f.RefreshUuid)
+		assert.Equal(t, "127.0.0.1", f.IP)
+	}
+
+	_, err = tokens.Find(ctx, "access-1")
+	assert.Equal(t, store.ErrRecordNotFound, err)
+
+	revoked, err := tokens.RevokeAll(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, revoked)
+
+	_, err = tokens.Find(ctx, "access-2")
+	assert.Equal(t, store.ErrRecordNotFound, err)
+}
+
+func TestChallengeRepository_Fail(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	challenges := NewMemoryStore(clock.Now).Challenge()
+
+	id, _ := challenges.Create(ctx, 1, time.Minute)
+	assert.NoError(t, challenges.Fail(ctx, id, 2))
+
+	userId, err := challenges.Find(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), userId)
+
+	assert.NoError(t, challenges.Fail(ctx, id, 2))
+	_, err = challenges.Find(ctx, id)
+	assert.Equal(t, store.ErrRecordNotFound, err)
+
+	id, _ = challenges.Create(ctx, 1, time.Minute)
+	clock.now = clock.now.Add(time.Minute)
+	_, err = challenges.Find(ctx, id)
+	assert.Equal(t, store.ErrRecordNotFound, err)
+}
+
+func TestLoginAttemptRepository_SlidingWindow(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	attempts := NewMemoryStore(clock.Now).LoginAttempt()
+	first := clock.now
+
+	for i := 0; i < 3; i++ {
+		if _, err := attempts.Fail(ctx, "email:a", 10*time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		clock.now = clock.now.Add(4 * time.Minute)
+	}
+
+	// the first failure has left the window
+	failures, err := attempts.Failures(ctx, "email:a", 10*time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, failures.Count)
+	assert.Equal(t, first.Add(4*time.Minute), failures.Oldest)
+	assert.Equal(t, first.Add(8*time.Minute), failures.Latest)
+
+	assert.NoError(t, attempts.Reset(ctx, "email:a"))
+	failures, _ = attempts.Failures(ctx, "email:a", 10*time.Minute)
+	assert.Equal(t, 0, failures.Count)
+
+	assert.NoError(t, attempts.Lock(ctx, "email:a", time.Minute))
+	locked, _ := attempts.LockedFor(ctx, "email:a")
+	assert.Equal(t, time.Minute, locked)
+
+	clock.now = clock.now.Add(time.Minute)
+	locked, _ = attempts.LockedFor(ctx, "email:a")
+	assert.Zero(t, locked)
+}
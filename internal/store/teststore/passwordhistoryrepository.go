@@ -0,0 +1,40 @@
+package teststore
+
+import "context"
+
+type PasswordHistoryRepository struct {
+	store *Store
+}
+
+// Add records a former password hash of the user and keeps only the keep latest ones
+func (r *PasswordHistoryRepository) Add(ctx context.Context, userID uint64, encryptedPassword string, keep int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.addPasswordHistory(userID, encryptedPassword, keep)
+
+	return nil
+}
+
+// FindByUser returns the latest former password hashes of the user, the latest first
+func (r *PasswordHistoryRepository) FindByUser(ctx context.Context, userID uint64, limit int) ([]string, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	history := r.store.passwordHistory[userID]
+	if len(history) > limit {
+		history = history[:limit]
+	}
+
+	return append([]string{}, history...), nil
+}
+
+// addPasswordHistory adds the hash to the history of the user, the caller holds the lock
+func (s *Store) addPasswordHistory(userID uint64, encryptedPassword string, keep int) {
+	// the latest first
+	history := append([]string{encryptedPassword}, s.passwordHistory[userID]...)
+	if len(history) > keep {
+		history = history[:keep]
+	}
+	s.passwordHistory[userID] = history
+}
@@ -0,0 +1,69 @@
+package teststore
+
+import (
+	"context"
+	"godmin/internal/store"
+	"strconv"
+	"time"
+)
+
+const (
+	passwordResetKeyPrefix     = "password_reset:"
+	userPasswordResetKeyPrefix = "user_password_reset:"
+)
+
+// PasswordResetRepository keeps the hashes of the password reset tokens
+type PasswordResetRepository struct {
+	store *MemoryStore
+}
+
+// Create stores the token hash of the user, the previous token of the user stops working
+func (r *PasswordResetRepository) Create(ctx context.Context, userId uint64, tokenHash string, ttl time.Duration) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if previous, ok := r.store.get(userPasswordResetKey(userId)).(string); ok {
+		r.store.del(passwordResetKeyPrefix + previous)
+	}
+
+	expiresAt := r.store.clock().Add(ttl)
+	r.store.set(passwordResetKeyPrefix+tokenHash, userId, expiresAt)
+	r.store.set(userPasswordResetKey(userId), tokenHash, expiresAt)
+
+	return nil
+}
+
+// Find returns the id of the user of the token without using it
+func (r *PasswordResetRepository) Find(ctx context.Context, tokenHash string) (uint64, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	userId, ok := r.store.get(passwordResetKeyPrefix + tokenHash).(uint64)
+	if !ok {
+		return 0, store.ErrRecordNotFound
+	}
+
+	return userId, nil
+}
+
+// Consume deletes the token and returns the id of its user
+func (r *PasswordResetRepository) Consume(ctx context.Context, tokenHash string) (uint64, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	userId, ok := r.store.get(passwordResetKeyPrefix + tokenHash).(uint64)
+	if !ok {
+		return 0, store.ErrRecordNotFound
+	}
+
+	r.store.del(passwordResetKeyPrefix + tokenHash)
+	if current, _ := r.store.get(userPasswordResetKey(userId)).(string); current == tokenHash {
+		r.store.del(userPasswordResetKey(userId))
+	}
+
+	return userId, nil
+}
+
+func userPasswordResetKey(userId uint64) string {
+	return userPasswordResetKeyPrefix + strconv.FormatUint(userId, 10)
+}
@@ -0,0 +1,45 @@
+package teststore
+
+import "context"
+
+type RecoveryCodeRepository struct {
+	store *Store
+}
+
+// Replace drops the user's recovery codes and stores the new ones
+func (r *RecoveryCodeRepository) Replace(ctx context.Context, userID uint64, hashes []string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	// the value tells whether the code was used
+	codes := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		codes[hash] = false
+	}
+	r.store.recoveryCodes[userID] = codes
+
+	return nil
+}
+
+// Use marks the code as used, it returns false if there is no such unused code
+func (r *RecoveryCodeRepository) Use(ctx context.Context, userID uint64, hash string) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	used, ok := r.store.recoveryCodes[userID][hash]
+	if !ok || used {
+		return false, nil
+	}
+	r.store.recoveryCodes[userID][hash] = true
+
+	return true, nil
+}
+
+func (r *RecoveryCodeRepository) DeleteByUser(ctx context.Context, userID uint64) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	delete(r.store.recoveryCodes, userID)
+
+	return nil
+}
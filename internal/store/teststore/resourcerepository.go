@@ -0,0 +1,156 @@
+package teststore
+
+import (
+	"context"
+	"fmt"
+	"godmin/internal/model"
+	"godmin/internal/store"
+	"godmin/internal/store/query"
+)
+
+// CatalogRepository describes no tables, there is nothing to introspect in process
+type CatalogRepository struct{}
+
+func (r *CatalogRepository) Tables(ctx context.Context, schema string) ([]*model.Table, error) {
+	return []*model.Table{}, nil
+}
+
+// table holds the rows of a resource table in the insertion order
+type table struct {
+	rows   []map[string]interface{}
+	serial int64
+}
+
+// ResourceRepository is a generic repository of a table, rows are maps of the column values
+type ResourceRepository struct {
+	store   *Store
+	schema  *query.Schema
+	columns []string
+}
+
+// List returns a page of rows matching the query
+func (r *ResourceRepository) List(ctx context.Context, q *query.Query) ([]map[string]interface{}, *query.Page, error) {
+	r.store.mu.Lock()
+	t := r.table()
+	items := make([]map[string]interface{}, 0, len(t.rows))
+	for _, row := range t.rows {
+		items = append(items, r.project(row))
+	}
+	r.store.mu.Unlock()
+
+	key := func(i int, column string) interface{} {
+		return items[i][column]
+	}
+
+	q.Select(&items, key)
+	page := q.Paginate(&items, key)
+
+	return items, page, nil
+}
+
+func (r *ResourceRepository) Find(ctx context.Context, id interface{}) (map[string]interface{}, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	i := r.find(id)
+	if i < 0 {
+		return nil, store.ErrRecordNotFound
+	}
+
+	return r.project(r.table().rows[i]), nil
+}
+
+// Create inserts the values and returns the created row, an integer primary key is generated when missing
+func (r *ResourceRepository) Create(ctx context.Context, values map[string]interface{}) (map[string]interface{}, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	t := r.table()
+	row := make(map[string]interface{}, len(values)+1)
+	for k, v := range values {
+		row[k] = v
+	}
+
+	if _, ok := row[r.schema.PrimaryKey]; !ok {
+		if pk, _ := r.schema.Column(r.schema.PrimaryKey); pk != nil && pk.Type == query.TypeInt {
+			t.serial++
+			row[r.schema.PrimaryKey] = t.serial
+		}
+	}
+	if r.find(row[r.schema.PrimaryKey]) >= 0 {
+		return nil, fmt.Errorf("%w: duplicate key value violates the primary key of %s", store.ErrConstraintViolation, r.schema.Table)
+	}
+
+	t.rows = append(t.rows, row)
+
+	return r.project(row), nil
+}
+
+// Update applies the values and returns the updated row
+func (r *ResourceRepository) Update(
+	ctx context.Context,
+	id interface{},
+	values map[string]interface{},
+) (map[string]interface{}, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	i := r.find(id)
+	if i < 0 {
+		return nil, store.ErrRecordNotFound
+	}
+
+	row := r.table().rows[i]
+	for k, v := range values {
+		row[k] = v
+	}
+
+	return r.project(row), nil
+}
+
+func (r *ResourceRepository) Delete(ctx context.Context, id interface{}) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	i := r.find(id)
+	if i < 0 {
+		return store.ErrRecordNotFound
+	}
+
+	t := r.table()
+	t.rows = append(t.rows[:i], t.rows[i+1:]...)
+
+	return nil
+}
+
+func (r *ResourceRepository) table() *table {
+	t, ok := r.store.tables[r.schema.Table]
+	if !ok {
+		t = &table{}
+		r.store.tables[r.schema.Table] = t
+	}
+
+	return t
+}
+
+// find returns the index of the row, -1 if there is none.
+// Keys are compared by their text, so an int64 id parsed from the path matches any integer type.
+func (r *ResourceRepository) find(id interface{}) int {
+	for i, row := range r.table().rows {
+		if fmt.Sprint(row[r.schema.PrimaryKey]) == fmt.Sprint(id) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// project copies the selected columns of the row, missing columns are NULL
+func (r *ResourceRepository) project(row map[string]interface{}) map[string]interface{} {
+	item := make(map[string]interface{}, len(r.columns))
+	for _, c := range r.columns {
+		item[c] = row[c]
+	}
+
+	return item
+}
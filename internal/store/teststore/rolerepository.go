@@ -0,0 +1,138 @@
+package teststore
+
+import (
+	"context"
+	"godmin/internal/model"
+	"godmin/internal/store"
+	"sort"
+)
+
+type RoleRepository struct {
+	store *Store
+}
+
+// FindAll returns every role with its permissions
+func (r *RoleRepository) FindAll(ctx context.Context) ([]*model.Role, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	roles := make([]*model.Role, 0, len(r.store.roles))
+	for _, role := range r.store.roles {
+		c := *role
+		c.Permissions = append([]string{}, role.Permissions...)
+		sort.Strings(c.Permissions)
+
+		roles = append(roles, &c)
+	}
+
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].Name < roles[j].Name
+	})
+
+	return roles, nil
+}
+
+// FindNamesByUser returns the names of the roles granted to the user
+func (r *RoleRepository) FindNamesByUser(ctx context.Context, userID uint64) ([]string, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	names := make([]string, 0)
+	for name := range r.store.userRoles[userID] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// FindPermissionsByUser returns the permissions the user has through any of their roles
+func (r *RoleRepository) FindPermissionsByUser(ctx context.Context, userID uint64) ([]string, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	seen := map[string]bool{}
+	permissions := make([]string, 0)
+	for name := range r.store.userRoles[userID] {
+		for _, p := range r.findRole(name).Permissions {
+			if !seen[p] {
+				seen[p] = true
+				permissions = append(permissions, p)
+			}
+		}
+	}
+	sort.Strings(permissions)
+
+	return permissions, nil
+}
+
+// Grant grants the role to the user, it returns store.ErrRecordNotFound if there is no such role
+func (r *RoleRepository) Grant(ctx context.Context, userID uint64, roleName string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if r.findRole(roleName) == nil {
+		return store.ErrRecordNotFound
+	}
+
+	if r.store.userRoles[userID] == nil {
+		r.store.userRoles[userID] = map[string]bool{}
+	}
+	r.store.userRoles[userID][roleName] = true
+
+	return nil
+}
+
+// Revoke revokes the role from the user, it returns store.ErrRecordNotFound if the user doesn't have it
+func (r *RoleRepository) Revoke(ctx context.Context, userID uint64, roleName string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if !r.store.userRoles[userID][roleName] {
+		return store.ErrRecordNotFound
+	}
+	delete(r.store.userRoles[userID], roleName)
+
+	return nil
+}
+
+// FindAllPermissions returns the names of every permission, granted to a role or not
+func (r *RoleRepository) FindAllPermissions(ctx context.Context) ([]string, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	permissions := make([]string, 0, len(r.store.permissions))
+	for name := range r.store.permissions {
+		permissions = append(permissions, name)
+	}
+	sort.Strings(permissions)
+
+	return permissions, nil
+}
+
+// CreatePermission creates the permission unless it exists, a new permission is granted to the role
+func (r *RoleRepository) CreatePermission(ctx context.Context, name string, description string, roleName string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.permissions[name]; ok {
+		return nil
+	}
+	r.store.permissions[name] = description
+
+	if role := r.findRole(roleName); role != nil {
+		role.Permissions = append(role.Permissions, name)
+	}
+
+	return nil
+}
+
+func (r *RoleRepository) findRole(name string) *model.Role {
+	for _, role := range r.store.roles {
+		if role.Name == name {
+			return role
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,194 @@
+// Package teststore implements the store interfaces in process, so the server runs without Postgres and Redis,
+// e.g. in the HTTP tests. Data lives as long as the store.
+package teststore
+
+import (
+	"godmin/internal/model"
+	"godmin/internal/password"
+	"godmin/internal/store"
+	"godmin/internal/store/query"
+	"sync"
+	"time"
+)
+
+// Clock tells the current time, tests inject a fake one to expire entries without waiting
+type Clock func() time.Time
+
+// Store is the in-process store.Store, seeded with what the migrations insert
+type Store struct {
+	mu     sync.Mutex
+	clock  Clock
+	hasher *password.Hasher
+
+	lastID        uint64
+	users         map[uint64]*model.User
+	totp          map[uint64]*model.TOTP
+	recoveryCodes map[uint64]map[string]bool
+	// passwordHistory keeps the former hashes of the users, the latest first
+	passwordHistory map[uint64][]string
+	apiKeys         map[uint64]*model.ApiKey
+	permissions     map[string]string
+	roles           []*model.Role
+	userRoles       map[uint64]map[string]bool
+	tables          map[string]*table
+	auditEvents     []*model.AuditEvent
+
+	userRepository            *UserRepository
+	totpRepository            *TOTPRepository
+	recoveryCodeRepository    *RecoveryCodeRepository
+	passwordHistoryRepository *PasswordHistoryRepository
+	apiKeyRepository          *ApiKeyRepository
+	roleRepository            *RoleRepository
+	catalogRepository         *CatalogRepository
+	auditRepository           *AuditRepository
+}
+
+// New builds the seeded store, the user passwords are hashed with the hasher
+func New(clock Clock, hasher *password.Hasher) *Store {
+	return &Store{
+		clock:           clock,
+		hasher:          hasher,
+		users:           map[uint64]*model.User{},
+		totp:            map[uint64]*model.TOTP{},
+		recoveryCodes:   map[uint64]map[string]bool{},
+		passwordHistory: map[uint64][]string{},
+		apiKeys:         map[uint64]*model.ApiKey{},
+		permissions: map[string]string{
+			model.PermissionUsersRead:     "List and view users",
+			model.PermissionUsersWrite:    "Create, update and delete users",
+			model.PermissionRolesRead:     "List roles and their permissions",
+			model.PermissionRolesWrite:    "Grant and revoke user roles",
+			model.PermissionSessionsWrite: "Revoke sessions of any user",
+			model.PermissionAuditRead:     "Browse the audit log",
+			model.PermissionResourcesRead: "Describe the registered resources",
+		},
+		roles: []*model.Role{
+			{
+				ID:          1,
+				Name:        model.RoleAdmin,
+				Description: "Full access to the admin panel",
+				Permissions: []string{
+					model.PermissionAuditRead,
+					model.PermissionResourcesRead,
+					model.PermissionRolesRead,
+					model.PermissionRolesWrite,
+					model.PermissionSessionsWrite,
+					model.PermissionUsersRead,
+					model.PermissionUsersWrite,
+				},
+			},
+		},
+		userRoles: map[uint64]map[string]bool{},
+		tables:    map[string]*table{},
+	}
+}
+
+func (s *Store) User() store.UserRepository {
+	if s.userRepository != nil {
+		return s.userRepository
+	}
+
+	s.userRepository = &UserRepository{
+		store: s,
+	}
+
+	return s.userRepository
+}
+
+func (s *Store) PasswordHistory() store.PasswordHistoryRepository {
+	if s.passwordHistoryRepository != nil {
+		return s.passwordHistoryRepository
+	}
+
+	s.passwordHistoryRepository = &PasswordHistoryRepository{
+		store: s,
+	}
+
+	return s.passwordHistoryRepository
+}
+
+func (s *Store) TOTP() store.TOTPRepository {
+	if s.totpRepository != nil {
+		return s.totpRepository
+	}
+
+	s.totpRepository = &TOTPRepository{
+		store: s,
+	}
+
+	return s.totpRepository
+}
+
+func (s *Store) RecoveryCode() store.RecoveryCodeRepository {
+	if s.recoveryCodeRepository != nil {
+		return s.recoveryCodeRepository
+	}
+
+	s.recoveryCodeRepository = &RecoveryCodeRepository{
+		store: s,
+	}
+
+	return s.recoveryCodeRepository
+}
+
+func (s *Store) ApiKey() store.ApiKeyRepository {
+	if s.apiKeyRepository != nil {
+		return s.apiKeyRepository
+	}
+
+	s.apiKeyRepository = &ApiKeyRepository{
+		store: s,
+	}
+
+	return s.apiKeyRepository
+}
+
+func (s *Store) Role() store.RoleRepository {
+	if s.roleRepository != nil {
+		return s.roleRepository
+	}
+
+	s.roleRepository = &RoleRepository{
+		store: s,
+	}
+
+	return s.roleRepository
+}
+
+func (s *Store) Catalog() store.CatalogRepository {
+	if s.catalogRepository != nil {
+		return s.catalogRepository
+	}
+
+	s.catalogRepository = &CatalogRepository{}
+
+	return s.catalogRepository
+}
+
+func (s *Store) Audit() store.AuditRepository {
+	if s.auditRepository != nil {
+		return s.auditRepository
+	}
+
+	s.auditRepository = &AuditRepository{
+		store: s,
+	}
+
+	return s.auditRepository
+}
+
+// Resource returns a generic repository of the schema table, the table is created on first use
+func (s *Store) Resource(schema *query.Schema, columns []string) store.ResourceRepository {
+	return &ResourceRepository{
+		store:   s,
+		schema:  schema,
+		columns: columns,
+	}
+}
+
+// nextID plays the role of the BIGSERIAL sequences
+func (s *Store) nextID() uint64 {
+	s.lastID++
+
+	return s.lastID
+}
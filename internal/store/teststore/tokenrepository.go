@@ -0,0 +1,246 @@
+package teststore
+
+import (
+	"context"
+	"godmin/internal/dto"
+	"godmin/internal/store"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	familyKeyPrefix       = "token_family:"
+	userSessionsKeyPrefix = "user_sessions:"
+)
+
+// TokenRepository keeps the tokens the way memorystore lays them out in Redis:
+// the access and refresh uuids hold the user id, a family holds the session and an index lists the user's families
+type TokenRepository struct {
+	store *MemoryStore
+}
+
+func (r *TokenRepository) Create(ctx context.Context, userId uint64, t *dto.Token, c *dto.Client) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	f := r.setToken(userId, t)
+	f.CreatedAt = time.Unix(r.store.clock().Unix(), 0)
+	f.IP = c.IP
+	f.UserAgent = c.UserAgent
+
+	return nil
+}
+
+func (r *TokenRepository) Find(ctx context.Context, accessUuid string) (uint64, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	userId, ok := r.store.get(accessUuid).(uint64)
+	if !ok {
+		return 0, store.ErrRecordNotFound
+	}
+
+	return userId, nil
+}
+
+func (r *TokenRepository) Delete(ctx context.Context, accessUuid string) (int64, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	return r.store.del(accessUuid), nil
+}
+
+// FindFamily returns the current state of the token family
+func (r *TokenRepository) FindFamily(ctx context.Context, familyID string) (*dto.TokenFamily, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	f := r.family(familyID)
+	if f == nil {
+		return nil, store.ErrRecordNotFound
+	}
+
+	c := *f
+
+	return &c, nil
+}
+
+// FindUserFamilies returns the active token families (sessions) of the user, the most recent first
+func (r *TokenRepository) FindUserFamilies(ctx context.Context, userId uint64) ([]*dto.TokenFamily, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	families := r.userFamilies(userId)
+	for i, f := range families {
+		c := *f
+		families[i] = &c
+	}
+
+	return families, nil
+}
+
+// Touch records the family has just been used, a revoked family is left alone
+func (r *TokenRepository) Touch(ctx context.Context, familyID string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if f := r.family(familyID); f != nil {
+		f.LastSeenAt = time.Unix(r.store.clock().Unix(), 0)
+	}
+
+	return nil
+}
+
+// Rotate replaces the family's current token pair with the next one.
+// It returns store.ErrTokenReused if refreshUuid is not the latest refresh token of the family.
+func (r *TokenRepository) Rotate(ctx context.Context, familyID string, refreshUuid string, next *dto.Token) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	f := r.family(familyID)
+	if f == nil {
+		return store.ErrRecordNotFound
+	}
+
+	if f.RefreshUuid != refreshUuid {
+		return store.ErrTokenReused
+	}
+
+	r.store.del(f.AccessUuid, f.RefreshUuid)
+	r.setToken(f.UserID, next)
+
+	return nil
+}
+
+// RevokeFamily deletes the family together with its current access and refresh tokens
+func (r *TokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	f := r.family(familyID)
+	if f == nil {
+		return store.ErrRecordNotFound
+	}
+
+	r.revokeFamily(f)
+
+	return nil
+}
+
+// RevokeUserFamilies deletes every token family of the user and returns how many were revoked
+func (r *TokenRepository) RevokeUserFamilies(ctx context.Context, userId uint64) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	families := r.userFamilies(userId)
+	for _, f := range families {
+		r.revokeFamily(f)
+	}
+	r.store.del(userSessionsKey(userId))
+
+	return len(families), nil
+}
+
+// RevokeAll deletes every token family of every user and returns how many were revoked
+func (r *TokenRepository) RevokeAll(ctx context.Context) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	revoked := 0
+	for _, key := range r.store.keys() {
+		if !strings.HasPrefix(key, familyKeyPrefix) {
+			continue
+		}
+
+		if f := r.family(strings.TrimPrefix(key, familyKeyPrefix)); f != nil {
+			r.revokeFamily(f)
+			revoked++
+		}
+	}
+
+	// drop the indexes of the families which expired on their own
+	for _, key := range r.store.keys() {
+		if strings.HasPrefix(key, userSessionsKeyPrefix) {
+			r.store.del(key)
+		}
+	}
+
+	return revoked, nil
+}
+
+// setToken stores the token pair and points the family to it, the family lives as long as the refresh token
+func (r *TokenRepository) setToken(userId uint64, t *dto.Token) *dto.TokenFamily {
+	at := time.Unix(t.AccessTokenExpires, 0)
+	rt := time.Unix(t.RefreshTokenExpires, 0)
+
+	r.store.set(t.AccessUuid, userId, at)
+	r.store.set(t.RefreshUuid, userId, rt)
+
+	f := r.family(t.FamilyID)
+	if f == nil {
+		f = &dto.TokenFamily{ID: t.FamilyID}
+		r.store.set(familyKey(t.FamilyID), f, rt)
+	}
+	f.UserID = userId
+	f.AccessUuid = t.AccessUuid
+	f.RefreshUuid = t.RefreshUuid
+	f.LastSeenAt = time.Unix(r.store.clock().Unix(), 0)
+	r.store.expireAt(familyKey(t.FamilyID), rt)
+
+	// the index lives as long as the most recently refreshed family
+	sessions, ok := r.store.get(userSessionsKey(userId)).(map[string]bool)
+	if !ok {
+		sessions = map[string]bool{}
+		r.store.set(userSessionsKey(userId), sessions, rt)
+	}
+	sessions[t.FamilyID] = true
+	r.store.expireAt(userSessionsKey(userId), rt)
+
+	return f
+}
+
+func (r *TokenRepository) revokeFamily(f *dto.TokenFamily) {
+	r.store.del(f.AccessUuid, f.RefreshUuid, familyKey(f.ID))
+
+	if sessions, ok := r.store.get(userSessionsKey(f.UserID)).(map[string]bool); ok {
+		delete(sessions, f.ID)
+	}
+}
+
+func (r *TokenRepository) family(familyID string) *dto.TokenFamily {
+	f, _ := r.store.get(familyKey(familyID)).(*dto.TokenFamily)
+
+	return f
+}
+
+// userFamilies returns the live families of the user, the expired ones are dropped from the index
+func (r *TokenRepository) userFamilies(userId uint64) []*dto.TokenFamily {
+	sessions, _ := r.store.get(userSessionsKey(userId)).(map[string]bool)
+
+	families := make([]*dto.TokenFamily, 0, len(sessions))
+	for id := range sessions {
+		f := r.family(id)
+		if f == nil {
+			delete(sessions, id)
+			continue
+		}
+
+		families = append(families, f)
+	}
+
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].CreatedAt.After(families[j].CreatedAt)
+	})
+
+	return families
+}
+
+func familyKey(familyID string) string {
+	return familyKeyPrefix + familyID
+}
+
+func userSessionsKey(userId uint64) string {
+	return userSessionsKeyPrefix + strconv.FormatUint(userId, 10)
+}
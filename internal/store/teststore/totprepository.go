@@ -0,0 +1,76 @@
+package teststore
+
+import (
+	"context"
+	"godmin/internal/model"
+	"godmin/internal/store"
+)
+
+type TOTPRepository struct {
+	store *Store
+}
+
+func (r *TOTPRepository) FindByUser(ctx context.Context, userID uint64) (*model.TOTP, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	t, ok := r.store.totp[userID]
+	if !ok {
+		return nil, store.ErrRecordNotFound
+	}
+
+	c := *t
+
+	return &c, nil
+}
+
+// Enroll stores a new unconfirmed secret.
+// A confirmed enrollment is never replaced, false is returned in that case.
+func (r *TOTPRepository) Enroll(ctx context.Context, t *model.TOTP) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if existing, ok := r.store.totp[t.UserID]; ok && existing.Enabled() {
+		return false, nil
+	}
+
+	r.store.totp[t.UserID] = &model.TOTP{UserID: t.UserID, Secret: t.Secret}
+
+	return true, nil
+}
+
+func (r *TOTPRepository) Confirm(ctx context.Context, userID uint64) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if t, ok := r.store.totp[userID]; ok {
+		now := r.store.clock()
+		t.ConfirmedAt = &now
+	}
+
+	return nil
+}
+
+// UseStep marks the time step as used. It returns false when the step or a later one was already used,
+// so every code is accepted only once.
+func (r *TOTPRepository) UseStep(ctx context.Context, userID uint64, step int64) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	t, ok := r.store.totp[userID]
+	if !ok || t.LastUsedStep >= step {
+		return false, nil
+	}
+	t.LastUsedStep = step
+
+	return true, nil
+}
+
+func (r *TOTPRepository) Delete(ctx context.Context, userID uint64) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	delete(r.store.totp, userID)
+
+	return nil
+}
@@ -0,0 +1,225 @@
+package teststore
+
+import (
+	"context"
+	"godmin/internal/model"
+	"godmin/internal/store"
+	"godmin/internal/store/query"
+	"sort"
+	"time"
+)
+
+type UserRepository struct {
+	store *Store
+}
+
+func (r *UserRepository) Create(ctx context.Context, u *model.User) error {
+	if err := u.BeforeCreate(r.store.hasher); err != nil {
+		return err
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if r.findByEmail(u.Email) != nil {
+		return store.ErrEmailUsed
+	}
+
+	u.ID = r.store.nextID()
+	r.store.users[u.ID] = &model.User{
+		ID:                u.ID,
+		Name:              u.Name,
+		Email:             u.Email,
+		EncryptedPassword: u.EncryptedPassword,
+		EmailVerifiedAt:   copyTime(u.EmailVerifiedAt),
+	}
+
+	return nil
+}
+
+// List returns a page of users matching the query
+func (r *UserRepository) List(ctx context.Context, q *query.Query) ([]*model.User, *query.Page, error) {
+	r.store.mu.Lock()
+	users := make([]*model.User, 0, len(r.store.users))
+	for _, u := range r.store.users {
+		users = append(users, copyUser(u))
+	}
+	r.store.mu.Unlock()
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+
+	key := func(i int, column string) interface{} {
+		switch column {
+		case "name":
+			return users[i].Name
+		case "email":
+			return users[i].Email
+		case "disabled_at":
+			return users[i].DisabledAt
+		case "email_verified_at":
+			return users[i].EmailVerifiedAt
+		default:
+			return users[i].ID
+		}
+	}
+
+	q.Select(&users, key)
+	page := q.Paginate(&users, key)
+
+	return users, page, nil
+}
+
+func (r *UserRepository) Find(ctx context.Context, id uint64) (*model.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	u, ok := r.store.users[id]
+	if !ok {
+		return nil, store.ErrRecordNotFound
+	}
+
+	return copyUser(u), nil
+}
+
+func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*model.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	u := r.findByEmail(email)
+	if u == nil {
+		return nil, store.ErrRecordNotFound
+	}
+
+	return copyUser(u), nil
+}
+
+// Update applies the changes and returns the updated user
+func (r *UserRepository) Update(ctx context.Context, id uint64, c *model.UserChanges) (*model.User, error) {
+	if err := c.BeforeUpdate(r.store.hasher); err != nil {
+		return nil, err
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	u, ok := r.store.users[id]
+	if !ok {
+		return nil, store.ErrRecordNotFound
+	}
+	if c.Email != nil {
+		if other := r.findByEmail(*c.Email); other != nil && other.ID != id {
+			return nil, store.ErrEmailUsed
+		}
+	}
+
+	if c.Name != nil {
+		u.Name = *c.Name
+	}
+	if c.Email != nil && *c.Email != u.Email {
+		u.Email = *c.Email
+		u.EmailVerifiedAt = nil
+	}
+	if c.EmailVerified && u.EmailVerifiedAt == nil {
+		now := r.store.clock()
+		u.EmailVerifiedAt = &now
+	}
+	if c.EncryptedPassword != nil {
+		if c.KeepPasswords > 0 {
+			r.store.addPasswordHistory(id, u.EncryptedPassword, c.KeepPasswords)
+		}
+		u.EncryptedPassword = *c.EncryptedPassword
+	}
+
+	return copyUser(u), nil
+}
+
+// VerifyEmail marks the email of the user verified, it returns ErrRecordNotFound if the user has another email now
+func (r *UserRepository) VerifyEmail(ctx context.Context, id uint64, email string) (*model.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	u, ok := r.store.users[id]
+	if !ok || u.Email != email {
+		return nil, store.ErrRecordNotFound
+	}
+
+	if u.EmailVerifiedAt == nil {
+		now := r.store.clock()
+		u.EmailVerifiedAt = &now
+	}
+
+	return copyUser(u), nil
+}
+
+// SetDisabled disables the user or enables it again, the time of the first disabling is kept
+func (r *UserRepository) SetDisabled(ctx context.Context, id uint64, disabled bool) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	u, ok := r.store.users[id]
+	if !ok {
+		return store.ErrRecordNotFound
+	}
+
+	switch {
+	case !disabled:
+		u.DisabledAt = nil
+	case u.DisabledAt == nil:
+		now := r.store.clock()
+		u.DisabledAt = &now
+	}
+
+	return nil
+}
+
+// Delete removes the user together with the rows referencing it, as the foreign keys cascade
+func (r *UserRepository) Delete(ctx context.Context, u *model.User) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[u.ID]; !ok {
+		return store.ErrRecordNotFound
+	}
+
+	delete(r.store.users, u.ID)
+	delete(r.store.totp, u.ID)
+	delete(r.store.recoveryCodes, u.ID)
+	delete(r.store.passwordHistory, u.ID)
+	delete(r.store.userRoles, u.ID)
+	for id, k := range r.store.apiKeys {
+		if k.UserID == u.ID {
+			delete(r.store.apiKeys, id)
+		}
+	}
+
+	return nil
+}
+
+func (r *UserRepository) findByEmail(email string) *model.User {
+	for _, u := range r.store.users {
+		if u.Email == email {
+			return u
+		}
+	}
+
+	return nil
+}
+
+func copyUser(u *model.User) *model.User {
+	c := *u
+	c.DisabledAt = copyTime(u.DisabledAt)
+	c.EmailVerifiedAt = copyTime(u.EmailVerifiedAt)
+
+	return &c
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	c := *t
+	return &c
+}
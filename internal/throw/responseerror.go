@@ -13,6 +13,13 @@ func (e *ResponseError) Error() string {
 	return fmt.Sprintf("status %d: err %v", e.statusCode, e.err)
 }
 
+func NewResponseError(statusCode int, err error) *ResponseError {
+	return &ResponseError{
+		statusCode: statusCode,
+		err:        err,
+	}
+}
+
 func NewJWTError(statusCode int, err error) *ResponseError {
 	return &ResponseError{
 		statusCode: statusCode,
@@ -0,0 +1,28 @@
+package throw
+
+import "time"
+
+// RetryAfterError tells the client when it may try again, the response gets a Retry-After header
+type RetryAfterError struct {
+	retryAfter time.Duration
+	err        error
+}
+
+func NewRetryAfterError(retryAfter time.Duration, err error) *RetryAfterError {
+	return &RetryAfterError{
+		retryAfter: retryAfter,
+		err:        err,
+	}
+}
+
+func (e *RetryAfterError) Error() string {
+	return e.err.Error()
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.err
+}
+
+func (e *RetryAfterError) GetRetryAfter() time.Duration {
+	return e.retryAfter
+}
@@ -0,0 +1,26 @@
+package throw
+
+// TypedError gives the error a problem type, so clients can tell it from the other errors of the same status
+type TypedError struct {
+	problemType string
+	err         error
+}
+
+func NewTypedError(problemType string, err error) *TypedError {
+	return &TypedError{
+		problemType: problemType,
+		err:         err,
+	}
+}
+
+func (e *TypedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *TypedError) Unwrap() error {
+	return e.err
+}
+
+func (e *TypedError) GetProblemType() string {
+	return e.problemType
+}
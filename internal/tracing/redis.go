@@ -0,0 +1,83 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-redis/redis/v7"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RedisHook traces the commands and pipelines of a go-redis client, the spans are children of the span
+// of the context of the client. The arguments aren't recorded, they hold tokens.
+// The OpenTelemetry instrumentation of go-redis starts at v8, this is the part of it v7 needs.
+type RedisHook struct{}
+
+var _ redis.Hook = RedisHook{}
+
+func (RedisHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	operation := strings.ToUpper(cmd.Name())
+
+	ctx, _ = startRedis(ctx, "redis "+operation, semconv.DBOperationKey.String(operation))
+
+	return ctx, nil
+}
+
+func (RedisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	endRedis(trace.SpanFromContext(ctx), cmd.Err())
+
+	return nil
+}
+
+func (RedisHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	operations := make([]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		operations = append(operations, strings.ToUpper(cmd.Name()))
+	}
+
+	ctx, _ = startRedis(
+		ctx,
+		"redis pipeline",
+		semconv.DBOperationKey.String(strings.Join(operations, " ")),
+		attribute.Int("db.redis.commands", len(cmds)),
+	)
+
+	return ctx, nil
+}
+
+func (RedisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmd.Err() != nil && cmd.Err() != redis.Nil {
+			err = cmd.Err()
+			break
+		}
+	}
+	endRedis(trace.SpanFromContext(ctx), err)
+
+	return nil
+}
+
+// startRedis takes the tracer of the global provider on every command, the client is made once
+func startRedis(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(
+		ctx,
+		name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemRedis),
+		trace.WithAttributes(attributes...),
+	)
+}
+
+// endRedis doesn't fail the span on redis.Nil, a missing key is an answer
+func endRedis(span trace.Span, err error) {
+	if err != nil && err != redis.Nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
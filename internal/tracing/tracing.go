@@ -0,0 +1,144 @@
+// Package tracing sets up the OpenTelemetry SDK from the config: the tracer provider the instrumentation of the router,
+// Postgres and Redis record their spans with, the exporter of the spans and the W3C trace context propagation.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"godmin/config"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+	ExporterOTLP   = "otlp"
+)
+
+// instrumentationName names the tracer of the spans recorded by this package
+const instrumentationName = "godmin/internal/tracing"
+
+var provider *sdktrace.TracerProvider
+
+// Configure sets the global tracer provider and propagator, before the router and the connections are made,
+// they take the provider when they are. The spans get ids even without an exporter, they are logged.
+func Configure(conf *config.Tracing) error {
+	exporter, err := NewExporter(conf)
+	if err != nil {
+		return err
+	}
+
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(conf.ServiceName)),
+	)
+	if err != nil {
+		return err
+	}
+
+	options := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+	if exporter != nil {
+		options = append(options, sdktrace.WithBatcher(exporter))
+	}
+
+	provider = sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return nil
+}
+
+// Shutdown exports the spans the provider still queues
+func Shutdown(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+
+	return provider.Shutdown(ctx)
+}
+
+// NewExporter constructs the exporter of the config, nil for none
+func NewExporter(conf *config.Tracing) (sdktrace.SpanExporter, error) {
+	switch conf.Exporter {
+	case ExporterNone:
+		return nil, nil
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterFile:
+		return newFileExporter(conf.File)
+	case ExporterOTLP:
+		return newOTLPExporter(conf.OTLPEndpoint, conf.OTLPHeaders)
+	default:
+		return nil, fmt.Errorf(
+			"unknown tracing exporter %q, use %s, %s, %s or %s",
+			conf.Exporter,
+			ExporterNone,
+			ExporterStdout,
+			ExporterFile,
+			ExporterOTLP,
+		)
+	}
+}
+
+// newOTLPExporter takes the endpoint as a URL, the exporter wants its host and path apart
+func newOTLPExporter(endpoint string, headers map[string]string) (sdktrace.SpanExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q: %w", endpoint, err)
+	}
+
+	options := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(u.Path),
+		otlptracehttp.WithHeaders(headers),
+	}
+	if u.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+
+	return otlptracehttp.New(context.Background(), options...)
+}
+
+// fileExporter closes the file the spans are written to on shutdown, the stdout exporter doesn't
+type fileExporter struct {
+	*stdouttrace.Exporter
+	f *os.File
+}
+
+func newFileExporter(path string) (*fileExporter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &fileExporter{Exporter: exporter, f: f}, nil
+}
+
+func (e *fileExporter) Shutdown(ctx context.Context) error {
+	if err := e.Exporter.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	return e.f.Close()
+}
@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"godmin/config"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+)
+
+func TestNewExporter(t *testing.T) {
+	exporter, err := NewExporter(&config.Tracing{Exporter: ExporterNone})
+	assert.NoError(t, err)
+	assert.Nil(t, exporter)
+
+	_, err = NewExporter(&config.Tracing{Exporter: "zipkin"})
+	assert.Error(t, err)
+
+	_, err = NewExporter(&config.Tracing{Exporter: ExporterOTLP, OTLPEndpoint: "http://localhost:4318/v1/traces"})
+	assert.NoError(t, err)
+
+	// the file exporter writes one JSON object per span
+	path := filepath.Join(t.TempDir(), "var", "traces.jsonl")
+	exporter, err = NewExporter(&config.Tracing{Exporter: ExporterFile, File: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	_, span := tp.Tracer("test").Start(context.Background(), "GET /")
+	span.End()
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := map[string]interface{}{}
+	if assert.NoError(t, json.Unmarshal(b, &written)) {
+		assert.Equal(t, "GET /", written["Name"])
+	}
+}
+
+func TestRedisHook(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	defer otel.SetTracerProvider(previous)
+
+	parent, root := otel.Tracer("test").Start(context.Background(), "GET /")
+	hook := RedisHook{}
+
+	// a missing key doesn't fail the span
+	get := redis.NewStringCmd("get", "missing")
+	ctx, _ := hook.BeforeProcess(parent, get)
+	get.SetErr(redis.Nil)
+	assert.NoError(t, hook.AfterProcess(ctx, get))
+
+	set := redis.NewStatusCmd("set", "key", "value")
+	ctx, _ = hook.BeforeProcessPipeline(parent, []redis.Cmder{set})
+	set.SetErr(errors.New("READONLY"))
+	assert.NoError(t, hook.AfterProcessPipeline(ctx, []redis.Cmder{set}))
+	root.End()
+
+	spans := rec.Ended()
+	if assert.Len(t, spans, 3) {
+		assert.Equal(t, "redis GET", spans[0].Name())
+		assert.Equal(t, root.SpanContext().SpanID(), spans[0].Parent().SpanID())
+		assert.Equal(t, codes.Unset, spans[0].Status().Code)
+		for _, a := range spans[0].Attributes() {
+			assert.NotEqual(t, semconv.DBStatementKey, a.Key)
+		}
+
+		assert.Equal(t, "redis pipeline", spans[1].Name())
+		assert.Contains(t, spans[1].Attributes(), semconv.DBOperationKey.String("SET"))
+		assert.Equal(t, codes.Error, spans[1].Status().Code)
+		assert.Equal(t, "READONLY", spans[1].Status().Description)
+	}
+}
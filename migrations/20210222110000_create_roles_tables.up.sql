@@ -0,0 +1,50 @@
+CREATE TABLE roles
+(
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE permissions
+(
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE role_permissions
+(
+    role_id BIGINT NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    permission_id BIGINT NOT NULL REFERENCES permissions (id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE user_roles
+(
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role_id BIGINT NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role_id)
+);
+
+INSERT INTO permissions (name, description)
+VALUES ('users:read', 'List and view users'),
+       ('users:write', 'Create, update and delete users'),
+       ('roles:read', 'List roles and their permissions'),
+       ('roles:write', 'Grant and revoke user roles'),
+       ('sessions:write', 'Revoke sessions of any user');
+
+INSERT INTO roles (name, description)
+VALUES ('admin', 'Full access to the admin panel');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+         CROSS JOIN permissions p
+WHERE r.name = 'admin';
+
+-- existing users keep the access they had before roles were introduced
+INSERT INTO user_roles (user_id, role_id)
+SELECT u.id, r.id
+FROM users u
+         CROSS JOIN roles r
+WHERE r.name = 'admin';
@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ;
+
+-- the accounts created so far keep working when EMAIL_VERIFICATION_REQUIRED is turned on
+UPDATE users SET email_verified_at = now();
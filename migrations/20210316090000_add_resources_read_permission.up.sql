@@ -0,0 +1,9 @@
+INSERT INTO permissions (name, description)
+VALUES ('resources:read', 'Describe the registered resources');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+         CROSS JOIN permissions p
+WHERE r.name = 'admin'
+  AND p.name = 'resources:read';
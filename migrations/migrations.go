@@ -0,0 +1,9 @@
+// Package migrations embeds the SQL migrations into the binary
+package migrations
+
+import "embed"
+
+// FS holds the golang-migrate style files: <version>_<name>.up.sql and <version>_<name>.down.sql
+//
+//go:embed *.sql
+var FS embed.FS